@@ -0,0 +1,236 @@
+// Package analysis turns document and query text into the terms the keyword
+// index stores and matches. An Analyzer is a tokenizer followed by a chain
+// of filters; the same analyzer must be used on both sides.
+package analysis
+
+import (
+	"fmt"
+	"strings"
+	"unicode"
+)
+
+// Tokenizer splits text into raw tokens
+type Tokenizer interface {
+	Tokenize(text string) []string
+}
+
+// Filter transforms a token stream. Filters may drop, rewrite or add tokens.
+type Filter interface {
+	Filter(tokens []string) []string
+}
+
+// TokenizerFunc adapts a function to a Tokenizer
+type TokenizerFunc func(text string) []string
+
+func (f TokenizerFunc) Tokenize(text string) []string {
+	return f(text)
+}
+
+// FilterFunc adapts a function to a Filter
+type FilterFunc func(tokens []string) []string
+
+func (f FilterFunc) Filter(tokens []string) []string {
+	return f(tokens)
+}
+
+// Config describes an analyzer chain in a form that can be stored in a
+// collection's configuration. Filters run in a fixed order: lowercase,
+// ASCII folding, stopwords, stemming, n-grams.
+type Config struct {
+	// Language picks the stopword list and stemmer when those are not set:
+	// "english" or "german"; "" for neither
+	Language string `json:"language,omitempty"`
+	// Tokenizer is "standard" (runs of letters and digits, the default) or
+	// "whitespace"
+	Tokenizer string `json:"tokenizer,omitempty"`
+	// KeepCase turns off lowercasing
+	KeepCase bool `json:"keep_case,omitempty"`
+	// ASCIIFolding maps accented Latin letters to their ASCII base, e.g. é to e
+	ASCIIFolding bool `json:"ascii_folding,omitempty"`
+	// Stopwords is the language whose stopwords are dropped, or "none"
+	Stopwords string `json:"stopwords,omitempty"`
+	// Stemmer is the language whose Snowball stemmer is applied, or "none"
+	Stemmer string `json:"stemmer,omitempty"`
+	// NGramMin and NGramMax, when set, replace each token by its character
+	// n-grams of those lengths, for partial-word matching
+	NGramMin int `json:"ngram_min,omitempty"`
+	NGramMax int `json:"ngram_max,omitempty"`
+}
+
+// Analyzer runs text through a tokenizer and its filters
+type Analyzer struct {
+	tokenizer Tokenizer
+	filters   []Filter
+
+	// config is set for analyzers built by New, so a persisted index can
+	// tell whether it was built with the same chain
+	config *Config
+}
+
+// NewAnalyzer builds a custom chain. Its output cannot be compared with a
+// persisted index, so indexes using it are rebuilt on load.
+func NewAnalyzer(tokenizer Tokenizer, filters ...Filter) *Analyzer {
+	return &Analyzer{tokenizer: tokenizer, filters: filters}
+}
+
+// New builds the analyzer a Config describes
+func New(cfg Config) (*Analyzer, error) {
+	cfg = cfg.normalize()
+
+	a := &Analyzer{config: &cfg}
+
+	switch cfg.Tokenizer {
+	case "standard":
+		a.tokenizer = TokenizerFunc(StandardTokenize)
+	case "whitespace":
+		a.tokenizer = TokenizerFunc(strings.Fields)
+	default:
+		return nil, fmt.Errorf("unknown tokenizer %q", cfg.Tokenizer)
+	}
+
+	if !cfg.KeepCase {
+		a.filters = append(a.filters, Lowercase())
+	}
+
+	if cfg.ASCIIFolding {
+		a.filters = append(a.filters, ASCIIFolding())
+	}
+
+	if cfg.Stopwords != "none" {
+		f, err := Stopwords(cfg.Stopwords)
+		if err != nil {
+			return nil, err
+		}
+		a.filters = append(a.filters, f)
+	}
+
+	if cfg.Stemmer != "none" {
+		f, err := Stemmer(cfg.Stemmer)
+		if err != nil {
+			return nil, err
+		}
+		a.filters = append(a.filters, f)
+	}
+
+	if cfg.NGramMin > 0 || cfg.NGramMax > 0 {
+		if cfg.NGramMin <= 0 || cfg.NGramMax < cfg.NGramMin {
+			return nil, fmt.Errorf("invalid n-gram range %d..%d", cfg.NGramMin, cfg.NGramMax)
+		}
+		a.filters = append(a.filters, NGrams(cfg.NGramMin, cfg.NGramMax))
+	}
+
+	return a, nil
+}
+
+// Standard is the default analyzer: standard tokens, lowercased
+func Standard() *Analyzer {
+	a, _ := New(Config{})
+	return a
+}
+
+// normalize fills in defaults, so equal chains have equal configs
+func (cfg Config) normalize() Config {
+	cfg.Language = strings.ToLower(strings.TrimSpace(cfg.Language))
+	cfg.Tokenizer = strings.ToLower(strings.TrimSpace(cfg.Tokenizer))
+	cfg.Stopwords = strings.ToLower(strings.TrimSpace(cfg.Stopwords))
+	cfg.Stemmer = strings.ToLower(strings.TrimSpace(cfg.Stemmer))
+
+	if cfg.Tokenizer == "" {
+		cfg.Tokenizer = "standard"
+	}
+
+	if cfg.Stopwords == "" {
+		cfg.Stopwords = cfg.Language
+	}
+	if cfg.Stemmer == "" {
+		cfg.Stemmer = cfg.Language
+	}
+	if cfg.Stopwords == "" {
+		cfg.Stopwords = "none"
+	}
+	if cfg.Stemmer == "" {
+		cfg.Stemmer = "none"
+	}
+
+	return cfg
+}
+
+// Config returns the configuration the analyzer was built from; false for
+// custom chains from NewAnalyzer
+func (a *Analyzer) Config() (Config, bool) {
+	if a.config == nil {
+		return Config{}, false
+	}
+	return *a.config, true
+}
+
+// Analyze returns the terms of text, in order, duplicates included
+func (a *Analyzer) Analyze(text string) []string {
+	tokens := a.tokenizer.Tokenize(text)
+	for _, f := range a.filters {
+		tokens = f.Filter(tokens)
+	}
+	return tokens
+}
+
+// StandardTokenize splits text on every rune that is not a letter or digit
+func StandardTokenize(text string) []string {
+	return strings.FieldsFunc(text, func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsNumber(r)
+	})
+}
+
+// Lowercase lowercases every token
+func Lowercase() Filter {
+	return FilterFunc(func(tokens []string) []string {
+		for i, t := range tokens {
+			tokens[i] = strings.ToLower(t)
+		}
+		return tokens
+	})
+}
+
+// NGrams replaces each token by its character n-grams of length min to
+// max. Tokens shorter than min are kept whole so they stay searchable.
+func NGrams(min, max int) Filter {
+	return FilterFunc(func(tokens []string) []string {
+		out := make([]string, 0, len(tokens))
+
+		for _, t := range tokens {
+			runes := []rune(t)
+			if len(runes) < min {
+				out = append(out, t)
+				continue
+			}
+
+			for n := min; n <= max && n <= len(runes); n++ {
+				for i := 0; i+n <= len(runes); i++ {
+					out = append(out, string(runes[i:i+n]))
+				}
+			}
+		}
+
+		return out
+	})
+}
+
+// Stemmer returns the Snowball stemmer for a language
+func Stemmer(language string) (Filter, error) {
+	var stem func(string) string
+
+	switch language {
+	case "english":
+		stem = StemEnglish
+	case "german":
+		stem = StemGerman
+	default:
+		return nil, fmt.Errorf("no stemmer for language %q", language)
+	}
+
+	return FilterFunc(func(tokens []string) []string {
+		for i, t := range tokens {
+			tokens[i] = stem(t)
+		}
+		return tokens
+	}), nil
+}
@@ -0,0 +1,79 @@
+package analysis
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestStemEnglish(t *testing.T) {
+	cases := map[string]string{
+		"pipes": "pipe", "pipe": "pipe", "running": "run", "hopping": "hop",
+		"hoped": "hope", "caresses": "caress", "ponies": "poni", "ties": "tie",
+		"cats": "cat", "gas": "gas", "generously": "generous", "consignment": "consign",
+		"consisted": "consist", "relational": "relat", "happily": "happili",
+		"skies": "sky", "news": "news", "communism": "communism", "agreed": "agre",
+		"knackeries": "knackeri", "by": "by",
+	}
+
+	for word, want := range cases {
+		if got := StemEnglish(word); got != want {
+			t.Errorf("StemEnglish(%q) = %q, want %q", word, got, want)
+		}
+	}
+}
+
+func TestStemGerman(t *testing.T) {
+	cases := map[string]string{
+		"katzen": "katz", "häuser": "haus", "laufen": "lauf", "straße": "strass",
+		"kenntnisse": "kenntnis",
+	}
+
+	for word, want := range cases {
+		if got := StemGerman(word); got != want {
+			t.Errorf("StemGerman(%q) = %q, want %q", word, got, want)
+		}
+	}
+}
+
+func TestAnalyzerChain(t *testing.T) {
+	english, err := New(Config{Language: "english", ASCIIFolding: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	got := english.Analyze("The pipes are LEAKING in the Café!")
+	want := []string{"pipe", "leak", "cafe"}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("english analyzer: got %q, want %q", got, want)
+	}
+
+	german, err := New(Config{Language: "german"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := german.Analyze("Die Katzen und die Häuser"); !reflect.DeepEqual(got, []string{"katz", "haus"}) {
+		t.Fatalf("german analyzer: got %q", got)
+	}
+
+	ngrams, err := New(Config{NGramMin: 2, NGramMax: 3})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := ngrams.Analyze("Fox a"); !reflect.DeepEqual(got, []string{"fo", "ox", "fox", "a"}) {
+		t.Fatalf("n-gram analyzer: got %q", got)
+	}
+
+	if _, err := New(Config{Language: "klingon"}); err == nil {
+		t.Fatalf("expected an unknown language to be rejected")
+	}
+
+	// the language default and the explicit settings are the same chain
+	a, _ := New(Config{Language: "english"})
+	b, _ := New(Config{Stopwords: "english", Stemmer: "English"})
+	ca, _ := a.Config()
+	cb, _ := b.Config()
+	ca.Language = ""
+	if ca != cb {
+		t.Fatalf("expected equal configs, got %+v and %+v", ca, cb)
+	}
+}
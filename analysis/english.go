@@ -0,0 +1,340 @@
+package analysis
+
+// StemEnglish is the Snowball English (Porter2) stemmer. It expects a
+// lowercased word and returns words of two letters or fewer unchanged.
+func StemEnglish(word string) string {
+	if len([]rune(word)) <= 2 {
+		return word
+	}
+
+	if stem, ok := englishExceptions[word]; ok {
+		return stem
+	}
+
+	w := []rune(word)
+	if w[0] == '\'' {
+		w = w[1:]
+	}
+
+	// y at the start or after a vowel is a consonant
+	for i := range w {
+		if w[i] == 'y' && (i == 0 || isEnglishVowel(w[i-1])) {
+			w[i] = 'Y'
+		}
+	}
+
+	r1, r2 := englishRegions(w)
+
+	w = englishStep0(w)
+	w = englishStep1a(w)
+
+	if englishInvariant[string(w)] {
+		return string(w)
+	}
+
+	w = englishStep1b(w, r1)
+	w = englishStep1c(w)
+	w = englishStep2(w, r1)
+	w = englishStep3(w, r1, r2)
+	w = englishStep4(w, r2)
+	w = englishStep5(w, r1, r2)
+
+	for i := range w {
+		if w[i] == 'Y' {
+			w[i] = 'y'
+		}
+	}
+
+	return string(w)
+}
+
+var englishExceptions = map[string]string{
+	"skis": "ski", "skies": "sky", "dying": "die", "lying": "lie", "tying": "tie",
+	"idly": "idl", "gently": "gentl", "ugly": "ugli", "early": "earli", "only": "onli",
+	"singly": "singl", "sky": "sky", "news": "news", "howe": "howe", "atlas": "atlas", "cosmos": "cosmos",
+	"bias": "bias", "andes": "andes",
+}
+
+// englishInvariant are left alone once step 1a is done
+var englishInvariant = map[string]bool{
+	"inning": true, "outing": true, "canning": true, "herring": true,
+	"earring": true, "proceed": true, "exceed": true, "succeed": true,
+}
+
+func isEnglishVowel(r rune) bool {
+	switch r {
+	case 'a', 'e', 'i', 'o', 'u', 'y':
+		return true
+	}
+	return false
+}
+
+// englishRegions returns where R1 and R2 start: each is the region after
+// the first non-vowel following a vowel, R2 searched from R1
+func englishRegions(w []rune) (int, int) {
+	r1 := len(w)
+
+	prefixed := false
+	for _, p := range []string{"gener", "commun", "arsen"} {
+		if hasPrefixRunes(w, p) {
+			r1 = len([]rune(p))
+			prefixed = true
+			break
+		}
+	}
+
+	if !prefixed {
+		r1 = regionAfter(w, 0, isEnglishVowel)
+	}
+
+	return r1, regionAfter(w, r1, isEnglishVowel)
+}
+
+// regionAfter finds the first non-vowel following a vowel at or after from
+// and returns the position after it, or len(w)
+func regionAfter(w []rune, from int, vowel func(rune) bool) int {
+	for i := from + 1; i < len(w); i++ {
+		if !vowel(w[i]) && vowel(w[i-1]) {
+			return i + 1
+		}
+	}
+	return len(w)
+}
+
+func hasPrefixRunes(w []rune, p string) bool {
+	pr := []rune(p)
+	if len(pr) > len(w) {
+		return false
+	}
+	for i, r := range pr {
+		if w[i] != r {
+			return false
+		}
+	}
+	return true
+}
+
+func hasSuffixRunes(w []rune, s string) bool {
+	sr := []rune(s)
+	if len(sr) > len(w) {
+		return false
+	}
+	off := len(w) - len(sr)
+	for i, r := range sr {
+		if w[off+i] != r {
+			return false
+		}
+	}
+	return true
+}
+
+// longestSuffix returns the longest of suffixes w ends with, or ""
+func longestSuffix(w []rune, suffixes ...string) string {
+	best := ""
+	for _, s := range suffixes {
+		if len(s) > len(best) && hasSuffixRunes(w, s) {
+			best = s
+		}
+	}
+	return best
+}
+
+func replaceSuffix(w []rune, suffix, with string) []rune {
+	out := w[:len(w)-len([]rune(suffix))]
+	return append(out, []rune(with)...)
+}
+
+func containsVowel(w []rune) bool {
+	for _, r := range w {
+		if isEnglishVowel(r) {
+			return true
+		}
+	}
+	return false
+}
+
+// endsShortSyllable reports whether w ends in a short syllable: a vowel
+// followed by a non-vowel other than w, x or Y and preceded by a non-vowel,
+// or a vowel at the start followed by a non-vowel
+func endsShortSyllable(w []rune) bool {
+	n := len(w)
+	if n == 2 {
+		return isEnglishVowel(w[0]) && !isEnglishVowel(w[1])
+	}
+	if n < 3 {
+		return false
+	}
+
+	last := w[n-1]
+	return !isEnglishVowel(w[n-3]) && isEnglishVowel(w[n-2]) &&
+		!isEnglishVowel(last) && last != 'w' && last != 'x' && last != 'Y'
+}
+
+func englishStep0(w []rune) []rune {
+	if s := longestSuffix(w, "'s'", "'s", "'"); s != "" {
+		return replaceSuffix(w, s, "")
+	}
+	return w
+}
+
+func englishStep1a(w []rune) []rune {
+	switch longestSuffix(w, "sses", "ied", "ies", "s", "us", "ss") {
+	case "sses":
+		return replaceSuffix(w, "sses", "ss")
+	case "ied", "ies":
+		if len(w) > 4 {
+			return replaceSuffix(w, "ies", "i")
+		}
+		return replaceSuffix(w, "ies", "ie")
+	case "s":
+		// delete if a vowel comes before the letter preceding the s
+		if len(w) >= 3 && containsVowel(w[:len(w)-2]) {
+			return w[:len(w)-1]
+		}
+	}
+	return w
+}
+
+func englishStep1b(w []rune, r1 int) []rune {
+	s := longestSuffix(w, "eed", "eedly", "ed", "edly", "ing", "ingly")
+
+	switch s {
+	case "":
+		return w
+	case "eed", "eedly":
+		if len(w)-len(s) >= r1 {
+			return replaceSuffix(w, s, "ee")
+		}
+		return w
+	}
+
+	stem := w[:len(w)-len(s)]
+	if !containsVowel(stem) {
+		return w
+	}
+	w = stem
+
+	switch {
+	case hasSuffixRunes(w, "at"), hasSuffixRunes(w, "bl"), hasSuffixRunes(w, "iz"):
+		return append(w, 'e')
+	case endsDouble(w):
+		return w[:len(w)-1]
+	case r1 >= len(w) && endsShortSyllable(w):
+		return append(w, 'e')
+	}
+	return w
+}
+
+func endsDouble(w []rune) bool {
+	for _, d := range []string{"bb", "dd", "ff", "gg", "mm", "nn", "pp", "rr", "tt"} {
+		if hasSuffixRunes(w, d) {
+			return true
+		}
+	}
+	return false
+}
+
+func englishStep1c(w []rune) []rune {
+	n := len(w)
+	if n > 2 && (w[n-1] == 'y' || w[n-1] == 'Y') && !isEnglishVowel(w[n-2]) {
+		w[n-1] = 'i'
+	}
+	return w
+}
+
+var englishStep2Suffixes = map[string]string{
+	"tional": "tion", "enci": "ence", "anci": "ance", "abli": "able", "entli": "ent",
+	"izer": "ize", "ization": "ize", "ational": "ate", "ation": "ate", "ator": "ate",
+	"alism": "al", "aliti": "al", "alli": "al", "fulness": "ful", "ousli": "ous",
+	"ousness": "ous", "iveness": "ive", "iviti": "ive", "biliti": "ble", "bli": "ble",
+	"ogi": "og", "fulli": "ful", "lessli": "less", "li": "",
+}
+
+func englishStep2(w []rune, r1 int) []rune {
+	s := ""
+	for suffix := range englishStep2Suffixes {
+		if len(suffix) > len(s) && hasSuffixRunes(w, suffix) {
+			s = suffix
+		}
+	}
+	if s == "" || len(w)-len(s) < r1 {
+		return w
+	}
+
+	switch s {
+	case "ogi":
+		if !hasSuffixRunes(w, "logi") {
+			return w
+		}
+	case "li":
+		if len(w) < 3 || !isValidLiEnding(w[len(w)-3]) {
+			return w
+		}
+	}
+
+	return replaceSuffix(w, s, englishStep2Suffixes[s])
+}
+
+func isValidLiEnding(r rune) bool {
+	switch r {
+	case 'c', 'd', 'e', 'g', 'h', 'k', 'm', 'n', 'r', 't':
+		return true
+	}
+	return false
+}
+
+var englishStep3Suffixes = map[string]string{
+	"tional": "tion", "ational": "ate", "alize": "al", "icate": "ic", "iciti": "ic",
+	"ical": "ic", "ful": "", "ness": "", "ative": "",
+}
+
+func englishStep3(w []rune, r1, r2 int) []rune {
+	s := ""
+	for suffix := range englishStep3Suffixes {
+		if len(suffix) > len(s) && hasSuffixRunes(w, suffix) {
+			s = suffix
+		}
+	}
+	if s == "" || len(w)-len(s) < r1 {
+		return w
+	}
+
+	if s == "ative" && len(w)-len(s) < r2 {
+		return w
+	}
+
+	return replaceSuffix(w, s, englishStep3Suffixes[s])
+}
+
+func englishStep4(w []rune, r2 int) []rune {
+	s := longestSuffix(w, "al", "ance", "ence", "er", "ic", "able", "ible", "ant",
+		"ement", "ment", "ent", "ism", "ate", "iti", "ous", "ive", "ize", "ion")
+	if s == "" || len(w)-len(s) < r2 {
+		return w
+	}
+
+	if s == "ion" {
+		n := len(w) - 3
+		if n == 0 || (w[n-1] != 's' && w[n-1] != 't') {
+			return w
+		}
+	}
+
+	return replaceSuffix(w, s, "")
+}
+
+func englishStep5(w []rune, r1, r2 int) []rune {
+	n := len(w)
+
+	switch {
+	case n > 0 && w[n-1] == 'e':
+		if n-1 >= r2 || (n-1 >= r1 && !endsShortSyllable(w[:n-1])) {
+			return w[:n-1]
+		}
+	case n > 1 && w[n-1] == 'l':
+		if n-1 >= r2 && w[n-2] == 'l' {
+			return w[:n-1]
+		}
+	}
+	return w
+}
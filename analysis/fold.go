@@ -0,0 +1,68 @@
+package analysis
+
+import "strings"
+
+// asciiFolds maps accented Latin letters to their ASCII base. Letters that
+// stand for two (ß, æ, œ, ...) fold to both.
+var asciiFolds = map[rune]string{
+	'à': "a", 'á': "a", 'â': "a", 'ã': "a", 'ä': "a", 'å': "a", 'ā': "a", 'ă': "a", 'ą': "a",
+	'À': "A", 'Á': "A", 'Â': "A", 'Ã': "A", 'Ä': "A", 'Å': "A", 'Ā': "A", 'Ă': "A", 'Ą': "A",
+	'ç': "c", 'ć': "c", 'ĉ': "c", 'ċ': "c", 'č': "c",
+	'Ç': "C", 'Ć': "C", 'Ĉ': "C", 'Ċ': "C", 'Č': "C",
+	'ď': "d", 'đ': "d", 'ð': "d", 'Ď': "D", 'Đ': "D", 'Ð': "D",
+	'è': "e", 'é': "e", 'ê': "e", 'ë': "e", 'ē': "e", 'ĕ': "e", 'ė': "e", 'ę': "e", 'ě': "e",
+	'È': "E", 'É': "E", 'Ê': "E", 'Ë': "E", 'Ē': "E", 'Ĕ': "E", 'Ė': "E", 'Ę': "E", 'Ě': "E",
+	'ĝ': "g", 'ğ': "g", 'ġ': "g", 'ģ': "g", 'Ĝ': "G", 'Ğ': "G", 'Ġ': "G", 'Ģ': "G",
+	'ĥ': "h", 'ħ': "h", 'Ĥ': "H", 'Ħ': "H",
+	'ì': "i", 'í': "i", 'î': "i", 'ï': "i", 'ĩ': "i", 'ī': "i", 'ĭ': "i", 'į': "i", 'ı': "i",
+	'Ì': "I", 'Í': "I", 'Î': "I", 'Ï': "I", 'Ĩ': "I", 'Ī': "I", 'Ĭ': "I", 'Į': "I", 'İ': "I",
+	'ĵ': "j", 'Ĵ': "J", 'ķ': "k", 'Ķ': "K",
+	'ĺ': "l", 'ļ': "l", 'ľ': "l", 'ŀ': "l", 'ł': "l", 'Ĺ': "L", 'Ļ': "L", 'Ľ': "L", 'Ŀ': "L", 'Ł': "L",
+	'ñ': "n", 'ń': "n", 'ņ': "n", 'ň': "n", 'Ñ': "N", 'Ń': "N", 'Ņ': "N", 'Ň': "N",
+	'ò': "o", 'ó': "o", 'ô': "o", 'õ': "o", 'ö': "o", 'ø': "o", 'ō': "o", 'ŏ': "o", 'ő': "o",
+	'Ò': "O", 'Ó': "O", 'Ô': "O", 'Õ': "O", 'Ö': "O", 'Ø': "O", 'Ō': "O", 'Ŏ': "O", 'Ő': "O",
+	'ŕ': "r", 'ŗ': "r", 'ř': "r", 'Ŕ': "R", 'Ŗ': "R", 'Ř': "R",
+	'ś': "s", 'ŝ': "s", 'ş': "s", 'š': "s", 'Ś': "S", 'Ŝ': "S", 'Ş': "S", 'Š': "S",
+	'ţ': "t", 'ť': "t", 'ŧ': "t", 'Ţ': "T", 'Ť': "T", 'Ŧ': "T",
+	'ù': "u", 'ú': "u", 'û': "u", 'ü': "u", 'ũ': "u", 'ū': "u", 'ŭ': "u", 'ů': "u", 'ű': "u", 'ų': "u",
+	'Ù': "U", 'Ú': "U", 'Û': "U", 'Ü': "U", 'Ũ': "U", 'Ū': "U", 'Ŭ': "U", 'Ů': "U", 'Ű': "U", 'Ų': "U",
+	'ŵ': "w", 'Ŵ': "W",
+	'ý': "y", 'ÿ': "y", 'ŷ': "y", 'Ý': "Y", 'Ÿ': "Y", 'Ŷ': "Y",
+	'ź': "z", 'ż': "z", 'ž': "z", 'Ź': "Z", 'Ż': "Z", 'Ž': "Z",
+	'ß': "ss", 'æ': "ae", 'Æ': "AE", 'œ': "oe", 'Œ': "OE", 'þ': "th", 'Þ': "TH",
+}
+
+// ASCIIFolding folds accented Latin letters in every token
+func ASCIIFolding() Filter {
+	return FilterFunc(func(tokens []string) []string {
+		for i, t := range tokens {
+			tokens[i] = foldString(t)
+		}
+		return tokens
+	})
+}
+
+func foldString(s string) string {
+	// most tokens are plain ASCII already
+	ascii := true
+	for i := 0; i < len(s); i++ {
+		if s[i] >= 0x80 {
+			ascii = false
+			break
+		}
+	}
+	if ascii {
+		return s
+	}
+
+	var b strings.Builder
+	b.Grow(len(s))
+	for _, r := range s {
+		if f, ok := asciiFolds[r]; ok {
+			b.WriteString(f)
+		} else {
+			b.WriteRune(r)
+		}
+	}
+	return b.String()
+}
@@ -0,0 +1,139 @@
+package analysis
+
+// StemGerman is the Snowball German stemmer. It expects a lowercased word.
+func StemGerman(word string) string {
+	w := make([]rune, 0, len(word))
+	for _, r := range word {
+		if r == 'ß' {
+			w = append(w, 's', 's')
+		} else {
+			w = append(w, r)
+		}
+	}
+
+	// u and y between vowels are consonants
+	for i := 1; i+1 < len(w); i++ {
+		if (w[i] == 'u' || w[i] == 'y') && isGermanVowel(w[i-1]) && isGermanVowel(w[i+1]) {
+			w[i] -= 'a' - 'A'
+		}
+	}
+
+	r1 := regionAfter(w, 0, isGermanVowel)
+	r2 := regionAfter(w, r1, isGermanVowel)
+	if r1 < 3 {
+		r1 = 3
+	}
+
+	w = germanStep1(w, r1)
+	w = germanStep2(w, r1)
+	w = germanStep3(w, r1, r2)
+
+	for i, r := range w {
+		switch r {
+		case 'U':
+			w[i] = 'u'
+		case 'Y':
+			w[i] = 'y'
+		case 'ä':
+			w[i] = 'a'
+		case 'ö':
+			w[i] = 'o'
+		case 'ü':
+			w[i] = 'u'
+		}
+	}
+
+	return string(w)
+}
+
+func isGermanVowel(r rune) bool {
+	switch r {
+	case 'a', 'e', 'i', 'o', 'u', 'y', 'ä', 'ö', 'ü':
+		return true
+	}
+	return false
+}
+
+func isGermanSEnding(r rune) bool {
+	switch r {
+	case 'b', 'd', 'f', 'g', 'h', 'k', 'l', 'm', 'n', 'r', 't':
+		return true
+	}
+	return false
+}
+
+func isGermanStEnding(r rune) bool {
+	return r != 'r' && isGermanSEnding(r)
+}
+
+func germanStep1(w []rune, r1 int) []rune {
+	s := longestSuffix(w, "em", "ern", "er", "e", "en", "es", "s")
+	if s == "" || len(w)-len(s) < r1 {
+		return w
+	}
+
+	switch s {
+	case "e", "en", "es":
+		w = replaceSuffix(w, s, "")
+		if hasSuffixRunes(w, "niss") {
+			w = w[:len(w)-1]
+		}
+		return w
+	case "s":
+		if len(w) < 2 || !isGermanSEnding(w[len(w)-2]) {
+			return w
+		}
+	}
+
+	return replaceSuffix(w, s, "")
+}
+
+func germanStep2(w []rune, r1 int) []rune {
+	s := longestSuffix(w, "en", "er", "est", "st")
+	if s == "" || len(w)-len(s) < r1 {
+		return w
+	}
+
+	if s == "st" {
+		// the st-ending letter must itself follow at least 3 letters
+		end := len(w) - 3
+		if end < 3 || !isGermanStEnding(w[end]) {
+			return w
+		}
+	}
+
+	return replaceSuffix(w, s, "")
+}
+
+func germanStep3(w []rune, r1, r2 int) []rune {
+	s := longestSuffix(w, "end", "ung", "ig", "ik", "isch", "lich", "heit", "keit")
+	if s == "" || len(w)-len(s) < r2 {
+		return w
+	}
+
+	precededByE := len(w) > len(s) && w[len(w)-len(s)-1] == 'e'
+
+	switch s {
+	case "end", "ung":
+		w = replaceSuffix(w, s, "")
+		if hasSuffixRunes(w, "ig") && len(w)-2 >= r2 && !(len(w) > 2 && w[len(w)-3] == 'e') {
+			w = w[:len(w)-2]
+		}
+	case "ig", "ik", "isch":
+		if !precededByE {
+			w = replaceSuffix(w, s, "")
+		}
+	case "lich", "heit":
+		w = replaceSuffix(w, s, "")
+		if (hasSuffixRunes(w, "er") || hasSuffixRunes(w, "en")) && len(w)-2 >= r1 {
+			w = w[:len(w)-2]
+		}
+	case "keit":
+		w = replaceSuffix(w, s, "")
+		if t := longestSuffix(w, "lich", "ig"); t != "" && len(w)-len(t) >= r2 {
+			w = replaceSuffix(w, t, "")
+		}
+	}
+
+	return w
+}
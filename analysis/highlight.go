@@ -0,0 +1,155 @@
+package analysis
+
+import (
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// Span is a byte range [Start, End) of a text
+type Span struct {
+	Start int `json:"start"`
+	End   int `json:"end"`
+}
+
+// Spans returns where the tokens of text that analyze to one of terms are,
+// in order. Each token is run through the filters on its own, which is
+// what every filter New builds does anyway; tokens the tokenizer rewrote
+// so they no longer appear in text are skipped.
+func (a *Analyzer) Spans(text string, terms map[string]bool) []Span {
+	if len(terms) == 0 {
+		return nil
+	}
+
+	var spans []Span
+	pos := 0
+
+	for _, token := range a.tokenizer.Tokenize(text) {
+		i := strings.Index(text[pos:], token)
+		if i < 0 {
+			continue
+		}
+		start := pos + i
+		pos = start + len(token)
+
+		analyzed := []string{token}
+		for _, f := range a.filters {
+			analyzed = f.Filter(analyzed)
+		}
+		for _, term := range analyzed {
+			if terms[term] {
+				spans = append(spans, Span{Start: start, End: pos})
+				break
+			}
+		}
+	}
+
+	return spans
+}
+
+// DefaultSnippetSize is how many bytes of text a snippet shows by default
+const DefaultSnippetSize = 160
+
+// SnippetOptions shapes a snippet. Zero fields take the defaults.
+type SnippetOptions struct {
+	// Size is roughly how many bytes of text the snippet shows
+	Size int `json:"snippet_size,omitempty"`
+	// PreTag and PostTag surround each match; <em> and </em> by default
+	PreTag  string `json:"pre_tag,omitempty"`
+	PostTag string `json:"post_tag,omitempty"`
+}
+
+func (o SnippetOptions) withDefaults() SnippetOptions {
+	if o.Size <= 0 {
+		o.Size = DefaultSnippetSize
+	}
+	if o.PreTag == "" && o.PostTag == "" {
+		o.PreTag, o.PostTag = "<em>", "</em>"
+	}
+	return o
+}
+
+// Snippet cuts the window of text holding the most spans, centered on them
+// and widened to word boundaries, and marks the spans inside it. Text
+// before or after the window is replaced by "…"; with no spans the snippet
+// is the start of text. Spans must be sorted and not overlap.
+func Snippet(text string, spans []Span, opts SnippetOptions) string {
+	opts = opts.withDefaults()
+
+	// the run of spans that fits the size and holds the most of them
+	first, last := 0, -1
+	for i := range spans {
+		j := i
+		for j+1 < len(spans) && spans[j+1].End-spans[i].Start <= opts.Size {
+			j++
+		}
+		if j-i > last-first {
+			first, last = i, j
+		}
+	}
+
+	start, end := 0, min(len(text), opts.Size)
+	if last >= 0 {
+		covered := spans[last].End - spans[first].Start
+		size := max(opts.Size, covered)
+		start = max(0, spans[first].Start-(size-covered)/2)
+		end = min(len(text), start+size)
+		start = max(0, end-size)
+	}
+	start, end = wordStart(text, start), wordEnd(text, end)
+
+	var b strings.Builder
+	if start > 0 {
+		b.WriteString("…")
+	}
+
+	pos := start
+	for _, s := range spans {
+		if s.Start < start || s.End > end {
+			continue
+		}
+		b.WriteString(text[pos:s.Start])
+		b.WriteString(opts.PreTag)
+		b.WriteString(text[s.Start:s.End])
+		b.WriteString(opts.PostTag)
+		pos = s.End
+	}
+	b.WriteString(text[pos:end])
+
+	if end < len(text) {
+		b.WriteString("…")
+	}
+
+	return strings.TrimSpace(b.String())
+}
+
+// wordStart moves i back to the start of the word it falls in
+func wordStart(text string, i int) int {
+	for i > 0 && !startsWord(text, i) {
+		i--
+	}
+	return i
+}
+
+// wordEnd moves i forward to the end of the word it falls in
+func wordEnd(text string, i int) int {
+	for i < len(text) && !utf8.RuneStart(text[i]) {
+		i++
+	}
+	for i < len(text) {
+		r, size := utf8.DecodeRuneInString(text[i:])
+		if unicode.IsSpace(r) {
+			break
+		}
+		i += size
+	}
+	return i
+}
+
+func startsWord(text string, i int) bool {
+	if !utf8.RuneStart(text[i]) {
+		return false
+	}
+	r, _ := utf8.DecodeLastRuneInString(text[:i])
+	return unicode.IsSpace(r)
+}
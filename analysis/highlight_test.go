@@ -0,0 +1,55 @@
+package analysis
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestSpans(t *testing.T) {
+	english, err := New(Config{Language: "english", ASCIIFolding: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	text := "Pipes burst at the Café; the pipe was old."
+	spans := english.Spans(text, map[string]bool{"pipe": true, "cafe": true, "the": true})
+
+	var got []string
+	for _, s := range spans {
+		got = append(got, text[s.Start:s.End])
+	}
+	// "the" is a stopword, so no token analyzes to it
+	if want := []string{"Pipes", "Café", "pipe"}; !reflect.DeepEqual(got, want) {
+		t.Fatalf("got %q, want %q", got, want)
+	}
+}
+
+func TestSnippet(t *testing.T) {
+	text := "Residents reported low pressure for weeks. " +
+		"Yesterday a water main burst on Station Road and the pipe flooded two cellars. " +
+		"Repairs are expected to take three days."
+
+	spans := Standard().Spans(text, map[string]bool{"burst": true, "pipe": true, "repairs": true})
+
+	got := Snippet(text, spans, SnippetOptions{Size: 60, PreTag: "[", PostTag: "]"})
+	want := "…a water main [burst] on Station Road and the [pipe] flooded two cellars.…"
+	if got != want {
+		t.Fatalf("got %q, want %q", got, want)
+	}
+
+	// the default tags and size fit the whole text
+	if got := Snippet(text, spans, SnippetOptions{}); strings.Count(got, "<em>") != 3 || strings.Contains(got, "…") {
+		t.Fatalf("unexpected default snippet %q", got)
+	}
+
+	// without matches the snippet is the start of the text
+	if got := Snippet(text, nil, SnippetOptions{Size: 20}); got != "Residents reported low…" {
+		t.Fatalf("unexpected snippet without matches %q", got)
+	}
+
+	// multi-byte text is cut on word boundaries
+	if got := Snippet("ääää öööö üüüü", []Span{{Start: 9, End: 17}}, SnippetOptions{Size: 4}); got != "…<em>öööö</em>…" {
+		t.Fatalf("unexpected snippet %q", got)
+	}
+}
@@ -0,0 +1,61 @@
+package analysis
+
+import (
+	"fmt"
+	"strings"
+)
+
+// englishStopwords is the common Lucene English list
+var englishStopwords = []string{
+	"a", "an", "and", "are", "as", "at", "be", "but", "by", "for", "if", "in",
+	"into", "is", "it", "no", "not", "of", "on", "or", "such", "that", "the",
+	"their", "then", "there", "these", "they", "this", "to", "was", "will", "with",
+}
+
+// germanStopwords is the core of the Snowball German list
+var germanStopwords = []string{
+	"aber", "alle", "allem", "allen", "aller", "alles", "als", "also", "am", "an",
+	"ander", "andere", "anderem", "anderen", "anderer", "anderes", "auch", "auf",
+	"aus", "bei", "bin", "bis", "bist", "da", "damit", "dann", "das", "dass", "daß",
+	"dem", "den", "der", "des", "die", "dies", "diese", "dieser", "dieses", "doch",
+	"du", "durch", "ein", "eine", "einem", "einen", "einer", "eines", "er", "es",
+	"für", "hatte", "hatten", "hier", "ich", "ihr", "ihre", "im", "in", "ist", "ja",
+	"jede", "jedem", "jeden", "jeder", "jedes", "kein", "keine", "keinem", "keinen",
+	"keiner", "mich", "mir", "mit", "nach", "nicht", "noch", "nun", "nur", "ob",
+	"oder", "ohne", "sehr", "sein", "seine", "sich", "sie", "sind", "so", "über",
+	"um", "und", "uns", "unter", "vom", "von", "vor", "war", "waren", "was", "weil",
+	"welche", "wenn", "wer", "wie", "wieder", "wir", "wird", "wo", "zu", "zum",
+	"zur", "zwar", "zwischen",
+}
+
+// Stopwords returns a filter dropping a language's stopwords. Words are
+// matched lowercased, with and without ASCII folding, so the filter works
+// wherever it sits in the chain.
+func Stopwords(language string) (Filter, error) {
+	var list []string
+
+	switch language {
+	case "english":
+		list = englishStopwords
+	case "german":
+		list = germanStopwords
+	default:
+		return nil, fmt.Errorf("no stopwords for language %q", language)
+	}
+
+	set := make(map[string]struct{}, 2*len(list))
+	for _, w := range list {
+		set[w] = struct{}{}
+		set[foldString(w)] = struct{}{}
+	}
+
+	return FilterFunc(func(tokens []string) []string {
+		out := tokens[:0]
+		for _, t := range tokens {
+			if _, stop := set[strings.ToLower(t)]; !stop {
+				out = append(out, t)
+			}
+		}
+		return out
+	}), nil
+}
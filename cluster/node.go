@@ -3,6 +3,7 @@ package cluster
 import (
 	"errors"
 	"flashvector/cluster/rpc"
+	"flashvector/metadata"
 	"flashvector/storage"
 	"flashvector/wal"
 	"fmt"
@@ -53,16 +54,16 @@ func (n *Node) IsLeader() bool{
 	return n.Config.IsLeader()
 }
 
-func (n *Node) Set(key string,value []byte,metadata map[string]string) error{
+func (n *Node) Set(key string,value []byte,meta metadata.Map,text string) error{
 	if !n.IsLeader(){
 		return errors.New("not leader")
 	}
 // write to local wal
-	if err := n.WAL.LogSet(key,value,metadata);err != nil{
+	if err := n.WAL.LogSet(key,value,meta,text);err != nil{
 		return err
 	}
 // apply localy
-	if err := n.Store.Set(key,value,metadata);err != nil{
+	if err := n.Store.Set(key,value,meta,text);err != nil{
 		return err
 	}
 
@@ -71,8 +72,9 @@ func (n *Node) Set(key string,value []byte,metadata map[string]string) error{
 		Op : 1,
 		Key : key,
 		Value : value,
-		Metadata : metadata,
+		Text : text,
 	}
+	rpc.EncodeMetadata(record,meta)
 
 	for id,clients := range n.Clients{
 		if n.unhealthy[id]{
@@ -122,8 +124,8 @@ func (n *Node) Delete(key string)error{
 // --- Implementation of rpc.ReplicaHandler Interface ---
 
 // ApplySet delegates the apply operation to the underlying store
-func (n *Node) ApplySet(key string, value []byte) {
-	n.Store.ApplySet(key, value,nil)
+func (n *Node) ApplySet(key string, value []byte, meta metadata.Map, text string) {
+	n.Store.ApplySet(key, value,meta,text)
 }
 
 // ApplyDelete delegates the apply operation to the underlying store
@@ -2,13 +2,16 @@ package cluster
 
 import (
 	"context"
+	"flashvector/cluster/rpc"
 	"flashvector/storage"
 	"flashvector/wal"
+	"net"
 	"os"
 	"testing"
 	"time"
 	"sync"
 	"fmt"
+	"google.golang.org/grpc"
 )
 
 // setupTestNode is a helper to quickly spin up a node for testing
@@ -187,7 +190,7 @@ func TestConcurrentLeaderWrites(t *testing.T) {
 			key := fmt.Sprintf("key-%d", i)
 			
 			// Pass the valid vector data instead of []byte("value")
-			node.Set(key, validVectorData, nil)
+			node.Set(key, validVectorData, nil, "")
 		}(i)
 	}
 
@@ -201,7 +204,7 @@ func TestLeaderWriteAllowed(t *testing.T) {
 	// Use a 1536-byte array to satisfy the 384-dimension vector requirement
 	validVectorData := make([]byte, 1536)
 
-	err := node1.Set("leader_key", validVectorData, nil)
+	err := node1.Set("leader_key", validVectorData, nil, "")
 
 	if err != nil {
 		t.Fatalf("Leader should accept writes, got error: %v", err)
@@ -250,7 +253,7 @@ func TestWALRecovery(t *testing.T) {
 
 	// USE 1536 BYTES!
 	validData := make([]byte, 1536)
-	store.Set("key1", validData, nil)
+	store.Set("key1", validData, nil, "")
 	store.Close()
 
 	// reopen WAL
@@ -275,7 +278,7 @@ func TestReplication(t *testing.T) {
 
 	// USE 1536 BYTES!
 	validData := make([]byte, 1536)
-	node1.Set("rep_key", validData, nil)
+	node1.Set("rep_key", validData, nil, "")
 
 	// Correct Store.Get signature
 	val, _, ok := node1.Store.Get("rep_key")
@@ -288,6 +291,34 @@ func TestReplication(t *testing.T) {
 	}
 }
 
+func TestReplicationCarriesText(t *testing.T) {
+	follower, cleanupFollower := setupTestNode(t, "node-2", "node-1", nil)
+	defer cleanupFollower()
+
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	server := grpc.NewServer()
+	rpc.RegisterReplicationServiceServer(server, &rpc.ReplicationServer{Node: follower})
+	go server.Serve(lis)
+	defer server.Stop()
+
+	leader, cleanupLeader := setupTestNode(t, "node-1", "node-1", []NodeConfig{{ID: "node-2", Address: lis.Addr().String()}})
+	defer cleanupLeader()
+
+	if err := leader.Set("doc", make([]byte, 1536), nil, "hello replicated world"); err != nil {
+		t.Fatal(err)
+	}
+
+	if leader.unhealthy["node-2"] {
+		t.Fatalf("replication to the follower failed")
+	}
+	if texts := follower.Store.Texts([]string{"doc"}); texts[0] != "hello replicated world" {
+		t.Fatalf("expected the follower to keep the text, got %q", texts[0])
+	}
+}
+
 func TestChaosNodeRestart(t *testing.T) {
 	// 1. Correctly define peer lists for each node (A node is not its own peer)
 	peersForNode1 := []NodeConfig{{ID: "node-2", Address: "localhost:8082"}, {ID: "node-3", Address: "localhost:8083"}}
@@ -0,0 +1,70 @@
+package rpc
+
+import (
+	"time"
+
+	"flashvector/metadata"
+)
+
+// EncodeMetadata fills both metadata fields of a record: Metadata with the
+// values as text, which followers that predate typed metadata still read,
+// and TypedMetadata with the values themselves
+func EncodeMetadata(rec *WALRecord, meta metadata.Map) {
+	if meta == nil {
+		return
+	}
+
+	rec.Metadata = meta.Strings()
+	rec.TypedMetadata = make(map[string]*MetadataValue, len(meta))
+
+	for field, v := range meta {
+		out := &MetadataValue{}
+		switch v.Type {
+		case metadata.Int:
+			out.Kind = &MetadataValue_IntValue{IntValue: v.Int}
+		case metadata.Float:
+			out.Kind = &MetadataValue_FloatValue{FloatValue: v.Float}
+		case metadata.Bool:
+			out.Kind = &MetadataValue_BoolValue{BoolValue: v.Bool}
+		case metadata.Timestamp:
+			out.Kind = &MetadataValue_Timestamp{Timestamp: v.Time.Format(time.RFC3339Nano)}
+		case metadata.StringList:
+			out.Kind = &MetadataValue_ListValue{ListValue: &StringList{Values: v.List}}
+		default:
+			out.Kind = &MetadataValue_StringValue{StringValue: v.Str}
+		}
+		rec.TypedMetadata[field] = out
+	}
+}
+
+// DecodeMetadata returns a record's metadata, typed when the leader sent
+// types and as strings when it only filled Metadata
+func DecodeMetadata(rec *WALRecord) metadata.Map {
+	if len(rec.TypedMetadata) == 0 {
+		return metadata.Strings(rec.Metadata)
+	}
+
+	out := make(metadata.Map, len(rec.TypedMetadata))
+	for field, v := range rec.TypedMetadata {
+		switch kind := v.GetKind().(type) {
+		case *MetadataValue_IntValue:
+			out[field] = metadata.IntValue(kind.IntValue)
+		case *MetadataValue_FloatValue:
+			out[field] = metadata.FloatValue(kind.FloatValue)
+		case *MetadataValue_BoolValue:
+			out[field] = metadata.BoolValue(kind.BoolValue)
+		case *MetadataValue_Timestamp:
+			t, err := time.Parse(time.RFC3339Nano, kind.Timestamp)
+			if err != nil {
+				out[field] = metadata.StringValue(rec.Metadata[field])
+				continue
+			}
+			out[field] = metadata.TimeValue(t)
+		case *MetadataValue_ListValue:
+			out[field] = metadata.ListValue(kind.ListValue.GetValues()...)
+		default:
+			out[field] = metadata.StringValue(v.GetStringValue())
+		}
+	}
+	return out
+}
@@ -0,0 +1,49 @@
+package rpc
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"flashvector/metadata"
+
+	"google.golang.org/protobuf/proto"
+)
+
+func TestMetadataRoundTrip(t *testing.T) {
+	meta := metadata.Map{
+		"lang":     metadata.StringValue("en"),
+		"stock":    metadata.IntValue(-3),
+		"price":    metadata.FloatValue(9.5),
+		"open":     metadata.BoolValue(true),
+		"reported": metadata.TimeValue(time.Date(2024, 3, 1, 12, 30, 0, 5, time.UTC)),
+		"tags":     metadata.ListValue("a", "b"),
+	}
+
+	rec := &WALRecord{Op: 1, Key: "k"}
+	EncodeMetadata(rec, meta)
+
+	b, err := proto.Marshal(rec)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got WALRecord
+	if err := proto.Unmarshal(b, &got); err != nil {
+		t.Fatal(err)
+	}
+
+	if decoded := DecodeMetadata(&got); !reflect.DeepEqual(decoded, meta) {
+		t.Fatalf("got %v, want %v", decoded, meta)
+	}
+
+	// a follower that only knows field 4 still gets every value as text
+	if got.Metadata["stock"] != "-3" || got.Metadata["tags"] != "a,b" {
+		t.Fatalf("unexpected string metadata %v", got.Metadata)
+	}
+
+	// and a leader that only sends field 4 is read as strings
+	got.TypedMetadata = nil
+	if decoded := DecodeMetadata(&got); !decoded["stock"].Equal(metadata.StringValue("-3")) {
+		t.Fatalf("expected string values, got %v", decoded)
+	}
+}
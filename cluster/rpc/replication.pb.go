@@ -1,6 +1,6 @@
 // Code generated by protoc-gen-go. DO NOT EDIT.
 // versions:
-// 	protoc-gen-go v1.36.11
+// 	protoc-gen-go v1.36.10
 // 	protoc        v6.33.2
 // source: replication.proto
 
@@ -22,11 +22,13 @@ const (
 )
 
 type WALRecord struct {
-	state         protoimpl.MessageState `protogen:"open.v1"`
-	Op            uint32                 `protobuf:"varint,1,opt,name=op,proto3" json:"op,omitempty"`
-	Key           string                 `protobuf:"bytes,2,opt,name=key,proto3" json:"key,omitempty"`
-	Value         []byte                 `protobuf:"bytes,3,opt,name=value,proto3" json:"value,omitempty"`
-	Metadata      map[string]string      `protobuf:"bytes,4,rep,name=metadata,proto3" json:"metadata,omitempty" protobuf_key:"bytes,1,opt,name=key" protobuf_val:"bytes,2,opt,name=value"`
+	state         protoimpl.MessageState    `protogen:"open.v1"`
+	Op            uint32                    `protobuf:"varint,1,opt,name=op,proto3" json:"op,omitempty"`
+	Key           string                    `protobuf:"bytes,2,opt,name=key,proto3" json:"key,omitempty"`
+	Value         []byte                    `protobuf:"bytes,3,opt,name=value,proto3" json:"value,omitempty"`
+	Metadata      map[string]string         `protobuf:"bytes,4,rep,name=metadata,proto3" json:"metadata,omitempty" protobuf_key:"bytes,1,opt,name=key" protobuf_val:"bytes,2,opt,name=value"`
+	TypedMetadata map[string]*MetadataValue `protobuf:"bytes,5,rep,name=typed_metadata,json=typedMetadata,proto3" json:"typed_metadata,omitempty" protobuf_key:"bytes,1,opt,name=key" protobuf_val:"bytes,2,opt,name=value"`
+	Text          string                    `protobuf:"bytes,6,opt,name=text,proto3" json:"text,omitempty"`
 	unknownFields protoimpl.UnknownFields
 	sizeCache     protoimpl.SizeCache
 }
@@ -89,6 +91,210 @@ func (x *WALRecord) GetMetadata() map[string]string {
 	return nil
 }
 
+func (x *WALRecord) GetTypedMetadata() map[string]*MetadataValue {
+	if x != nil {
+		return x.TypedMetadata
+	}
+	return nil
+}
+
+func (x *WALRecord) GetText() string {
+	if x != nil {
+		return x.Text
+	}
+	return ""
+}
+
+type MetadataValue struct {
+	state protoimpl.MessageState `protogen:"open.v1"`
+	// Types that are valid to be assigned to Kind:
+	//
+	//	*MetadataValue_StringValue
+	//	*MetadataValue_IntValue
+	//	*MetadataValue_FloatValue
+	//	*MetadataValue_BoolValue
+	//	*MetadataValue_Timestamp
+	//	*MetadataValue_ListValue
+	Kind          isMetadataValue_Kind `protobuf_oneof:"kind"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *MetadataValue) Reset() {
+	*x = MetadataValue{}
+	mi := &file_replication_proto_msgTypes[1]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *MetadataValue) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*MetadataValue) ProtoMessage() {}
+
+func (x *MetadataValue) ProtoReflect() protoreflect.Message {
+	mi := &file_replication_proto_msgTypes[1]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use MetadataValue.ProtoReflect.Descriptor instead.
+func (*MetadataValue) Descriptor() ([]byte, []int) {
+	return file_replication_proto_rawDescGZIP(), []int{1}
+}
+
+func (x *MetadataValue) GetKind() isMetadataValue_Kind {
+	if x != nil {
+		return x.Kind
+	}
+	return nil
+}
+
+func (x *MetadataValue) GetStringValue() string {
+	if x != nil {
+		if x, ok := x.Kind.(*MetadataValue_StringValue); ok {
+			return x.StringValue
+		}
+	}
+	return ""
+}
+
+func (x *MetadataValue) GetIntValue() int64 {
+	if x != nil {
+		if x, ok := x.Kind.(*MetadataValue_IntValue); ok {
+			return x.IntValue
+		}
+	}
+	return 0
+}
+
+func (x *MetadataValue) GetFloatValue() float64 {
+	if x != nil {
+		if x, ok := x.Kind.(*MetadataValue_FloatValue); ok {
+			return x.FloatValue
+		}
+	}
+	return 0
+}
+
+func (x *MetadataValue) GetBoolValue() bool {
+	if x != nil {
+		if x, ok := x.Kind.(*MetadataValue_BoolValue); ok {
+			return x.BoolValue
+		}
+	}
+	return false
+}
+
+func (x *MetadataValue) GetTimestamp() string {
+	if x != nil {
+		if x, ok := x.Kind.(*MetadataValue_Timestamp); ok {
+			return x.Timestamp
+		}
+	}
+	return ""
+}
+
+func (x *MetadataValue) GetListValue() *StringList {
+	if x != nil {
+		if x, ok := x.Kind.(*MetadataValue_ListValue); ok {
+			return x.ListValue
+		}
+	}
+	return nil
+}
+
+type isMetadataValue_Kind interface {
+	isMetadataValue_Kind()
+}
+
+type MetadataValue_StringValue struct {
+	StringValue string `protobuf:"bytes,1,opt,name=string_value,json=stringValue,proto3,oneof"`
+}
+
+type MetadataValue_IntValue struct {
+	IntValue int64 `protobuf:"varint,2,opt,name=int_value,json=intValue,proto3,oneof"`
+}
+
+type MetadataValue_FloatValue struct {
+	FloatValue float64 `protobuf:"fixed64,3,opt,name=float_value,json=floatValue,proto3,oneof"`
+}
+
+type MetadataValue_BoolValue struct {
+	BoolValue bool `protobuf:"varint,4,opt,name=bool_value,json=boolValue,proto3,oneof"`
+}
+
+type MetadataValue_Timestamp struct {
+	Timestamp string `protobuf:"bytes,5,opt,name=timestamp,proto3,oneof"`
+}
+
+type MetadataValue_ListValue struct {
+	ListValue *StringList `protobuf:"bytes,6,opt,name=list_value,json=listValue,proto3,oneof"`
+}
+
+func (*MetadataValue_StringValue) isMetadataValue_Kind() {}
+
+func (*MetadataValue_IntValue) isMetadataValue_Kind() {}
+
+func (*MetadataValue_FloatValue) isMetadataValue_Kind() {}
+
+func (*MetadataValue_BoolValue) isMetadataValue_Kind() {}
+
+func (*MetadataValue_Timestamp) isMetadataValue_Kind() {}
+
+func (*MetadataValue_ListValue) isMetadataValue_Kind() {}
+
+type StringList struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Values        []string               `protobuf:"bytes,1,rep,name=values,proto3" json:"values,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *StringList) Reset() {
+	*x = StringList{}
+	mi := &file_replication_proto_msgTypes[2]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *StringList) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*StringList) ProtoMessage() {}
+
+func (x *StringList) ProtoReflect() protoreflect.Message {
+	mi := &file_replication_proto_msgTypes[2]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use StringList.ProtoReflect.Descriptor instead.
+func (*StringList) Descriptor() ([]byte, []int) {
+	return file_replication_proto_rawDescGZIP(), []int{2}
+}
+
+func (x *StringList) GetValues() []string {
+	if x != nil {
+		return x.Values
+	}
+	return nil
+}
+
 type ReplicateRequest struct {
 	state         protoimpl.MessageState `protogen:"open.v1"`
 	Record        *WALRecord             `protobuf:"bytes,1,opt,name=record,proto3" json:"record,omitempty"`
@@ -98,7 +304,7 @@ type ReplicateRequest struct {
 
 func (x *ReplicateRequest) Reset() {
 	*x = ReplicateRequest{}
-	mi := &file_replication_proto_msgTypes[1]
+	mi := &file_replication_proto_msgTypes[3]
 	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 	ms.StoreMessageInfo(mi)
 }
@@ -110,7 +316,7 @@ func (x *ReplicateRequest) String() string {
 func (*ReplicateRequest) ProtoMessage() {}
 
 func (x *ReplicateRequest) ProtoReflect() protoreflect.Message {
-	mi := &file_replication_proto_msgTypes[1]
+	mi := &file_replication_proto_msgTypes[3]
 	if x != nil {
 		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 		if ms.LoadMessageInfo() == nil {
@@ -123,7 +329,7 @@ func (x *ReplicateRequest) ProtoReflect() protoreflect.Message {
 
 // Deprecated: Use ReplicateRequest.ProtoReflect.Descriptor instead.
 func (*ReplicateRequest) Descriptor() ([]byte, []int) {
-	return file_replication_proto_rawDescGZIP(), []int{1}
+	return file_replication_proto_rawDescGZIP(), []int{3}
 }
 
 func (x *ReplicateRequest) GetRecord() *WALRecord {
@@ -142,7 +348,7 @@ type ReplicateResponse struct {
 
 func (x *ReplicateResponse) Reset() {
 	*x = ReplicateResponse{}
-	mi := &file_replication_proto_msgTypes[2]
+	mi := &file_replication_proto_msgTypes[4]
 	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 	ms.StoreMessageInfo(mi)
 }
@@ -154,7 +360,7 @@ func (x *ReplicateResponse) String() string {
 func (*ReplicateResponse) ProtoMessage() {}
 
 func (x *ReplicateResponse) ProtoReflect() protoreflect.Message {
-	mi := &file_replication_proto_msgTypes[2]
+	mi := &file_replication_proto_msgTypes[4]
 	if x != nil {
 		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 		if ms.LoadMessageInfo() == nil {
@@ -167,7 +373,7 @@ func (x *ReplicateResponse) ProtoReflect() protoreflect.Message {
 
 // Deprecated: Use ReplicateResponse.ProtoReflect.Descriptor instead.
 func (*ReplicateResponse) Descriptor() ([]byte, []int) {
-	return file_replication_proto_rawDescGZIP(), []int{2}
+	return file_replication_proto_rawDescGZIP(), []int{4}
 }
 
 func (x *ReplicateResponse) GetSuccess() bool {
@@ -185,7 +391,7 @@ type HeartbeatRequest struct {
 
 func (x *HeartbeatRequest) Reset() {
 	*x = HeartbeatRequest{}
-	mi := &file_replication_proto_msgTypes[3]
+	mi := &file_replication_proto_msgTypes[5]
 	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 	ms.StoreMessageInfo(mi)
 }
@@ -197,7 +403,7 @@ func (x *HeartbeatRequest) String() string {
 func (*HeartbeatRequest) ProtoMessage() {}
 
 func (x *HeartbeatRequest) ProtoReflect() protoreflect.Message {
-	mi := &file_replication_proto_msgTypes[3]
+	mi := &file_replication_proto_msgTypes[5]
 	if x != nil {
 		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 		if ms.LoadMessageInfo() == nil {
@@ -210,7 +416,7 @@ func (x *HeartbeatRequest) ProtoReflect() protoreflect.Message {
 
 // Deprecated: Use HeartbeatRequest.ProtoReflect.Descriptor instead.
 func (*HeartbeatRequest) Descriptor() ([]byte, []int) {
-	return file_replication_proto_rawDescGZIP(), []int{3}
+	return file_replication_proto_rawDescGZIP(), []int{5}
 }
 
 type HeartbeatResponse struct {
@@ -221,7 +427,7 @@ type HeartbeatResponse struct {
 
 func (x *HeartbeatResponse) Reset() {
 	*x = HeartbeatResponse{}
-	mi := &file_replication_proto_msgTypes[4]
+	mi := &file_replication_proto_msgTypes[6]
 	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 	ms.StoreMessageInfo(mi)
 }
@@ -233,7 +439,7 @@ func (x *HeartbeatResponse) String() string {
 func (*HeartbeatResponse) ProtoMessage() {}
 
 func (x *HeartbeatResponse) ProtoReflect() protoreflect.Message {
-	mi := &file_replication_proto_msgTypes[4]
+	mi := &file_replication_proto_msgTypes[6]
 	if x != nil {
 		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 		if ms.LoadMessageInfo() == nil {
@@ -246,22 +452,41 @@ func (x *HeartbeatResponse) ProtoReflect() protoreflect.Message {
 
 // Deprecated: Use HeartbeatResponse.ProtoReflect.Descriptor instead.
 func (*HeartbeatResponse) Descriptor() ([]byte, []int) {
-	return file_replication_proto_rawDescGZIP(), []int{4}
+	return file_replication_proto_rawDescGZIP(), []int{6}
 }
 
 var File_replication_proto protoreflect.FileDescriptor
 
 const file_replication_proto_rawDesc = "" +
 	"\n" +
-	"\x11replication.proto\x12\vreplication\"\xc2\x01\n" +
+	"\x11replication.proto\x12\vreplication\"\x86\x03\n" +
 	"\tWALRecord\x12\x0e\n" +
 	"\x02op\x18\x01 \x01(\rR\x02op\x12\x10\n" +
 	"\x03key\x18\x02 \x01(\tR\x03key\x12\x14\n" +
 	"\x05value\x18\x03 \x01(\fR\x05value\x12@\n" +
-	"\bmetadata\x18\x04 \x03(\v2$.replication.WALRecord.MetadataEntryR\bmetadata\x1a;\n" +
+	"\bmetadata\x18\x04 \x03(\v2$.replication.WALRecord.MetadataEntryR\bmetadata\x12P\n" +
+	"\x0etyped_metadata\x18\x05 \x03(\v2).replication.WALRecord.TypedMetadataEntryR\rtypedMetadata\x12\x12\n" +
+	"\x04text\x18\x06 \x01(\tR\x04text\x1a;\n" +
 	"\rMetadataEntry\x12\x10\n" +
 	"\x03key\x18\x01 \x01(\tR\x03key\x12\x14\n" +
-	"\x05value\x18\x02 \x01(\tR\x05value:\x028\x01\"B\n" +
+	"\x05value\x18\x02 \x01(\tR\x05value:\x028\x01\x1a\\\n" +
+	"\x12TypedMetadataEntry\x12\x10\n" +
+	"\x03key\x18\x01 \x01(\tR\x03key\x120\n" +
+	"\x05value\x18\x02 \x01(\v2\x1a.replication.MetadataValueR\x05value:\x028\x01\"\xf9\x01\n" +
+	"\rMetadataValue\x12#\n" +
+	"\fstring_value\x18\x01 \x01(\tH\x00R\vstringValue\x12\x1d\n" +
+	"\tint_value\x18\x02 \x01(\x03H\x00R\bintValue\x12!\n" +
+	"\vfloat_value\x18\x03 \x01(\x01H\x00R\n" +
+	"floatValue\x12\x1f\n" +
+	"\n" +
+	"bool_value\x18\x04 \x01(\bH\x00R\tboolValue\x12\x1e\n" +
+	"\ttimestamp\x18\x05 \x01(\tH\x00R\ttimestamp\x128\n" +
+	"\n" +
+	"list_value\x18\x06 \x01(\v2\x17.replication.StringListH\x00R\tlistValueB\x06\n" +
+	"\x04kind\"$\n" +
+	"\n" +
+	"StringList\x12\x16\n" +
+	"\x06values\x18\x01 \x03(\tR\x06values\"B\n" +
 	"\x10ReplicateRequest\x12.\n" +
 	"\x06record\x18\x01 \x01(\v2\x16.replication.WALRecordR\x06record\"-\n" +
 	"\x11ReplicateResponse\x12\x18\n" +
@@ -284,27 +509,33 @@ func file_replication_proto_rawDescGZIP() []byte {
 	return file_replication_proto_rawDescData
 }
 
-var file_replication_proto_msgTypes = make([]protoimpl.MessageInfo, 6)
+var file_replication_proto_msgTypes = make([]protoimpl.MessageInfo, 9)
 var file_replication_proto_goTypes = []any{
 	(*WALRecord)(nil),         // 0: replication.WALRecord
-	(*ReplicateRequest)(nil),  // 1: replication.ReplicateRequest
-	(*ReplicateResponse)(nil), // 2: replication.ReplicateResponse
-	(*HeartbeatRequest)(nil),  // 3: replication.HeartbeatRequest
-	(*HeartbeatResponse)(nil), // 4: replication.HeartbeatResponse
-	nil,                       // 5: replication.WALRecord.MetadataEntry
+	(*MetadataValue)(nil),     // 1: replication.MetadataValue
+	(*StringList)(nil),        // 2: replication.StringList
+	(*ReplicateRequest)(nil),  // 3: replication.ReplicateRequest
+	(*ReplicateResponse)(nil), // 4: replication.ReplicateResponse
+	(*HeartbeatRequest)(nil),  // 5: replication.HeartbeatRequest
+	(*HeartbeatResponse)(nil), // 6: replication.HeartbeatResponse
+	nil,                       // 7: replication.WALRecord.MetadataEntry
+	nil,                       // 8: replication.WALRecord.TypedMetadataEntry
 }
 var file_replication_proto_depIdxs = []int32{
-	5, // 0: replication.WALRecord.metadata:type_name -> replication.WALRecord.MetadataEntry
-	0, // 1: replication.ReplicateRequest.record:type_name -> replication.WALRecord
-	1, // 2: replication.ReplicationService.Replicate:input_type -> replication.ReplicateRequest
-	3, // 3: replication.ReplicationService.Heartbeat:input_type -> replication.HeartbeatRequest
-	2, // 4: replication.ReplicationService.Replicate:output_type -> replication.ReplicateResponse
-	4, // 5: replication.ReplicationService.Heartbeat:output_type -> replication.HeartbeatResponse
-	4, // [4:6] is the sub-list for method output_type
-	2, // [2:4] is the sub-list for method input_type
-	2, // [2:2] is the sub-list for extension type_name
-	2, // [2:2] is the sub-list for extension extendee
-	0, // [0:2] is the sub-list for field type_name
+	7, // 0: replication.WALRecord.metadata:type_name -> replication.WALRecord.MetadataEntry
+	8, // 1: replication.WALRecord.typed_metadata:type_name -> replication.WALRecord.TypedMetadataEntry
+	2, // 2: replication.MetadataValue.list_value:type_name -> replication.StringList
+	0, // 3: replication.ReplicateRequest.record:type_name -> replication.WALRecord
+	1, // 4: replication.WALRecord.TypedMetadataEntry.value:type_name -> replication.MetadataValue
+	3, // 5: replication.ReplicationService.Replicate:input_type -> replication.ReplicateRequest
+	5, // 6: replication.ReplicationService.Heartbeat:input_type -> replication.HeartbeatRequest
+	4, // 7: replication.ReplicationService.Replicate:output_type -> replication.ReplicateResponse
+	6, // 8: replication.ReplicationService.Heartbeat:output_type -> replication.HeartbeatResponse
+	7, // [7:9] is the sub-list for method output_type
+	5, // [5:7] is the sub-list for method input_type
+	5, // [5:5] is the sub-list for extension type_name
+	5, // [5:5] is the sub-list for extension extendee
+	0, // [0:5] is the sub-list for field type_name
 }
 
 func init() { file_replication_proto_init() }
@@ -312,13 +543,21 @@ func file_replication_proto_init() {
 	if File_replication_proto != nil {
 		return
 	}
+	file_replication_proto_msgTypes[1].OneofWrappers = []any{
+		(*MetadataValue_StringValue)(nil),
+		(*MetadataValue_IntValue)(nil),
+		(*MetadataValue_FloatValue)(nil),
+		(*MetadataValue_BoolValue)(nil),
+		(*MetadataValue_Timestamp)(nil),
+		(*MetadataValue_ListValue)(nil),
+	}
 	type x struct{}
 	out := protoimpl.TypeBuilder{
 		File: protoimpl.DescBuilder{
 			GoPackagePath: reflect.TypeOf(x{}).PkgPath(),
 			RawDescriptor: unsafe.Slice(unsafe.StringData(file_replication_proto_rawDesc), len(file_replication_proto_rawDesc)),
 			NumEnums:      0,
-			NumMessages:   6,
+			NumMessages:   9,
 			NumExtensions: 0,
 			NumServices:   1,
 		},
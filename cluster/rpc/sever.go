@@ -2,12 +2,13 @@ package rpc
 
 import (
 	"context"
+	"flashvector/metadata"
 	// "flashvector/cluster"
 )
 
 // Define an interface for the operations the server needs to perform on the Node.
 type ReplicaHandler interface {
-	ApplySet(key string, value []byte)
+	ApplySet(key string, value []byte, meta metadata.Map, text string)
 	ApplyDelete(key string)
 	RecordHeartbeat()
 }
@@ -22,7 +23,7 @@ func (s *ReplicationServer) Replicate(ctx context.Context,req *ReplicateRequest)
 
 	switch rec.Op{
 	case 1:
-		s.Node.ApplySet(rec.Key,rec.Value)
+		s.Node.ApplySet(rec.Key,rec.Value,DecodeMetadata(rec),rec.Text)
 		
 	case 2:
 	    s.Node.ApplyDelete(rec.Key)
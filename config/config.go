@@ -4,6 +4,7 @@ package config
 import (
 	"encoding/json"
 	"os"
+	"strconv"
 )
 
 type Config struct{
@@ -19,6 +20,24 @@ type Config struct{
 	EnableMetrics bool
 
 	SnapshotIntervalSeconds int
+
+	// Dimension is the vector length the store accepts; 0 takes it from the first insert
+	Dimension int
+
+	// WALSync is the WAL durability mode: "always", "group" or "periodic" (default)
+	WALSync string
+	// WALGroupCommitMs is how long group commit waits for other writers
+	WALGroupCommitMs int
+	// WALSyncIntervalMs is how often periodic mode fsyncs
+	WALSyncIntervalMs int
+
+	// TextLanguage picks the stopwords and stemmer for keyword search:
+	// "english", "german" or "" for none
+	TextLanguage string
+	// BM25K1 and BM25B tune keyword scoring. A zero K1 or absent B keeps
+	// the default; B may be 0 to turn off length normalization.
+	BM25K1 float64
+	BM25B *float64
 }
 
 func LoadFromFile(path string)(*Config,error){
@@ -50,4 +69,15 @@ func (c *Config) ApplyEnvOverrides() {
 	if v := os.Getenv("LISTEN_ADDR"); v != "" {
 		c.ListenAddr = v
 	}
+	if v := os.Getenv("DIMENSION"); v != "" {
+		if dim, err := strconv.Atoi(v); err == nil {
+			c.Dimension = dim
+		}
+	}
+	if v := os.Getenv("WAL_SYNC"); v != "" {
+		c.WALSync = v
+	}
+	if v := os.Getenv("TEXT_LANGUAGE"); v != "" {
+		c.TextLanguage = v
+	}
 }
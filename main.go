@@ -2,9 +2,14 @@ package main
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"io/fs"
 	"log"
+	"time"
 
+	"flashvector/analysis"
+	"flashvector/config"
 	shutdown "flashvector/internal"
 	"flashvector/server" // <-- ADDED: Import the new server package
 	"flashvector/storage"
@@ -18,23 +23,71 @@ func main() {
 	rootCtx := context.Background()
 	ctx := shutdown.WithSignals(rootCtx)
 
-	// 2. Open or Create WAL file
-	w, err := wal.Open("data.wal")
+	// Optional config file; environment variables override it. Only a
+	// missing file falls back to the defaults, a broken one is fatal.
+	cfg, err := config.LoadFromFile("config.json")
+	if errors.Is(err, fs.ErrNotExist) {
+		cfg = &config.Config{}
+	} else if err != nil {
+		log.Fatalf("Failed to load config.json: %v", err)
+	}
+	cfg.ApplyEnvOverrides()
+
+	// 2. Lock the data directory, then open or create the WAL inside it
+	dataDir, err := storage.OpenDataDir(cfg.DataDir, cfg.NodeId)
+	if err != nil {
+		log.Fatalf("Failed to open data directory: %v", err)
+	}
+	defer dataDir.Close()
+
+	syncMode, err := wal.ParseSyncMode(cfg.WALSync)
+	if err != nil {
+		log.Fatalf("Invalid config: %v", err)
+	}
+
+	walOpts := wal.Options{
+		Sync:              syncMode,
+		GroupCommitWindow: time.Duration(cfg.WALGroupCommitMs) * time.Millisecond,
+		SyncInterval:      time.Duration(cfg.WALSyncIntervalMs) * time.Millisecond,
+	}
+
+	w, err := wal.OpenWithOptions(dataDir.WALPath(), walOpts)
 	if err != nil {
 		log.Fatalf("Failed to open WAL: %v", err)
 	}
 	// Note: We don't defer w.Close() here anymore because store.Close() will handle it!
 
 	// 3. Create a new Store (This automatically replays the WAL!)
-	store, err := storage.NewStore(ctx, w)
+	analyzer, err := analysis.New(analysis.Config{Language: cfg.TextLanguage})
+	if err != nil {
+		log.Fatalf("Invalid config: %v", err)
+	}
+
+	store, err := storage.NewStoreWithOptions(ctx, w, storage.Options{
+		Dimension:        cfg.Dimension,
+		Analyzer:         analyzer,
+		BM25:             storage.BM25Params{K1: cfg.BM25K1, B: cfg.BM25B},
+		SnapshotPath:     dataDir.SnapshotPath(),
+		SnapshotInterval: time.Duration(cfg.SnapshotIntervalSeconds) * time.Second,
+	})
 	if err != nil {
 		log.Fatalf("Failed to initialize storage: %v", err)
 	}
 
 	// --- WE DELETED THE "greeting" TEST CODE HERE ---
 
+	// Named collections each keep their own WAL and snapshot under DataDir
+	// with the same durability and checkpointing as the default store
+	catalog, err := storage.OpenCatalogWithOptions(ctx, dataDir.CollectionsPath(), storage.CatalogOptions{
+		WAL:              walOpts,
+		SnapshotInterval: time.Duration(cfg.SnapshotIntervalSeconds) * time.Second,
+	})
+	if err != nil {
+		log.Fatalf("Failed to open collections: %v", err)
+	}
+
 	// 4. Initialize the API Server
-	api := server.NewAPI(store)
+	api := server.NewAPIWithCatalog(store, catalog)
 
 	// 5. Start the Web Server in a background Goroutine (so it doesn't block Ctrl+C)
 	port := "8080"
@@ -55,6 +108,9 @@ func main() {
 	if err := store.Close(); err != nil {
 		fmt.Printf("Error closing store: %v\n", err)
 	}
+	if err := catalog.Close(); err != nil {
+		fmt.Printf("Error closing collections: %v\n", err)
+	}
 
 	fmt.Println("Shutdown complete. All data secured in WAL.")
 }
\ No newline at end of file
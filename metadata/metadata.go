@@ -0,0 +1,459 @@
+// Package metadata holds the typed values documents carry next to their
+// vector and text, and the schemas collections check them against.
+package metadata
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Type is the type of a metadata value
+type Type uint8
+
+const (
+	String Type = iota
+	Int
+	Float
+	Bool
+	Timestamp
+	StringList
+)
+
+var typeNames = []string{"string", "int", "float", "bool", "timestamp", "string_list"}
+
+func (t Type) String() string {
+	if int(t) < len(typeNames) {
+		return typeNames[t]
+	}
+	return fmt.Sprintf("Type(%d)", t)
+}
+
+// ParseType parses a type name as String returns it
+func ParseType(name string) (Type, error) {
+	for i, n := range typeNames {
+		if strings.EqualFold(name, n) {
+			return Type(i), nil
+		}
+	}
+	return 0, fmt.Errorf("unknown metadata type %q", name)
+}
+
+func (t Type) MarshalText() ([]byte, error) {
+	return []byte(t.String()), nil
+}
+
+func (t *Type) UnmarshalText(text []byte) error {
+	parsed, err := ParseType(string(text))
+	if err != nil {
+		return err
+	}
+	*t = parsed
+	return nil
+}
+
+// Value is one typed metadata value. Only the field matching Type is set;
+// the zero Value is the empty string.
+type Value struct {
+	Type  Type
+	Str   string
+	Int   int64
+	Float float64
+	Bool  bool
+	Time  time.Time
+	List  []string
+}
+
+func StringValue(s string) Value  { return Value{Type: String, Str: s} }
+func IntValue(n int64) Value      { return Value{Type: Int, Int: n} }
+func FloatValue(f float64) Value  { return Value{Type: Float, Float: f} }
+func BoolValue(b bool) Value      { return Value{Type: Bool, Bool: b} }
+func ListValue(s ...string) Value { return Value{Type: StringList, List: s} }
+
+// TimeValue stores t in UTC, so equal instants encode the same everywhere
+func TimeValue(t time.Time) Value { return Value{Type: Timestamp, Time: t.UTC()} }
+
+// String is the value as text: timestamps in RFC 3339, lists joined with
+// commas. It is what the value looks like where only strings fit, such as
+// replicas that predate typed metadata.
+func (v Value) String() string {
+	switch v.Type {
+	case Int:
+		return strconv.FormatInt(v.Int, 10)
+	case Float:
+		return strconv.FormatFloat(v.Float, 'g', -1, 64)
+	case Bool:
+		return strconv.FormatBool(v.Bool)
+	case Timestamp:
+		return v.Time.Format(time.RFC3339Nano)
+	case StringList:
+		return strings.Join(v.List, ",")
+	}
+	return v.Str
+}
+
+// Number returns an int or float value as a float64
+func (v Value) Number() (float64, bool) {
+	switch v.Type {
+	case Int:
+		return float64(v.Int), true
+	case Float:
+		return v.Float, true
+	}
+	return 0, false
+}
+
+// Equal reports whether two values have the same type and contents
+func (v Value) Equal(o Value) bool {
+	return Compare(v, o) == 0 && v.Type == o.Type
+}
+
+// Compare orders two values for sorting. Ints and floats compare by
+// number; other values of different types order by type.
+func Compare(a, b Value) int {
+	if a.Type == Int && b.Type == Int {
+		return cmpOrdered(a.Int, b.Int)
+	}
+	if x, ok := a.Number(); ok {
+		if y, ok := b.Number(); ok {
+			return cmpOrdered(x, y)
+		}
+	}
+	if a.Type != b.Type {
+		return cmpOrdered(a.Type, b.Type)
+	}
+
+	switch a.Type {
+	case Bool:
+		switch {
+		case a.Bool == b.Bool:
+			return 0
+		case !a.Bool:
+			return -1
+		}
+		return 1
+	case Timestamp:
+		return a.Time.Compare(b.Time)
+	case StringList:
+		return slices.Compare(a.List, b.List)
+	}
+	return strings.Compare(a.Str, b.Str)
+}
+
+func cmpOrdered[T int64 | float64 | Type](a, b T) int {
+	switch {
+	case a < b:
+		return -1
+	case a > b:
+		return 1
+	}
+	return 0
+}
+
+// MarshalJSON writes the natural JSON form: strings, numbers, booleans,
+// timestamps as RFC 3339 strings and lists as arrays
+func (v Value) MarshalJSON() ([]byte, error) {
+	switch v.Type {
+	case Int:
+		return json.Marshal(v.Int)
+	case Float:
+		return json.Marshal(v.Float)
+	case Bool:
+		return json.Marshal(v.Bool)
+	case Timestamp:
+		return json.Marshal(v.Time.Format(time.RFC3339Nano))
+	case StringList:
+		if v.List == nil {
+			return []byte("[]"), nil
+		}
+		return json.Marshal(v.List)
+	}
+	return json.Marshal(v.Str)
+}
+
+// UnmarshalJSON infers the type from the JSON: whole numbers are ints,
+// other numbers floats, arrays string lists. Strings stay strings; a
+// schema turns them into timestamps.
+func (v *Value) UnmarshalJSON(data []byte) error {
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+
+	var raw any
+	if err := dec.Decode(&raw); err != nil {
+		return err
+	}
+
+	switch raw := raw.(type) {
+	case string:
+		*v = StringValue(raw)
+	case bool:
+		*v = BoolValue(raw)
+	case json.Number:
+		if n, err := strconv.ParseInt(raw.String(), 10, 64); err == nil {
+			*v = IntValue(n)
+			return nil
+		}
+		f, err := raw.Float64()
+		if err != nil {
+			return fmt.Errorf("metadata number %s: %w", raw, err)
+		}
+		*v = FloatValue(f)
+	case []any:
+		list := make([]string, len(raw))
+		for i, item := range raw {
+			s, ok := item.(string)
+			if !ok {
+				return errors.New("metadata lists may only hold strings")
+			}
+			list[i] = s
+		}
+		*v = ListValue(list...)
+	default:
+		return errors.New("metadata values must be strings, numbers, booleans or lists of strings")
+	}
+
+	return nil
+}
+
+// MarshalBinary encodes the value as its type byte and contents. It is
+// the form the WAL and snapshots store.
+func (v Value) MarshalBinary() ([]byte, error) {
+	b := []byte{byte(v.Type)}
+
+	switch v.Type {
+	case String:
+		b = append(b, v.Str...)
+	case Int:
+		b = binary.AppendVarint(b, v.Int)
+	case Float:
+		b = binary.LittleEndian.AppendUint64(b, math.Float64bits(v.Float))
+	case Bool:
+		if v.Bool {
+			b = append(b, 1)
+		} else {
+			b = append(b, 0)
+		}
+	case Timestamp:
+		t, err := v.Time.MarshalBinary()
+		if err != nil {
+			return nil, err
+		}
+		b = append(b, t...)
+	case StringList:
+		b = binary.AppendUvarint(b, uint64(len(v.List)))
+		for _, s := range v.List {
+			b = binary.AppendUvarint(b, uint64(len(s)))
+			b = append(b, s...)
+		}
+	default:
+		return nil, fmt.Errorf("cannot encode metadata type %d", v.Type)
+	}
+
+	return b, nil
+}
+
+var errCorrupt = errors.New("corrupt metadata value")
+
+func (v *Value) UnmarshalBinary(b []byte) error {
+	if len(b) == 0 {
+		return errCorrupt
+	}
+
+	out := Value{Type: Type(b[0])}
+	b = b[1:]
+
+	switch out.Type {
+	case String:
+		out.Str = string(b)
+	case Int:
+		n, size := binary.Varint(b)
+		if size <= 0 || size != len(b) {
+			return errCorrupt
+		}
+		out.Int = n
+	case Float:
+		if len(b) != 8 {
+			return errCorrupt
+		}
+		out.Float = math.Float64frombits(binary.LittleEndian.Uint64(b))
+	case Bool:
+		if len(b) != 1 {
+			return errCorrupt
+		}
+		out.Bool = b[0] == 1
+	case Timestamp:
+		if err := out.Time.UnmarshalBinary(b); err != nil {
+			return errCorrupt
+		}
+	case StringList:
+		count, size := binary.Uvarint(b)
+		if size <= 0 || count > uint64(len(b)) {
+			return errCorrupt
+		}
+		b = b[size:]
+		out.List = make([]string, count)
+		for i := range out.List {
+			n, size := binary.Uvarint(b)
+			if size <= 0 || uint64(len(b)-size) < n {
+				return errCorrupt
+			}
+			out.List[i] = string(b[size : size+int(n)])
+			b = b[size+int(n):]
+		}
+		if len(b) != 0 {
+			return errCorrupt
+		}
+	default:
+		return errCorrupt
+	}
+
+	*v = out
+	return nil
+}
+
+// Map is a document's metadata by field name
+type Map map[string]Value
+
+// UnmarshalJSON decodes an object of values, see Value.UnmarshalJSON. A
+// null value is a field the document does not have and is left out.
+func (m *Map) UnmarshalJSON(data []byte) error {
+	var raw map[string]json.RawMessage
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return err
+	}
+	if raw == nil {
+		return nil
+	}
+
+	if *m == nil {
+		*m = make(Map, len(raw))
+	}
+	for k, data := range raw {
+		if string(data) == "null" {
+			continue
+		}
+		var v Value
+		if err := v.UnmarshalJSON(data); err != nil {
+			return err
+		}
+		(*m)[k] = v
+	}
+
+	return nil
+}
+
+// Strings converts untyped metadata, every value a string
+func Strings(m map[string]string) Map {
+	if m == nil {
+		return nil
+	}
+	out := make(Map, len(m))
+	for k, v := range m {
+		out[k] = StringValue(v)
+	}
+	return out
+}
+
+// Strings returns every value as text; see Value.String
+func (m Map) Strings() map[string]string {
+	if m == nil {
+		return nil
+	}
+	out := make(map[string]string, len(m))
+	for k, v := range m {
+		out[k] = v.String()
+	}
+	return out
+}
+
+// Clone copies the map and its lists
+func (m Map) Clone() Map {
+	if m == nil {
+		return nil
+	}
+	out := make(Map, len(m))
+	for k, v := range m {
+		v.List = slices.Clone(v.List)
+		out[k] = v
+	}
+	return out
+}
+
+// ErrSchema is wrapped by every error a schema check returns
+var ErrSchema = errors.New("metadata does not match the schema")
+
+// Schema declares the type of metadata fields. Fields it does not name
+// may hold values of any type.
+type Schema map[string]Type
+
+// Check validates m against the schema and returns it with values
+// converted where the JSON form is ambiguous: whole numbers for float
+// fields, integral floats for int fields and RFC 3339 strings or
+// YYYY-MM-DD dates for timestamp fields. m itself is not modified.
+func (s Schema) Check(m Map) (Map, error) {
+	if len(s) == 0 || len(m) == 0 {
+		return m, nil
+	}
+
+	var out Map
+	for field, v := range m {
+		want, ok := s[field]
+		if !ok || v.Type == want {
+			continue
+		}
+
+		converted, ok := convert(v, want)
+		if !ok {
+			return nil, fmt.Errorf("%w: field %q is %s, got %s %q", ErrSchema, field, want, v.Type, v.String())
+		}
+
+		if out == nil {
+			out = make(Map, len(m))
+			for k, v := range m {
+				out[k] = v
+			}
+		}
+		out[field] = converted
+	}
+
+	if out == nil {
+		return m, nil
+	}
+	return out, nil
+}
+
+func convert(v Value, to Type) (Value, bool) {
+	switch {
+	case to == Float && v.Type == Int:
+		return FloatValue(float64(v.Int)), true
+	case to == Int && v.Type == Float:
+		if v.Float != math.Trunc(v.Float) || math.Abs(v.Float) >= 1<<63 {
+			return Value{}, false
+		}
+		return IntValue(int64(v.Float)), true
+	case to == Timestamp && v.Type == String:
+		t, ok := ParseTime(v.Str)
+		if !ok {
+			return Value{}, false
+		}
+		return TimeValue(t), true
+	}
+	return Value{}, false
+}
+
+// ParseTime accepts RFC 3339 timestamps and plain YYYY-MM-DD dates
+func ParseTime(s string) (time.Time, bool) {
+	for _, layout := range []string{time.RFC3339Nano, time.DateOnly} {
+		if t, err := time.Parse(layout, s); err == nil {
+			return t, true
+		}
+	}
+	return time.Time{}, false
+}
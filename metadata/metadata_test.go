@@ -0,0 +1,164 @@
+package metadata
+
+import (
+	"encoding/json"
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestJSONInfersTypes(t *testing.T) {
+	var m Map
+	err := json.Unmarshal([]byte(`{"lang":"en","stock":3,"price":9.5,"open":true,"tags":["a","b"],"big":1e3}`), &m)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := Map{
+		"lang":  StringValue("en"),
+		"stock": IntValue(3),
+		"price": FloatValue(9.5),
+		"open":  BoolValue(true),
+		"tags":  ListValue("a", "b"),
+		"big":   FloatValue(1000),
+	}
+	if !reflect.DeepEqual(m, want) {
+		t.Fatalf("got %v, want %v", m, want)
+	}
+
+	out, err := json.Marshal(m)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var again Map
+	if err := json.Unmarshal(out, &again); err != nil {
+		t.Fatal(err)
+	}
+	// 1000 writes as a whole number and reads back as an int
+	want["big"] = IntValue(1000)
+	if !reflect.DeepEqual(again, want) {
+		t.Fatalf("got %v after a round trip, want %v", again, want)
+	}
+
+	for _, bad := range []string{`{"x":{"y":1}}`, `{"x":[1]}`, `{"x":[null]}`} {
+		if err := json.Unmarshal([]byte(bad), &m); err == nil {
+			t.Errorf("expected %s to be rejected", bad)
+		}
+	}
+}
+
+func TestJSONNullIsAnAbsentField(t *testing.T) {
+	var m Map
+	if err := json.Unmarshal([]byte(`{"lang":"en","price":null}`), &m); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := m["price"]; ok || !reflect.DeepEqual(m, Map{"lang": StringValue("en")}) {
+		t.Fatalf("expected price to be left out, got %v", m)
+	}
+
+	var none Map
+	if err := json.Unmarshal([]byte(`null`), &none); err != nil || none != nil {
+		t.Fatalf("expected a null map to stay nil, got %v (%v)", none, err)
+	}
+
+	// a typed field set to null is simply not there to check
+	if _, err := (Schema{"price": Float}).Check(m); err != nil {
+		t.Fatalf("expected a null typed field to pass the schema, got %v", err)
+	}
+}
+
+func TestBinaryRoundTrip(t *testing.T) {
+	values := []Value{
+		StringValue(""),
+		StringValue("héllo"),
+		IntValue(-1 << 40),
+		FloatValue(-0.25),
+		BoolValue(true),
+		BoolValue(false),
+		TimeValue(time.Date(2024, 3, 1, 12, 0, 0, 7, time.FixedZone("x", 3600))),
+		ListValue(),
+		ListValue("a", "", "c"),
+	}
+
+	for _, v := range values {
+		b, err := v.MarshalBinary()
+		if err != nil {
+			t.Fatal(err)
+		}
+		var got Value
+		if err := got.UnmarshalBinary(b); err != nil {
+			t.Fatalf("%v: %v", v, err)
+		}
+		if !got.Equal(v) {
+			t.Errorf("got %v, want %v", got, v)
+		}
+	}
+
+	for _, bad := range [][]byte{nil, {byte(Float), 1}, {byte(StringList), 2, 1, 'a'}, {99}} {
+		var v Value
+		if err := v.UnmarshalBinary(bad); err == nil {
+			t.Errorf("expected %v to be rejected", bad)
+		}
+	}
+}
+
+func TestCompare(t *testing.T) {
+	if Compare(IntValue(10), FloatValue(9.5)) <= 0 {
+		t.Error("expected 10 > 9.5")
+	}
+	if Compare(IntValue(2), IntValue(2)) != 0 || IntValue(2).Equal(FloatValue(2)) {
+		t.Error("ints and floats compare by number but are not equal")
+	}
+	if Compare(StringValue("10"), StringValue("9")) >= 0 {
+		t.Error("strings compare as text")
+	}
+	early, late := TimeValue(time.Unix(0, 0)), TimeValue(time.Unix(1, 0))
+	if Compare(early, late) >= 0 {
+		t.Error("expected times in order")
+	}
+}
+
+func TestSchemaCheck(t *testing.T) {
+	s := Schema{"price": Float, "stock": Int, "at": Timestamp, "tags": StringList}
+
+	in := Map{"price": IntValue(3), "stock": FloatValue(4), "at": StringValue("2024-03-01"), "other": BoolValue(true)}
+	out, err := s.Check(in)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := Map{
+		"price": FloatValue(3),
+		"stock": IntValue(4),
+		"at":    TimeValue(time.Date(2024, 3, 1, 0, 0, 0, 0, time.UTC)),
+		"other": BoolValue(true),
+	}
+	if !reflect.DeepEqual(out, want) {
+		t.Fatalf("got %v, want %v", out, want)
+	}
+	if in["price"].Type != Int {
+		t.Fatal("Check modified its input")
+	}
+
+	for _, bad := range []Map{
+		{"price": StringValue("3")},
+		{"stock": FloatValue(4.5)},
+		{"at": StringValue("soon")},
+		{"tags": StringValue("a")},
+	} {
+		if _, err := s.Check(bad); !errors.Is(err, ErrSchema) {
+			t.Errorf("expected %v to fail the schema, got %v", bad, err)
+		}
+	}
+
+	var parsed Schema
+	if err := json.Unmarshal([]byte(`{"price":"float","tags":"string_list"}`), &parsed); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(parsed, Schema{"price": Float, "tags": StringList}) {
+		t.Fatalf("unexpected schema %v", parsed)
+	}
+	if err := json.Unmarshal([]byte(`{"price":"decimal"}`), &parsed); err == nil {
+		t.Fatal("expected an unknown type to be rejected")
+	}
+}
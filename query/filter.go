@@ -0,0 +1,449 @@
+package query
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"flashvector/metadata"
+)
+
+// Filter is a metadata filter. Match reports whether a document with the
+// given metadata passes; a nil map is a document without metadata.
+type Filter interface {
+	Match(meta metadata.Map) bool
+}
+
+// And matches when every filter does; an empty And matches everything
+type And []Filter
+
+func (f And) Match(meta metadata.Map) bool {
+	for _, sub := range f {
+		if !sub.Match(meta) {
+			return false
+		}
+	}
+	return true
+}
+
+// Or matches when any filter does; an empty Or matches nothing
+type Or []Filter
+
+func (f Or) Match(meta metadata.Map) bool {
+	for _, sub := range f {
+		if sub.Match(meta) {
+			return true
+		}
+	}
+	return false
+}
+
+// Not inverts a filter
+type Not struct {
+	Filter Filter
+}
+
+func (f Not) Match(meta metadata.Map) bool {
+	return !f.Filter.Match(meta)
+}
+
+// Exists matches documents that have the field
+type Exists struct {
+	Field string
+}
+
+func (f Exists) Match(meta metadata.Map) bool {
+	_, ok := meta[f.Field]
+	return ok
+}
+
+// Op is a comparison operator
+type Op string
+
+const (
+	OpEq  Op = "eq"
+	OpNe  Op = "ne"
+	OpLt  Op = "lt"
+	OpLte Op = "lte"
+	OpGt  Op = "gt"
+	OpGte Op = "gte"
+)
+
+// Compare compares a field with a value. A document without the field, or
+// whose field does not parse as the value's kind, never matches, not even
+// OpNe; wrap the filter in Not to include those.
+type Compare struct {
+	Field string
+	Op    Op
+	Value Value
+}
+
+func (f Compare) Match(meta metadata.Map) bool {
+	stored, ok := meta[f.Field]
+	if !ok {
+		return false
+	}
+
+	// a list matches when one of its elements does, and ne when none
+	// of them is equal
+	if stored.Type == metadata.StringList && f.Value.Kind != KindList {
+		if f.Op == OpNe {
+			return !(Compare{Field: f.Field, Op: OpEq, Value: f.Value}).Match(meta)
+		}
+		for _, item := range stored.List {
+			if f.matches(metadata.StringValue(item)) {
+				return true
+			}
+		}
+		return false
+	}
+
+	return f.matches(stored)
+}
+
+func (f Compare) matches(stored metadata.Value) bool {
+	c, ok := f.Value.compare(stored)
+	if !ok {
+		return false
+	}
+
+	switch f.Op {
+	case OpEq:
+		return c == 0
+	case OpNe:
+		return c != 0
+	case OpLt:
+		return c < 0
+	case OpLte:
+		return c <= 0
+	case OpGt:
+		return c > 0
+	case OpGte:
+		return c >= 0
+	}
+	return false
+}
+
+// In matches documents whose field equals one of the values; a list field
+// matches when it holds one of them
+type In struct {
+	Field  string
+	Values []Value
+}
+
+func (f In) Match(meta metadata.Map) bool {
+	for _, v := range f.Values {
+		if (Compare{Field: f.Field, Op: OpEq, Value: v}).Match(meta) {
+			return true
+		}
+	}
+	return false
+}
+
+// Equals matches documents whose fields equal the given strings exactly,
+// the filter a plain map of fields has always meant
+func Equals(fields map[string]string) Filter {
+	names := make([]string, 0, len(fields))
+	for field := range fields {
+		names = append(names, field)
+	}
+	sort.Strings(names)
+
+	out := make(And, len(names))
+	for i, field := range names {
+		out[i] = Compare{Field: field, Op: OpEq, Value: StringValue(fields[field])}
+	}
+	return out
+}
+
+// Kind is the type a filter value compares as
+type Kind int
+
+const (
+	KindString Kind = iota
+	KindNumber
+	KindBool
+	KindTime
+	KindList
+)
+
+// Value is a filter literal. Typed metadata compares by its type; plain
+// string metadata, as written before metadata had types, is parsed as the
+// literal's kind.
+type Value struct {
+	Kind   Kind
+	String string
+	Number float64
+	Bool   bool
+	Time   time.Time
+	List   []string
+}
+
+// StringValue, NumberValue, BoolValue, TimeValue and ListValue build values
+func StringValue(s string) Value  { return Value{Kind: KindString, String: s} }
+func NumberValue(n float64) Value { return Value{Kind: KindNumber, Number: n} }
+func BoolValue(b bool) Value      { return Value{Kind: KindBool, Bool: b} }
+func TimeValue(t time.Time) Value { return Value{Kind: KindTime, Time: t} }
+func ListValue(s ...string) Value { return Value{Kind: KindList, List: s} }
+
+// compare orders stored against the value: negative when stored sorts
+// first. False when the two cannot be compared.
+func (v Value) compare(stored metadata.Value) (int, bool) {
+	switch v.Kind {
+	case KindNumber:
+		n, ok := stored.Number()
+		if !ok && stored.Type == metadata.String {
+			f, err := strconv.ParseFloat(strings.TrimSpace(stored.Str), 64)
+			n, ok = f, err == nil
+		}
+		if !ok {
+			return 0, false
+		}
+		return metadata.Compare(metadata.FloatValue(n), metadata.FloatValue(v.Number)), true
+
+	case KindBool:
+		b, ok := stored.Bool, stored.Type == metadata.Bool
+		if stored.Type == metadata.String {
+			parsed, err := strconv.ParseBool(stored.Str)
+			b, ok = parsed, err == nil
+		}
+		if !ok {
+			return 0, false
+		}
+		return metadata.Compare(metadata.BoolValue(b), metadata.BoolValue(v.Bool)), true
+
+	case KindTime:
+		t, ok := stored.Time, stored.Type == metadata.Timestamp
+		if stored.Type == metadata.String {
+			t, ok = metadata.ParseTime(stored.Str)
+		}
+		if !ok {
+			return 0, false
+		}
+		return t.Compare(v.Time), true
+
+	case KindList:
+		if stored.Type != metadata.StringList {
+			return 0, false
+		}
+		return slices.Compare(stored.List, v.List), true
+	}
+
+	// text compares with the text form of any type
+	return strings.Compare(stored.String(), v.String), true
+}
+
+// ParseFilter decodes the JSON filter form. A node is one of:
+//
+//	{"and": [node, ...]}
+//	{"or": [node, ...]}
+//	{"not": node}
+//	{"field": "severity", "gte": 3, "lt": 5}    several operators are ANDed
+//	{"field": "status", "in": ["open", "new"]}
+//	{"field": "closed_at", "exists": false}
+//
+// Operators are eq, ne, lt, lte, gt, gte, in and exists. JSON numbers and
+// booleans compare as such; strings that are RFC 3339 timestamps or
+// YYYY-MM-DD dates compare as times, other strings as text, and lists of
+// strings with string list fields. A single value matches a string list
+// field when one of its elements does.
+//
+// An object without and, or, not or field is the older form, a map of
+// fields to the exact strings they must equal: {"lang": "en"}.
+func ParseFilter(data []byte) (Filter, error) {
+	var node map[string]json.RawMessage
+	if err := json.Unmarshal(data, &node); err != nil {
+		return nil, fmt.Errorf("filter: %w", err)
+	}
+
+	_, isAnd := node["and"]
+	_, isOr := node["or"]
+	_, isNot := node["not"]
+	_, isField := node["field"]
+
+	switch {
+	case !isAnd && !isOr && !isNot && !isField:
+		return parseEquals(node)
+	case isAnd || isOr || isNot:
+		if len(node) != 1 {
+			return nil, fmt.Errorf("filter: and, or and not must be alone in their object")
+		}
+	}
+
+	switch {
+	case isAnd, isOr:
+		raw := node["and"]
+		if isOr {
+			raw = node["or"]
+		}
+		var items []json.RawMessage
+		if err := json.Unmarshal(raw, &items); err != nil {
+			return nil, fmt.Errorf("filter: and/or takes a list: %w", err)
+		}
+		subs := make([]Filter, len(items))
+		for i, item := range items {
+			sub, err := ParseFilter(item)
+			if err != nil {
+				return nil, err
+			}
+			subs[i] = sub
+		}
+		if isOr {
+			return Or(subs), nil
+		}
+		return And(subs), nil
+
+	case isNot:
+		sub, err := ParseFilter(node["not"])
+		if err != nil {
+			return nil, err
+		}
+		return Not{Filter: sub}, nil
+	}
+
+	return parseField(node)
+}
+
+// parseEquals reads the older map of exact string matches
+func parseEquals(node map[string]json.RawMessage) (Filter, error) {
+	fields := make(map[string]string, len(node))
+	for field, raw := range node {
+		var s string
+		if err := json.Unmarshal(raw, &s); err != nil {
+			return nil, fmt.Errorf("filter: %q must be a string, or use {\"field\": ...}", field)
+		}
+		fields[field] = s
+	}
+	return Equals(fields), nil
+}
+
+// parseField reads a field node
+func parseField(node map[string]json.RawMessage) (Filter, error) {
+	var field string
+	if err := json.Unmarshal(node["field"], &field); err != nil || field == "" {
+		return nil, fmt.Errorf("filter: field must be a non-empty string")
+	}
+
+	ops := make([]string, 0, len(node))
+	for op := range node {
+		if op != "field" {
+			ops = append(ops, op)
+		}
+	}
+	if len(ops) == 0 {
+		return nil, fmt.Errorf("filter: field %q has no operator", field)
+	}
+	sort.Strings(ops)
+
+	out := make(And, 0, len(ops))
+	for _, op := range ops {
+		raw := node[op]
+
+		switch Op(op) {
+		case OpEq, OpNe, OpLt, OpLte, OpGt, OpGte:
+			v, err := parseValue(raw)
+			if err != nil {
+				return nil, fmt.Errorf("filter: %s %s: %w", field, op, err)
+			}
+			out = append(out, Compare{Field: field, Op: Op(op), Value: v})
+
+		case "in":
+			var items []json.RawMessage
+			if err := json.Unmarshal(raw, &items); err != nil {
+				return nil, fmt.Errorf("filter: %s in takes a list", field)
+			}
+			in := In{Field: field, Values: make([]Value, len(items))}
+			for i, item := range items {
+				v, err := parseValue(item)
+				if err != nil {
+					return nil, fmt.Errorf("filter: %s in: %w", field, err)
+				}
+				in.Values[i] = v
+			}
+			out = append(out, in)
+
+		case "exists":
+			var exists bool
+			if err := json.Unmarshal(raw, &exists); err != nil {
+				return nil, fmt.Errorf("filter: %s exists takes true or false", field)
+			}
+			if exists {
+				out = append(out, Exists{Field: field})
+			} else {
+				out = append(out, Not{Filter: Exists{Field: field}})
+			}
+
+		default:
+			return nil, fmt.Errorf("filter: unknown operator %q", op)
+		}
+	}
+
+	if len(out) == 1 {
+		return out[0], nil
+	}
+	return out, nil
+}
+
+// parseValue reads a JSON literal as a typed value
+func parseValue(raw json.RawMessage) (Value, error) {
+	dec := json.NewDecoder(bytes.NewReader(raw))
+	dec.UseNumber()
+
+	var lit any
+	if err := dec.Decode(&lit); err != nil {
+		return Value{}, err
+	}
+
+	switch lit := lit.(type) {
+	case json.Number:
+		n, err := lit.Float64()
+		if err != nil {
+			return Value{}, err
+		}
+		return NumberValue(n), nil
+	case bool:
+		return BoolValue(lit), nil
+	case string:
+		if t, ok := metadata.ParseTime(lit); ok {
+			return TimeValue(t), nil
+		}
+		return StringValue(lit), nil
+	case []any:
+		list := make([]string, len(lit))
+		for i, item := range lit {
+			s, ok := item.(string)
+			if !ok {
+				return Value{}, fmt.Errorf("lists may only hold strings")
+			}
+			list[i] = s
+		}
+		return ListValue(list...), nil
+	}
+
+	return Value{}, fmt.Errorf("value must be a string, number, boolean or list of strings")
+}
+
+// FilterJSON is a Filter that decodes from the JSON form, for request
+// structs. Its Filter is nil when the JSON was absent or null.
+type FilterJSON struct {
+	Filter Filter
+}
+
+func (f *FilterJSON) UnmarshalJSON(data []byte) error {
+	if bytes.Equal(bytes.TrimSpace(data), []byte("null")) {
+		f.Filter = nil
+		return nil
+	}
+
+	filter, err := ParseFilter(data)
+	if err != nil {
+		return err
+	}
+	f.Filter = filter
+	return nil
+}
@@ -0,0 +1,122 @@
+package query
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"flashvector/metadata"
+)
+
+func TestParseFilter(t *testing.T) {
+	// plain strings, as metadata was before it had types
+	docs := map[string]metadata.Map{
+		"a": metadata.Strings(map[string]string{"ward": "north", "severity": "4", "reported": "2024-03-01T10:00:00Z", "urgent": "true"}),
+		"b": metadata.Strings(map[string]string{"ward": "south", "severity": "2", "reported": "2024-01-15"}),
+		"c": metadata.Strings(map[string]string{"ward": "north", "severity": "high"}),
+		"d": nil,
+	}
+
+	cases := map[string]string{
+		`{"ward": "north"}`: "ac",
+		`{}`:                "abcd",
+		`{"field": "severity", "gte": 2, "lt": 4}`:   "b",
+		`{"field": "severity", "ne": 4}`:             "b",
+		`{"not": {"field": "severity", "eq": 4}}`:    "bcd",
+		`{"field": "ward", "in": ["south", "east"]}`: "b",
+		`{"field": "reported", "gt": "2024-02-01"}`:  "a",
+		`{"field": "reported", "exists": false}`:     "cd",
+		`{"field": "urgent", "eq": true}`:            "a",
+		`{"or": [{"field": "severity", "gt": 3}, {"and": [{"ward": "north"}, {"field": "severity", "exists": true}]}]}`: "ac",
+		`{"or": []}`: "",
+	}
+
+	for in, want := range cases {
+		f, err := ParseFilter([]byte(in))
+		if err != nil {
+			t.Fatalf("ParseFilter(%s): %v", in, err)
+		}
+
+		got := ""
+		for _, id := range []string{"a", "b", "c", "d"} {
+			if f.Match(docs[id]) {
+				got += id
+			}
+		}
+		if got != want {
+			t.Errorf("%s matched %q, want %q", in, got, want)
+		}
+	}
+
+	for _, in := range []string{
+		`{"field": "x", "like": 1}`,
+		`{"field": "x"}`,
+		`{"and": [], "field": "x", "eq": 1}`,
+		`{"ward": 3}`,
+		`{"field": "x", "in": 3}`,
+		`{"field": "x", "eq": [1]}`,
+		`[1]`,
+	} {
+		if _, err := ParseFilter([]byte(in)); err == nil {
+			t.Errorf("expected ParseFilter(%s) to fail", in)
+		}
+	}
+}
+
+func TestSearchRequestFilter(t *testing.T) {
+	var req SearchRequest
+	if err := json.Unmarshal([]byte(`{"text": "x"}`), &req); err != nil || req.Filter.Filter != nil {
+		t.Fatalf("expected no filter, got %v (%v)", req.Filter.Filter, err)
+	}
+	if err := json.Unmarshal([]byte(`{"filter": {"field": "n", "lte": 1}}`), &req); err != nil {
+		t.Fatal(err)
+	}
+	if !req.Filter.Filter.Match(metadata.Map{"n": metadata.FloatValue(0.5)}) {
+		t.Fatalf("expected the decoded filter to match")
+	}
+	if err := json.Unmarshal([]byte(`{"filter": {"field": "n", "near": 1}}`), &req); err == nil {
+		t.Fatalf("expected an invalid filter to fail decoding")
+	}
+}
+
+func TestFilterTypedMetadata(t *testing.T) {
+	reported := time.Date(2024, 3, 1, 10, 0, 0, 0, time.UTC)
+	docs := map[string]metadata.Map{
+		"a": {"price": metadata.FloatValue(9.5), "stock": metadata.IntValue(10), "tags": metadata.ListValue("urgent", "water"), "reported": metadata.TimeValue(reported), "open": metadata.BoolValue(true)},
+		"b": {"price": metadata.IntValue(20), "stock": metadata.IntValue(0), "tags": metadata.ListValue("road")},
+		"c": {"price": metadata.StringValue("cheap"), "tags": metadata.ListValue()},
+	}
+
+	cases := map[string]string{
+		// ints and floats compare as numbers, and "10" is not below "9.5"
+		`{"field": "price", "lt": 10}`:                 "a",
+		`{"field": "price", "gte": 9.5}`:               "ab",
+		`{"field": "stock", "eq": 10}`:                 "a",
+		`{"stock": "10"}`:                              "a",
+		`{"field": "reported", "gte": "2024-03-01"}`:   "a",
+		`{"field": "reported", "lt": "2024-03-01"}`:    "",
+		`{"field": "open", "eq": true}`:                "a",
+		`{"field": "tags", "eq": "water"}`:             "a",
+		`{"field": "tags", "in": ["road", "gas"]}`:     "b",
+		`{"field": "tags", "ne": "urgent"}`:            "bc",
+		`{"field": "tags", "eq": ["urgent", "water"]}`: "a",
+		`{"field": "tags", "gt": "s"}`:                 "a",
+	}
+
+	for in, want := range cases {
+		f, err := ParseFilter([]byte(in))
+		if err != nil {
+			t.Fatalf("ParseFilter(%s): %v", in, err)
+		}
+
+		got := ""
+		for _, id := range []string{"a", "b", "c"} {
+			if f.Match(docs[id]) {
+				got += id
+			}
+		}
+		if got != want {
+			t.Errorf("%s matched %q, want %q", in, got, want)
+		}
+	}
+}
@@ -0,0 +1,159 @@
+package query
+
+import (
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// Occur says how a clause takes part in a keyword match
+type Occur int
+
+const (
+	Should  Occur = iota // adds to the score; one must match when nothing is required
+	Must                 // +word: every match has it
+	MustNot              // -word: no match has it
+)
+
+// MaxFuzzyEdits caps the edit distance a fuzzy term may ask for
+const MaxFuzzyEdits = 2
+
+// Clause is one part of a keyword query: a term, a quoted phrase or a
+// parenthesized group of clauses
+type Clause struct {
+	Occur  Occur
+	Term   string
+	Phrase string
+	Group  []Clause
+	// Fuzzy is how many edits a Term may be away from an indexed term
+	Fuzzy int
+}
+
+// ParseKeywordQuery parses the keyword search syntax:
+//
+//	pipe leak          either word
+//	"burst pipe"       the words next to each other, in order
+//	+pipe -gas         pipe is required, gas excluded
+//	+(pipe OR drain)   a required group; OR is the default and may be spelled out
+//	pipr~1             pipe within one edit (~ alone allows MaxFuzzyEdits)
+//
+// The parser never fails: an unclosed quote or parenthesis runs to the end
+// of the text and stray operators are dropped, so any text is a query.
+func ParseKeywordQuery(text string) []Clause {
+	p := keywordParser{text: []rune(text)}
+	return p.clauses(false)
+}
+
+type keywordParser struct {
+	text []rune
+	pos  int
+}
+
+func (p *keywordParser) done() bool {
+	return p.pos >= len(p.text)
+}
+
+func (p *keywordParser) peek() rune {
+	return p.text[p.pos]
+}
+
+// clauses reads clauses up to the end of the text, or up to the closing
+// parenthesis when inGroup
+func (p *keywordParser) clauses(inGroup bool) []Clause {
+	var out []Clause
+
+	for {
+		for !p.done() && unicode.IsSpace(p.peek()) {
+			p.pos++
+		}
+		if p.done() {
+			return out
+		}
+
+		if p.peek() == ')' {
+			p.pos++
+			if inGroup {
+				return out
+			}
+			continue
+		}
+
+		occur := Should
+		switch p.peek() {
+		case '+':
+			occur = Must
+			p.pos++
+		case '-':
+			occur = MustNot
+			p.pos++
+		}
+		if occur != Should && (p.done() || unicode.IsSpace(p.peek())) {
+			continue
+		}
+
+		c := Clause{Occur: occur}
+
+		switch p.peek() {
+		case '"':
+			p.pos++
+			c.Phrase = p.until(func(r rune) bool { return r == '"' })
+			if !p.done() {
+				p.pos++
+			}
+			// proximity (~N) is not supported; read it so it is not a word
+			if !p.done() && p.peek() == '~' {
+				p.pos++
+				p.until(func(r rune) bool { return !unicode.IsDigit(r) })
+			}
+			if strings.TrimSpace(c.Phrase) == "" {
+				continue
+			}
+		case '(':
+			p.pos++
+			c.Group = p.clauses(true)
+			if len(c.Group) == 0 {
+				continue
+			}
+		default:
+			word := p.until(func(r rune) bool { return unicode.IsSpace(r) || r == '(' || r == ')' || r == '"' })
+			if word == "OR" && occur == Should {
+				continue
+			}
+			c.Term, c.Fuzzy = splitFuzzy(word)
+			if c.Term == "" {
+				continue
+			}
+		}
+
+		out = append(out, c)
+	}
+}
+
+// until reads runes up to, not including, the first one stop accepts
+func (p *keywordParser) until(stop func(rune) bool) string {
+	start := p.pos
+	for !p.done() && !stop(p.peek()) {
+		p.pos++
+	}
+	return string(p.text[start:p.pos])
+}
+
+// splitFuzzy splits word~N into the word and its edit distance
+func splitFuzzy(word string) (string, int) {
+	i := strings.LastIndexByte(word, '~')
+	if i < 0 {
+		return word, 0
+	}
+
+	edits := MaxFuzzyEdits
+	if suffix := word[i+1:]; suffix != "" {
+		n, err := strconv.Atoi(suffix)
+		if err != nil || n < 0 {
+			// not fuzzy syntax, just a word with a tilde in it
+			return word, 0
+		}
+		edits = min(n, MaxFuzzyEdits)
+	}
+
+	return word[:i], edits
+}
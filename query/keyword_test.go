@@ -0,0 +1,36 @@
+package query
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseKeywordQuery(t *testing.T) {
+	cases := map[string][]Clause{
+		"pipe leak": {{Term: "pipe"}, {Term: "leak"}},
+		`+"burst pipe" -gas`: {
+			{Occur: Must, Phrase: "burst pipe"},
+			{Occur: MustNot, Term: "gas"},
+		},
+		"+(pipe OR drain) vec-12": {
+			{Occur: Must, Group: []Clause{{Term: "pipe"}, {Term: "drain"}}},
+			{Term: "vec-12"},
+		},
+		"pipr~1 plumbr~ x~9 a~b": {
+			{Term: "pipr", Fuzzy: 1},
+			{Term: "plumbr", Fuzzy: MaxFuzzyEdits},
+			{Term: "x", Fuzzy: MaxFuzzyEdits},
+			{Term: "a~b"},
+		},
+		// unbalanced input still parses
+		`"open phrase`:   {{Phrase: "open phrase"}},
+		"(a b":           {{Group: []Clause{{Term: "a"}, {Term: "b"}}}},
+		`) + - "" () OR`: nil,
+	}
+
+	for text, want := range cases {
+		if got := ParseKeywordQuery(text); !reflect.DeepEqual(got, want) {
+			t.Errorf("ParseKeywordQuery(%q) = %+v, want %+v", text, got, want)
+		}
+	}
+}
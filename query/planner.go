@@ -1,5 +1,7 @@
 package query
 
+import "flashvector/analysis"
+
 // SearchStrategy defines the custom type for our routing logic
 type SearchStrategy int
 
@@ -16,7 +18,34 @@ type SearchRequest struct {
 	Text   string    `json:"text"`
 	Vector []float32 `json:"vector"`
 	K      int       `json:"k"`
-	Filter map[string]string `json:"filter"`
+	// Filter restricts hits by metadata; see ParseFilter for the JSON form
+	Filter FilterJSON `json:"filter"`
+	// Rescore over-fetches K*Rescore quantized candidates and re-ranks them
+	// at full precision; 0 or 1 disables it
+	Rescore int `json:"rescore"`
+	// Highlight, when set, marks where the text query matched each hit
+	Highlight *analysis.SnippetOptions `json:"highlight"`
+	// Include picks what each hit returns besides its ID and score; when
+	// absent hits carry their text, as they always have
+	Include *Include `json:"include"`
+	// Sort reorders the K best hits by metadata fields instead of score
+	Sort []SortField `json:"sort"`
+}
+
+// SortField is one key of a sort. Hits without the field go last; hits
+// that tie on every key keep their score order.
+type SortField struct {
+	Field string `json:"field"`
+	Desc  bool   `json:"desc"`
+}
+
+// Include picks the stored fields a search returns with each hit
+type Include struct {
+	Metadata bool `json:"metadata"`
+	// Fields returns only these metadata keys; it implies Metadata
+	Fields []string `json:"fields"`
+	Text   bool     `json:"text"`
+	Vector bool     `json:"vector"`
 }
 
 // SearchPlan is the final "order" sent to the storage engine
@@ -1,32 +1,78 @@
 package server
 
 import (
-	"encoding/binary" // <-- ADDED
 	"encoding/json"
+	"errors"
+	"flashvector/metadata"
 	"flashvector/query"
 	"flashvector/storage"
 	"flashvector/vector"
-	"math" // <-- ADDED
+	"fmt"
 	"net/http"
 )
 
 // API holds our database store so the web routes can access it
 type API struct {
-	store *storage.Store
+	store   *storage.Store
+	catalog *storage.Catalog
 }
 
 func NewAPI(store *storage.Store) *API {
 	return &API{store: store}
 }
 
+// NewAPIWithCatalog also serves the named collections under /collections
+func NewAPIWithCatalog(store *storage.Store, catalog *storage.Catalog) *API {
+	return &API{store: store, catalog: catalog}
+}
+
 // --- JSON Payloads ---
 
 type InsertRequest struct {
-	ID       string            `json:"id"`
-	Vector   []float32         `json:"vector"`
-	Metadata map[string]string `json:"metadata"`
+	ID     string    `json:"id"`
+	Vector []float32 `json:"vector"`
+	// Metadata values keep their JSON type: strings, numbers, booleans or
+	// lists of strings
+	Metadata metadata.Map `json:"metadata"`
+	// Text is the document content keyword search matches against
+	Text string `json:"text"`
+}
+
+// BatchInsertRequest is the body of POST /insert/batch
+type BatchInsertRequest struct {
+	Items []InsertRequest `json:"items"`
+}
+
+// BatchItemResult reports one item of a batch insert, in request order
+type BatchItemResult struct {
+	ID     string `json:"id"`
+	Status string `json:"status"`
+	Error  string `json:"error,omitempty"`
+}
+
+// BatchInsertResponse is returned by POST /insert/batch
+type BatchInsertResponse struct {
+	Inserted int               `json:"inserted"`
+	Failed   int               `json:"failed"`
+	Results  []BatchItemResult `json:"results"`
 }
 
+// SearchHit is one search result. ID and Score keep the names search
+// responses have always used.
+type SearchHit struct {
+	ID    string  `json:"ID"`
+	Score float32 `json:"Score"`
+	Text  string  `json:"text,omitempty"`
+	// Metadata and Vector are returned when the request includes them
+	Metadata storage.Metadata `json:"metadata,omitempty"`
+	Vector   []float32        `json:"vector,omitempty"`
+	// Highlight is set when the request asked for it and had text
+	Highlight *storage.Highlight `json:"highlight,omitempty"`
+}
+
+// maxBatchItems bounds a single batch insert request
+const maxBatchItems = 10000
+
 type SearchRequest struct {
 	Vector []float32         `json:"vector"`
 	K      int               `json:"k"`
@@ -38,17 +84,38 @@ type SearchRequest struct {
 
 // HandleInsert receives a vector via POST and saves it to the WAL & Index
 func (api *API) HandleInsert(w http.ResponseWriter, r *http.Request) {
+	api.insert(w, r, api.store)
+}
+
+// insert decodes an InsertRequest and writes it to the given store
+func (api *API) insert(w http.ResponseWriter, r *http.Request, store *storage.Store) {
 	var req InsertRequest
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
 		http.Error(w, "Invalid JSON format", http.StatusBadRequest)
 		return
 	}
+	if req.ID == "" {
+		http.Error(w, "id is required", http.StatusBadRequest)
+		return
+	}
+
+	// Check the length before encoding: binary encoding pads to whole
+	// bytes, which would hide a bad dimension from the store
+	if err := store.CheckDimension(req.Vector); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
 
-	// Convert float array to bytes for storage
-	valBytes := floatsToBytes(req.Vector)
+	// Convert float array to bytes in the store's element type
+	// (float32, float16, or sign bits for binary)
+	valBytes := vector.EncodeVector(req.Vector, store.ElementType())
 
 	// Save to FlashVector!
-	if err := api.store.Set(req.ID, valBytes, req.Metadata); err != nil {
+	if err := store.Set(req.ID, valBytes, req.Metadata, req.Text); err != nil {
+		if isInvalid(err) {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
 		http.Error(w, "Failed to save vector", http.StatusInternalServerError)
 		return
 	}
@@ -60,6 +127,88 @@ func (api *API) HandleInsert(w http.ResponseWriter, r *http.Request) {
 	})
 }
 
+// HandleInsertBatch saves many vectors with one WAL record and one index
+// update. Items are validated one by one; rejected items are reported with
+// their error and the rest are written together. The response is 200 as
+// long as the batch itself could be processed, even if every item failed.
+func (api *API) HandleInsertBatch(w http.ResponseWriter, r *http.Request) {
+	api.insertBatch(w, r, api.store)
+}
+
+// insertBatch decodes a BatchInsertRequest and writes it to the given store
+func (api *API) insertBatch(w http.ResponseWriter, r *http.Request, store *storage.Store) {
+	var req BatchInsertRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid JSON format", http.StatusBadRequest)
+		return
+	}
+
+	if len(req.Items) == 0 {
+		http.Error(w, "Batch has no items", http.StatusBadRequest)
+		return
+	}
+	if len(req.Items) > maxBatchItems {
+		http.Error(w, fmt.Sprintf("Batch has %d items, the limit is %d", len(req.Items), maxBatchItems), http.StatusRequestEntityTooLarge)
+		return
+	}
+
+	resp := BatchInsertResponse{Results: make([]BatchItemResult, len(req.Items))}
+
+	// items rejected here never reach the store; index maps store items back
+	items := make([]storage.BatchItem, 0, len(req.Items))
+	index := make([]int, 0, len(req.Items))
+
+	for i, item := range req.Items {
+		resp.Results[i].ID = item.ID
+
+		switch {
+		case item.ID == "":
+			resp.Results[i].Error = "id is required"
+		case len(item.Vector) == 0:
+			resp.Results[i].Error = "vector is empty"
+		default:
+			// checked before encoding, as in insert
+			if err := store.CheckDimension(item.Vector); err != nil {
+				resp.Results[i].Error = err.Error()
+				continue
+			}
+			items = append(items, storage.BatchItem{
+				Key:      item.ID,
+				Value:    vector.EncodeVector(item.Vector, store.ElementType()),
+				Metadata: item.Metadata,
+				Text:     item.Text,
+			})
+			index = append(index, i)
+		}
+	}
+
+	if len(items) > 0 {
+		errs, err := store.SetBatch(items)
+		if err != nil {
+			http.Error(w, "Failed to save batch", http.StatusInternalServerError)
+			return
+		}
+
+		for j, err := range errs {
+			if err != nil {
+				resp.Results[index[j]].Error = err.Error()
+			}
+		}
+	}
+
+	for i := range resp.Results {
+		if resp.Results[i].Error != "" {
+			resp.Results[i].Status = "error"
+			resp.Failed++
+		} else {
+			resp.Results[i].Status = "success"
+			resp.Inserted++
+		}
+	}
+
+	writeJSON(w, http.StatusOK, resp)
+}
+
 // // HandleSearch receives a query vector and returns the closest matches
 // func (api *API) HandleSearch(w http.ResponseWriter, r *http.Request) {
 // 	var req SearchRequest
@@ -83,6 +232,11 @@ func (api *API) HandleInsert(w http.ResponseWriter, r *http.Request) {
 
 // HandleSearch now uses the Query Planner to decide the best search strategy
 func (api *API) HandleSearch(w http.ResponseWriter, r *http.Request) {
+	api.search(w, r, api.store)
+}
+
+// search runs a planned query against the given store
+func (api *API) search(w http.ResponseWriter, r *http.Request, store *storage.Store) {
 	// 1. Decode using the new SearchRequest that supports 'text' and 'vector'
 	var req query.SearchRequest
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
@@ -95,48 +249,111 @@ func (api *API) HandleSearch(w http.ResponseWriter, r *http.Request) {
 		req.K = 5
 	}
 
+	// Reject query vectors the index cannot score
+	if len(req.Vector) > 0 {
+		if err := store.CheckDimension(req.Vector); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+	}
+
 	// 3. Ask the Planner for the best strategy and adaptive weight
 	plan := query.Plan(req)
 
-	var results []vector.Result
+	include := query.Include{Text: true}
+	if req.Include != nil {
+		include = *req.Include
+	}
 
-	// 4. Execute based on the Planner's decision
-	switch plan.Strategy {
-	case query.StrategyVectorOnly:
-		// Only run vector search if no text was provided
-		results = api.store.VectorSearch(req.Vector, req.K, nil)
+	var hits []SearchHit
 
-	case query.StrategyKeywordOnly:
-		// Only run keyword search if no vector was provided
-		results = api.store.KeywordSearch(req.Text, req.K)
+	// Search and load the hits from one consistent view of the store
+	store.View(func(v storage.View) {
+		var results []vector.Result
 
-	case query.StrategyHybrid:
-		// Run both and fuse them using the adaptive weight from the Planner
-		results = api.store.AdaptiveSearch(req.Text, req.Vector, req.K, plan.RRFConstant)
-	}
+		// 4. Execute based on the Planner's decision
+		switch plan.Strategy {
+		case query.StrategyVectorOnly:
+			// Only run vector search if no text was provided
+			results = v.VectorSearch(req.Vector, req.K, nil, storage.SearchOptions{
+				RescoreFactor: req.Rescore,
+				Filter:        req.Filter.Filter,
+			})
+
+		case query.StrategyKeywordOnly:
+			// Only run keyword search if no vector was provided
+			results = v.KeywordSearch(req.Text, req.K, req.Filter.Filter)
+
+		case query.StrategyHybrid:
+			// Run both and fuse them using the adaptive weight from the Planner
+			results = v.AdaptiveSearch(req.Text, req.Vector, req.K, plan.RRFConstant, req.Filter.Filter)
+		}
+
+		// 5. Reorder by metadata if the request asked to
+		v.Sort(results, req.Sort)
+
+		// 6. Attach what the request asked for to each hit
+		ids := make([]string, len(results))
+		for i, res := range results {
+			ids[i] = res.ID
+		}
+		docs := v.Documents(ids, include)
+
+		var highlights []storage.Highlight
+		if req.Highlight != nil && req.Text != "" {
+			highlights = v.Highlight(req.Text, ids, *req.Highlight)
+		}
+
+		hits = make([]SearchHit, len(results))
+		for i, res := range results {
+			hits[i] = SearchHit{
+				ID:       res.ID,
+				Score:    res.Score,
+				Text:     docs[i].Text,
+				Metadata: docs[i].Metadata,
+				Vector:   docs[i].Vector,
+			}
+			if highlights != nil {
+				hits[i].Highlight = &highlights[i]
+			}
+		}
+	})
 
-	// 5. Return results as JSON
 	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(results)
+	json.NewEncoder(w).Encode(hits)
+}
+
+// isInvalid reports whether a store error means the request was wrong,
+// rather than that the store failed to save it
+func isInvalid(err error) bool {
+	var dimErr *vector.DimensionError
+	return errors.As(err, &dimErr) || errors.Is(err, storage.ErrInvalidVector) || errors.Is(err, metadata.ErrSchema)
 }
 
 // Start boots up the web server
 func (api *API) Start(port string) error {
+	return http.ListenAndServe(":"+port, api.Handler())
+}
+
+// Handler routes every endpoint; the collection routes are only served
+// when the API has a catalog
+func (api *API) Handler() http.Handler {
 	mux := http.NewServeMux()
 	
 	// Register our two endpoints
 	mux.HandleFunc("/insert", api.HandleInsert)
+	mux.HandleFunc("POST /insert/batch", api.HandleInsertBatch)
 	mux.HandleFunc("/search", api.HandleSearch)
 
-	return http.ListenAndServe(":"+port, mux)
-}
-
-// floatsToBytes correctly converts []float32 to []byte (4 bytes per float)
-func floatsToBytes(floats []float32) []byte {
-	b := make([]byte, len(floats)*4)
-	for i, f := range floats {
-		bits := math.Float32bits(f)
-		binary.LittleEndian.PutUint32(b[i*4:(i+1)*4], bits)
+	if api.catalog != nil {
+		mux.HandleFunc("GET /collections", api.HandleListCollections)
+		mux.HandleFunc("POST /collections", api.HandleCreateCollection)
+		mux.HandleFunc("GET /collections/{name}", api.HandleDescribeCollection)
+		mux.HandleFunc("DELETE /collections/{name}", api.HandleDropCollection)
+		mux.HandleFunc("POST /collections/{name}/insert", api.HandleCollectionInsert)
+		mux.HandleFunc("POST /collections/{name}/insert/batch", api.HandleCollectionInsertBatch)
+		mux.HandleFunc("POST /collections/{name}/search", api.HandleCollectionSearch)
 	}
-	return b
-}
\ No newline at end of file
+
+	return mux
+}
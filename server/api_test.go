@@ -0,0 +1,259 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"flashvector/storage"
+	"flashvector/wal"
+)
+
+// newTestAPI serves a 2-dim default store and an empty catalog
+func newTestAPI(t *testing.T) http.Handler {
+	t.Helper()
+	dir := t.TempDir()
+	ctx := context.Background()
+
+	w, err := wal.Open(filepath.Join(dir, "data.wal"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	store, err := storage.NewStoreWithOptions(ctx, w, storage.Options{
+		Dimension:    2,
+		SnapshotPath: filepath.Join(dir, "data.snap"),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	catalog, err := storage.OpenCatalog(ctx, filepath.Join(dir, "collections"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		catalog.Close()
+		store.Close()
+		w.Close()
+	})
+
+	return NewAPIWithCatalog(store, catalog).Handler()
+}
+
+// do sends a request with a JSON body and returns the recorded response
+func do(t *testing.T, h http.Handler, method, path, body string) *httptest.ResponseRecorder {
+	t.Helper()
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest(method, path, strings.NewReader(body)))
+	return rec
+}
+
+func TestInsertRejectsInvalidRequests(t *testing.T) {
+	h := newTestAPI(t)
+
+	cases := map[string]string{
+		"empty id":      `{"vector": [1, 0]}`,
+		"bad dimension": `{"id": "a", "vector": [1, 0, 0]}`,
+		"no vector":     `{"id": "a"}`,
+		"bad json":      `{"id": `,
+	}
+	for name, body := range cases {
+		if rec := do(t, h, "POST", "/insert", body); rec.Code != http.StatusBadRequest {
+			t.Errorf("%s: expected 400, got %d: %s", name, rec.Code, rec.Body)
+		}
+	}
+	if rec := do(t, h, "POST", "/insert", `{"vector": [1, 0]}`); !strings.Contains(rec.Body.String(), "id is required") {
+		t.Fatalf("expected the empty id to be named, got %q", rec.Body)
+	}
+
+	if rec := do(t, h, "POST", "/insert", `{"id": "a", "vector": [1, 0]}`); rec.Code != http.StatusOK {
+		t.Fatalf("expected a valid insert to succeed, got %d: %s", rec.Code, rec.Body)
+	}
+	// a null metadata value is an absent field, not an invalid one
+	if rec := do(t, h, "POST", "/insert", `{"id": "b", "vector": [0, 1], "metadata": {"color": "red", "size": null}}`); rec.Code != http.StatusOK {
+		t.Fatalf("expected null metadata to be accepted, got %d: %s", rec.Code, rec.Body)
+	}
+}
+
+func TestInsertBatchReportsEachItem(t *testing.T) {
+	h := newTestAPI(t)
+
+	rec := do(t, h, "POST", "/insert/batch", `{"items": [
+		{"id": "a", "vector": [1, 0]},
+		{"vector": [1, 0]},
+		{"id": "empty"},
+		{"id": "wide", "vector": [1, 0, 0]},
+		{"id": "b", "vector": [0, 1]}
+	]}`)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", rec.Code, rec.Body)
+	}
+
+	var resp BatchInsertResponse
+	if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+		t.Fatal(err)
+	}
+	if resp.Inserted != 2 || resp.Failed != 3 || len(resp.Results) != 5 {
+		t.Fatalf("expected 2 inserted and 3 failed, got %+v", resp)
+	}
+
+	want := []string{"success", "error", "error", "error", "success"}
+	for i, res := range resp.Results {
+		if res.Status != want[i] || (res.Status == "error") != (res.Error != "") {
+			t.Errorf("item %d: expected %s, got %+v", i, want[i], res)
+		}
+	}
+	if resp.Results[1].Error != "id is required" || resp.Results[2].Error != "vector is empty" {
+		t.Fatalf("unexpected item errors %+v", resp.Results)
+	}
+
+	// an all-failed batch is still processed
+	rec = do(t, h, "POST", "/insert/batch", `{"items": [{"id": "wide", "vector": [1, 0, 0]}]}`)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected 200 for a batch of failures, got %d", rec.Code)
+	}
+}
+
+func TestInsertBatchLimits(t *testing.T) {
+	h := newTestAPI(t)
+
+	if rec := do(t, h, "POST", "/insert/batch", `{"items": []}`); rec.Code != http.StatusBadRequest {
+		t.Fatalf("expected 400 for an empty batch, got %d", rec.Code)
+	}
+
+	items := make([]string, maxBatchItems+1)
+	for i := range items {
+		items[i] = fmt.Sprintf(`{"id": "k%d", "vector": [1, 0]}`, i)
+	}
+	body := `{"items": [` + strings.Join(items, ",") + `]}`
+	if rec := do(t, h, "POST", "/insert/batch", body); rec.Code != http.StatusRequestEntityTooLarge {
+		t.Fatalf("expected 413 over the limit, got %d", rec.Code)
+	}
+
+	body = `{"items": [` + strings.Join(items[:maxBatchItems], ",") + `]}`
+	if rec := do(t, h, "POST", "/insert/batch", body); rec.Code != http.StatusOK {
+		t.Fatalf("expected a batch at the limit to succeed, got %d: %s", rec.Code, rec.Body)
+	}
+}
+
+func TestCollectionRoutes(t *testing.T) {
+	h := newTestAPI(t)
+
+	for _, cfg := range []string{
+		`{"name": "docs", "dimension": 2, "index": "flat"}`,
+		`{"name": "other", "dimension": 2, "index": "flat"}`,
+		`{"name": "bits", "dimension": 8, "element_type": "binary"}`,
+	} {
+		if rec := do(t, h, "POST", "/collections", cfg); rec.Code != http.StatusCreated {
+			t.Fatalf("expected 201, got %d: %s", rec.Code, rec.Body)
+		}
+	}
+	if rec := do(t, h, "POST", "/collections", `{"name": "docs", "dimension": 2}`); rec.Code != http.StatusConflict {
+		t.Fatalf("expected 409 for a duplicate collection, got %d", rec.Code)
+	}
+
+	if rec := do(t, h, "POST", "/collections/docs/insert", `{"id": "a", "vector": [1, 0], "text": "hello"}`); rec.Code != http.StatusOK {
+		t.Fatalf("expected insert to succeed, got %d: %s", rec.Code, rec.Body)
+	}
+
+	search := func(path string) []SearchHit {
+		t.Helper()
+		rec := do(t, h, "POST", path, `{"vector": [1, 0], "k": 5}`)
+		if rec.Code != http.StatusOK {
+			t.Fatalf("search %s: got %d: %s", path, rec.Code, rec.Body)
+		}
+		var hits []SearchHit
+		if err := json.Unmarshal(rec.Body.Bytes(), &hits); err != nil {
+			t.Fatal(err)
+		}
+		return hits
+	}
+	if hits := search("/collections/docs/search"); len(hits) != 1 || hits[0].ID != "a" {
+		t.Fatalf("expected a in docs, got %v", hits)
+	}
+	if hits := search("/collections/other/search"); len(hits) != 0 {
+		t.Fatalf("expected other to be empty, got %v", hits)
+	}
+	if hits := search("/search"); len(hits) != 0 {
+		t.Fatalf("expected the default store to be empty, got %v", hits)
+	}
+
+	// binary encoding pads to whole bytes, so 7 values must still fail
+	if rec := do(t, h, "POST", "/collections/bits/insert", `{"id": "b", "vector": [1, 0, 1, 0, 1, 0, 1]}`); rec.Code != http.StatusBadRequest {
+		t.Fatalf("expected 400 for a 7-dim binary vector, got %d", rec.Code)
+	}
+
+	for _, req := range []struct{ method, path string }{
+		{"GET", "/collections/missing"},
+		{"DELETE", "/collections/missing"},
+		{"POST", "/collections/missing/insert"},
+		{"POST", "/collections/missing/insert/batch"},
+		{"POST", "/collections/missing/search"},
+	} {
+		if rec := do(t, h, req.method, req.path, `{"id": "a", "vector": [1, 0]}`); rec.Code != http.StatusNotFound {
+			t.Errorf("%s %s: expected 404, got %d", req.method, req.path, rec.Code)
+		}
+	}
+
+	if rec := do(t, h, "DELETE", "/collections/docs", ""); rec.Code != http.StatusOK {
+		t.Fatalf("expected drop to succeed, got %d", rec.Code)
+	}
+	if rec := do(t, h, "POST", "/collections/docs/search", `{"vector": [1, 0]}`); rec.Code != http.StatusNotFound {
+		t.Fatalf("expected 404 after drop, got %d", rec.Code)
+	}
+}
+
+func TestSearchIncludeProjection(t *testing.T) {
+	h := newTestAPI(t)
+
+	do(t, h, "POST", "/collections", `{"name": "docs", "dimension": 2, "index": "flat"}`)
+	rec := do(t, h, "POST", "/collections/docs/insert", `{
+		"id": "a", "vector": [1, 0], "text": "hello",
+		"metadata": {"color": "red", "size": 3}
+	}`)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected insert to succeed, got %d: %s", rec.Code, rec.Body)
+	}
+
+	search := func(include string) map[string]json.RawMessage {
+		t.Helper()
+		body := `{"vector": [1, 0], "k": 1`
+		if include != "" {
+			body += `, "include": ` + include
+		}
+		rec := do(t, h, "POST", "/collections/docs/search", body+`}`)
+		var hits []map[string]json.RawMessage
+		if err := json.Unmarshal(rec.Body.Bytes(), &hits); err != nil || len(hits) != 1 {
+			t.Fatalf("expected one hit, got %s (%v)", rec.Body, err)
+		}
+		return hits[0]
+	}
+	keys := func(hit map[string]json.RawMessage) string {
+		var out []string
+		for _, k := range []string{"text", "metadata", "vector"} {
+			if _, ok := hit[k]; ok {
+				out = append(out, k)
+			}
+		}
+		return strings.Join(out, ",")
+	}
+
+	if got := keys(search("")); got != "text" {
+		t.Fatalf("expected only text by default, got %s", got)
+	}
+	if got := keys(search(`{"metadata": true, "vector": true}`)); got != "metadata,vector" {
+		t.Fatalf("expected metadata and vector, got %s", got)
+	}
+
+	hit := search(`{"fields": ["color"]}`)
+	if got := keys(hit); got != "metadata" {
+		t.Fatalf("expected fields to imply metadata alone, got %s", got)
+	}
+	if string(hit["metadata"]) != `{"color":"red"}` {
+		t.Fatalf("expected only color, got %s", hit["metadata"])
+	}
+}
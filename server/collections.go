@@ -0,0 +1,117 @@
+package server
+
+import (
+	"encoding/json"
+	"errors"
+	"flashvector/storage"
+	"net/http"
+)
+
+// --- Collection Routes ---
+
+// HandleListCollections returns every collection's schema and size
+func (api *API) HandleListCollections(w http.ResponseWriter, r *http.Request) {
+	infos := make([]storage.CollectionInfo, 0)
+	for _, col := range api.catalog.List() {
+		infos = append(infos, col.Info())
+	}
+
+	writeJSON(w, http.StatusOK, infos)
+}
+
+// HandleCreateCollection creates a collection from a storage.CollectionConfig body
+func (api *API) HandleCreateCollection(w http.ResponseWriter, r *http.Request) {
+	var cfg storage.CollectionConfig
+	if err := json.NewDecoder(r.Body).Decode(&cfg); err != nil {
+		http.Error(w, "Invalid JSON format", http.StatusBadRequest)
+		return
+	}
+
+	col, err := api.catalog.Create(cfg)
+	if errors.Is(err, storage.ErrCollectionExists) {
+		http.Error(w, err.Error(), http.StatusConflict)
+		return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	writeJSON(w, http.StatusCreated, col.Info())
+}
+
+// HandleDescribeCollection returns one collection's schema and size
+func (api *API) HandleDescribeCollection(w http.ResponseWriter, r *http.Request) {
+	col, ok := api.collection(w, r)
+	if !ok {
+		return
+	}
+
+	writeJSON(w, http.StatusOK, col.Info())
+}
+
+// HandleDropCollection deletes a collection and all of its data
+func (api *API) HandleDropCollection(w http.ResponseWriter, r *http.Request) {
+	name := r.PathValue("name")
+
+	if err := api.catalog.Drop(name); err != nil {
+		if errors.Is(err, storage.ErrCollectionNotFound) {
+			http.Error(w, err.Error(), http.StatusNotFound)
+			return
+		}
+		http.Error(w, "Failed to drop collection", http.StatusInternalServerError)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, map[string]string{
+		"status": "dropped",
+		"name":   name,
+	})
+}
+
+// HandleCollectionInsert is /insert scoped to one collection
+func (api *API) HandleCollectionInsert(w http.ResponseWriter, r *http.Request) {
+	col, ok := api.collection(w, r)
+	if !ok {
+		return
+	}
+
+	api.insert(w, r, col.Store)
+}
+
+// HandleCollectionInsertBatch is /insert/batch scoped to one collection
+func (api *API) HandleCollectionInsertBatch(w http.ResponseWriter, r *http.Request) {
+	col, ok := api.collection(w, r)
+	if !ok {
+		return
+	}
+
+	api.insertBatch(w, r, col.Store)
+}
+
+// HandleCollectionSearch is /search scoped to one collection
+func (api *API) HandleCollectionSearch(w http.ResponseWriter, r *http.Request) {
+	col, ok := api.collection(w, r)
+	if !ok {
+		return
+	}
+
+	api.search(w, r, col.Store)
+}
+
+// collection resolves the {name} path segment, writing a 404 if it is unknown
+func (api *API) collection(w http.ResponseWriter, r *http.Request) (*storage.Collection, bool) {
+	col, err := api.catalog.Get(r.PathValue("name"))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return nil, false
+	}
+
+	return col, true
+}
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
@@ -17,7 +17,7 @@ func BenchmarkAdaptiveSearch(b *testing.B) {
 		id := strconv.Itoa(i)
 		// We use 1536 bytes because 384 floats * 4 bytes each = 1536
 		data := make([]byte, 1536) 
-		store.Set(id, data, nil)
+		store.Set(id, data, nil, "document "+id+" with some long text")
 	}
 
 	b.ResetTimer()
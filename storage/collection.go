@@ -0,0 +1,390 @@
+package storage
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"sync"
+	"time"
+
+	"flashvector/analysis"
+	"flashvector/metadata"
+	"flashvector/vector"
+	"flashvector/wal"
+)
+
+var (
+	ErrCollectionExists   = errors.New("collection already exists")
+	ErrCollectionNotFound = errors.New("collection not found")
+)
+
+// collectionNamePattern keeps names safe to use as directory names
+var collectionNamePattern = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9_-]{0,63}$`)
+
+// Index types a collection can be created with
+const (
+	IndexIVF    = "ivf"    // int8-quantized IVF, trained once enough data arrives
+	IndexIVFPQ  = "ivfpq"  // IVF with product-quantized codes
+	IndexHNSW   = "hnsw"   // in-memory graph
+	IndexFlat   = "flat"   // brute force
+	IndexBinary = "binary" // flat Hamming search over packed sign bits
+)
+
+// CollectionConfig is the schema a collection is created with. It is
+// written next to the collection's WAL and snapshot and cannot change.
+type CollectionConfig struct {
+	Name        string `json:"name"`
+	Dimension   int    `json:"dimension"`
+	Metric      string `json:"metric"`       // cosine (default), dot, l2, hamming
+	Index       string `json:"index"`        // ivf (default), ivfpq, hnsw, flat, binary
+	ElementType string `json:"element_type"` // float32 (default), float16, binary
+	Subspaces   int    `json:"pq_subspaces"` // ivfpq only; defaults to dimension/8
+
+	// Analyzer is how document text and keyword queries are split into
+	// terms; nil is the standard analyzer
+	Analyzer *analysis.Config `json:"analyzer,omitempty"`
+	BM25     BM25Params       `json:"bm25"`
+
+	// Schema types the metadata fields it names; inserts whose values do
+	// not match are rejected
+	Schema metadata.Schema `json:"schema,omitempty"`
+}
+
+// normalize validates the config and fills in defaults
+func (c *CollectionConfig) normalize() error {
+	if !collectionNamePattern.MatchString(c.Name) {
+		return fmt.Errorf("invalid collection name %q", c.Name)
+	}
+	if c.Dimension < 0 {
+		return fmt.Errorf("vector dimension must be positive, got %d", c.Dimension)
+	}
+
+	elem, err := vector.ParseElementType(c.ElementType)
+	if err != nil {
+		return err
+	}
+	c.ElementType = elem.String()
+
+	if elem == vector.ElementBinary {
+		if c.Index == "" {
+			c.Index = IndexBinary
+		}
+		if c.Metric == "" {
+			c.Metric = vector.MetricHamming.String()
+		}
+	}
+
+	metric, err := vector.ParseMetric(c.Metric)
+	if err != nil {
+		return err
+	}
+	c.Metric = metric.String()
+
+	if c.Index == "" {
+		c.Index = IndexIVF
+	}
+
+	switch c.Index {
+	case IndexIVF, IndexFlat, IndexBinary:
+	case IndexHNSW:
+		if c.Dimension == 0 {
+			return fmt.Errorf("%s collections need a dimension", c.Index)
+		}
+	case IndexIVFPQ:
+		if c.Dimension == 0 {
+			return fmt.Errorf("%s collections need a dimension", c.Index)
+		}
+		if c.Subspaces == 0 {
+			c.Subspaces = c.Dimension / 8
+		}
+		if c.Subspaces <= 0 || c.Dimension%c.Subspaces != 0 {
+			return fmt.Errorf("pq_subspaces %d must divide dimension %d", c.Subspaces, c.Dimension)
+		}
+	default:
+		return fmt.Errorf("unknown index type %q", c.Index)
+	}
+
+	if (elem == vector.ElementBinary) != (c.Index == IndexBinary) {
+		return fmt.Errorf("binary element type requires the binary index")
+	}
+	if (metric == vector.MetricHamming) != (elem == vector.ElementBinary) {
+		return fmt.Errorf("hamming metric requires the binary element type")
+	}
+	if metric == vector.MetricHamming && c.Index == IndexIVFPQ {
+		return fmt.Errorf("%s does not support the hamming metric", c.Index)
+	}
+
+	if c.Analyzer != nil {
+		if _, err := analysis.New(*c.Analyzer); err != nil {
+			return err
+		}
+	}
+	if c.BM25.K1 < 0 || (c.BM25.B != nil && (*c.BM25.B < 0 || *c.BM25.B > 1)) {
+		return fmt.Errorf("bm25 k1 must be positive and b between 0 and 1")
+	}
+	c.BM25 = c.BM25.withDefaults()
+
+	return nil
+}
+
+// storeOptions builds the index the config describes. IVF and binary
+// collections use the store's default index so the dimension can still be
+// taken from the first insert.
+func (c CollectionConfig) storeOptions() Options {
+	metric, _ := vector.ParseMetric(c.Metric)
+	elem, _ := vector.ParseElementType(c.ElementType)
+
+	opts := Options{
+		Dimension:   c.Dimension,
+		Metric:      metric,
+		ElementType: elem,
+		BM25:        c.BM25,
+		Schema:      c.Schema,
+	}
+
+	if c.Analyzer != nil {
+		// validated by normalize
+		opts.Analyzer, _ = analysis.New(*c.Analyzer)
+	}
+
+	switch c.Index {
+	case IndexIVFPQ:
+		opts.Index = vector.NewIVFPQIndex(vector.RandomCentroids(2, c.Dimension), c.Subspaces, 3, metric)
+	case IndexHNSW:
+		opts.Index = vector.NewHNSWIndexWithMetric(c.Dimension, metric, vector.DefaultHNSWM, vector.DefaultHNSWEfConstruction, vector.DefaultHNSWEfSearch)
+	case IndexFlat:
+		opts.Index = vector.NewIndexWithMetric(metric)
+	}
+
+	return opts
+}
+
+// Collection is a named store with its own schema, key space, WAL and snapshot
+type Collection struct {
+	Config CollectionConfig
+	Store  *Store
+
+	dir    string
+	cancel context.CancelFunc
+}
+
+// CollectionInfo describes a collection for listing
+type CollectionInfo struct {
+	CollectionConfig
+	Count int `json:"count"`
+}
+
+// Info reports the collection's schema and size. The dimension is the
+// one in use, which may have come from the first insert.
+func (c *Collection) Info() CollectionInfo {
+	cfg := c.Config
+	cfg.Dimension = c.Store.Dimension()
+
+	return CollectionInfo{CollectionConfig: cfg, Count: c.Store.Len()}
+}
+
+// Catalog owns every collection under one directory, one subdirectory each
+type Catalog struct {
+	mu          sync.RWMutex
+	dir         string
+	ctx         context.Context
+	opts        CatalogOptions
+	collections map[string]*Collection
+}
+
+// CatalogOptions configures every collection of a catalog
+type CatalogOptions struct {
+	// WAL is how each collection's WAL syncs; the zero value is SyncPeriodic
+	WAL wal.Options
+	// SnapshotEvery and SnapshotInterval schedule each collection's
+	// background checkpoints, as in Options
+	SnapshotEvery    int
+	SnapshotInterval time.Duration
+}
+
+// OpenCatalog opens (creating if needed) dir and recovers every collection
+// in it, with default options
+func OpenCatalog(ctx context.Context, dir string) (*Catalog, error) {
+	return OpenCatalogWithOptions(ctx, dir, CatalogOptions{})
+}
+
+// OpenCatalogWithOptions is OpenCatalog with explicit options
+func OpenCatalogWithOptions(ctx context.Context, dir string, opts CatalogOptions) (*Catalog, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, err
+	}
+
+	c := &Catalog{
+		dir:         dir,
+		ctx:         ctx,
+		opts:        opts,
+		collections: make(map[string]*Collection),
+	}
+
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, entry := range entries {
+		if !entry.IsDir() {
+			continue
+		}
+
+		raw, err := os.ReadFile(filepath.Join(dir, entry.Name(), "collection.json"))
+		if err != nil {
+			if os.IsNotExist(err) {
+				continue
+			}
+			return nil, err
+		}
+
+		var cfg CollectionConfig
+		if err := json.Unmarshal(raw, &cfg); err != nil {
+			return nil, fmt.Errorf("collection %s: %w", entry.Name(), err)
+		}
+
+		col, err := c.open(cfg)
+		if err != nil {
+			c.Close()
+			return nil, fmt.Errorf("collection %s: %w", cfg.Name, err)
+		}
+		c.collections[cfg.Name] = col
+	}
+
+	return c, nil
+}
+
+// open starts a collection's WAL and store from its directory
+func (c *Catalog) open(cfg CollectionConfig) (*Collection, error) {
+	if err := cfg.normalize(); err != nil {
+		return nil, err
+	}
+
+	dir := filepath.Join(c.dir, cfg.Name)
+
+	w, err := wal.OpenWithOptions(filepath.Join(dir, "data.wal"), c.opts.WAL)
+	if err != nil {
+		return nil, err
+	}
+
+	ctx, cancel := context.WithCancel(c.ctx)
+
+	opts := cfg.storeOptions()
+	opts.SnapshotPath = filepath.Join(dir, "data.snap")
+	opts.SnapshotEvery = c.opts.SnapshotEvery
+	opts.SnapshotInterval = c.opts.SnapshotInterval
+
+	store, err := NewStoreWithOptions(ctx, w, opts)
+	if err != nil {
+		cancel()
+		w.Close()
+		return nil, err
+	}
+
+	return &Collection{Config: cfg, Store: store, dir: dir, cancel: cancel}, nil
+}
+
+// Create makes a new, empty collection
+func (c *Catalog) Create(cfg CollectionConfig) (*Collection, error) {
+	if err := cfg.normalize(); err != nil {
+		return nil, err
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if _, ok := c.collections[cfg.Name]; ok {
+		return nil, ErrCollectionExists
+	}
+
+	dir := filepath.Join(c.dir, cfg.Name)
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, err
+	}
+
+	raw, err := json.MarshalIndent(cfg, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	if err := os.WriteFile(filepath.Join(dir, "collection.json"), raw, 0644); err != nil {
+		return nil, err
+	}
+
+	col, err := c.open(cfg)
+	if err != nil {
+		os.RemoveAll(dir)
+		return nil, err
+	}
+
+	c.collections[cfg.Name] = col
+	return col, nil
+}
+
+// Get looks up a collection by name
+func (c *Catalog) Get(name string) (*Collection, error) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	col, ok := c.collections[name]
+	if !ok {
+		return nil, ErrCollectionNotFound
+	}
+	return col, nil
+}
+
+// List returns every collection, sorted by name
+func (c *Catalog) List() []*Collection {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	cols := make([]*Collection, 0, len(c.collections))
+	for _, col := range c.collections {
+		cols = append(cols, col)
+	}
+
+	sort.Slice(cols, func(i, j int) bool {
+		return cols[i].Config.Name < cols[j].Config.Name
+	})
+	return cols
+}
+
+// Drop closes a collection and deletes its WAL, snapshot and schema
+func (c *Catalog) Drop(name string) error {
+	c.mu.Lock()
+	col, ok := c.collections[name]
+	delete(c.collections, name)
+	c.mu.Unlock()
+
+	if !ok {
+		return ErrCollectionNotFound
+	}
+
+	col.cancel()
+	if err := col.Store.Close(); err != nil {
+		fmt.Printf("Error closing collection %s: %v\n", name, err)
+	}
+
+	return os.RemoveAll(col.dir)
+}
+
+// Close closes every collection's store and WAL
+func (c *Catalog) Close() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	var firstErr error
+	for _, col := range c.collections {
+		col.cancel()
+		if err := col.Store.Close(); err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+
+	return firstErr
+}
@@ -0,0 +1,193 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+	"time"
+
+	"flashvector/vector"
+	"flashvector/wal"
+)
+
+func TestCollectionsAreIsolated(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+
+	catalog, err := OpenCatalog(ctx, dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	small, err := catalog.Create(CollectionConfig{Name: "small", Dimension: 3, Metric: "l2", Index: IndexFlat})
+	if err != nil {
+		t.Fatal(err)
+	}
+	big, err := catalog.Create(CollectionConfig{Name: "big", Dimension: 16, Index: IndexHNSW})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := catalog.Create(CollectionConfig{Name: "small", Dimension: 3}); !errors.Is(err, ErrCollectionExists) {
+		t.Fatalf("expected ErrCollectionExists, got %v", err)
+	}
+	if _, err := catalog.Create(CollectionConfig{Name: "../escape"}); err == nil {
+		t.Fatalf("expected an invalid name to be rejected")
+	}
+
+	if err := small.Store.Set("doc", floatsToBytesTest([]float32{1, 2, 3}), nil, ""); err != nil {
+		t.Fatal(err)
+	}
+	bigVec := make([]float32, 16)
+	bigVec[0] = 1
+	if err := big.Store.Set("doc", floatsToBytesTest(bigVec), nil, ""); err != nil {
+		t.Fatal(err)
+	}
+
+	// each collection enforces its own dimension
+	if err := small.Store.Set("bad", floatsToBytesTest(bigVec), nil, ""); err == nil {
+		t.Fatalf("expected a 16-dim vector to be rejected by the 3-dim collection")
+	}
+
+	results := small.Store.VectorSearch([]float32{1, 2, 3}, 1, nil)
+	if len(results) != 1 || results[0].Score != 0 {
+		t.Fatalf("expected an exact l2 match, got %v", results)
+	}
+	if small.Store.Metric() != vector.MetricL2 || big.Store.Metric() != vector.MetricCosine {
+		t.Fatalf("collections did not keep their metrics")
+	}
+
+	if err := catalog.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	// reopening recovers schemas and data from each collection's WAL
+	catalog, err = OpenCatalog(ctx, dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer catalog.Close()
+
+	if got := len(catalog.List()); got != 2 {
+		t.Fatalf("expected 2 collections after reopen, got %d", got)
+	}
+
+	small, err = catalog.Get("small")
+	if err != nil {
+		t.Fatal(err)
+	}
+	info := small.Info()
+	if info.Count != 1 || info.Dimension != 3 || info.Metric != "l2" || info.Index != IndexFlat {
+		t.Fatalf("unexpected info after reopen: %+v", info)
+	}
+
+	if err := catalog.Drop("big"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := catalog.Get("big"); !errors.Is(err, ErrCollectionNotFound) {
+		t.Fatalf("expected dropped collection to be gone, got %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "big")); !os.IsNotExist(err) {
+		t.Fatalf("expected dropped collection's directory to be removed")
+	}
+}
+
+func TestCollectionsUseCatalogWALOptions(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+	opts := CatalogOptions{WAL: wal.Options{Sync: wal.SyncAlways}}
+
+	catalog, err := OpenCatalogWithOptions(ctx, dir, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	col, err := catalog.Create(CollectionConfig{Name: "docs", Dimension: 2})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := col.Store.wal.SyncMode(); got != wal.SyncAlways {
+		t.Fatalf("created collection syncs with %v", got)
+	}
+	catalog.Close()
+
+	// and the same once recovered
+	catalog, err = OpenCatalogWithOptions(ctx, dir, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer catalog.Close()
+
+	col, err = catalog.Get("docs")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := col.Store.wal.SyncMode(); got != wal.SyncAlways {
+		t.Fatalf("recovered collection syncs with %v", got)
+	}
+}
+
+func TestCollectionsCheckpointInTheBackground(t *testing.T) {
+	dir := t.TempDir()
+
+	catalog, err := OpenCatalogWithOptions(context.Background(), dir, CatalogOptions{SnapshotEvery: 5})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer catalog.Close()
+
+	col, err := catalog.Create(CollectionConfig{Name: "docs", Dimension: 2})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 10; i++ {
+		if err := col.Store.Set(strconv.Itoa(i), floatsToBytesTest([]float32{1, float32(i)}), nil, ""); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		if _, err := os.Stat(filepath.Join(dir, "docs", "data.snap")); err == nil {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("expected the collection to checkpoint after SnapshotEvery writes")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestIVFPQCollectionsTrainAsTheyGrow(t *testing.T) {
+	catalog, err := OpenCatalogWithOptions(context.Background(), t.TempDir(), CatalogOptions{SnapshotEvery: 100})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer catalog.Close()
+
+	col, err := catalog.Create(CollectionConfig{Name: "docs", Dimension: 16, Index: IndexIVFPQ, Subspaces: 4})
+	if err != nil {
+		t.Fatal(err)
+	}
+	pq := col.Store.index.(*vector.IVFPQIndex)
+
+	for i := 0; i < minTrainingVectors; i++ {
+		vec := make([]float32, 16)
+		vec[i%16] = 1
+		vec[(i*7)%16] += float32(i%10) / 10
+		if err := col.Store.Set(strconv.Itoa(i), floatsToBytesTest(vec), nil, ""); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// trained by the checkpointer, not by reopening the collection
+	deadline := time.Now().Add(10 * time.Second)
+	for !pq.Trained() {
+		if time.Now().After(deadline) {
+			t.Fatal("expected the collection to train its quantizer once it held enough vectors")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
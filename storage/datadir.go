@@ -0,0 +1,224 @@
+package storage
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"flashvector/wal"
+)
+
+// Data directory layout (version 1):
+//
+//	<dir>/MANIFEST             layout version and owning node, JSON
+//	<dir>/LOCK                 held for as long as a process has the directory open
+//	<dir>/wal/                 write-ahead log
+//	<dir>/snapshots/data.snap  latest snapshot
+//	<dir>/snapshots/data.index index persisted with that snapshot
+//	<dir>/collections/<name>/  one directory per named collection
+const (
+	dataDirLayoutVersion = 1
+
+	manifestFile    = "MANIFEST"
+	lockFile        = "LOCK"
+	walDir          = "wal"
+	snapshotsDir    = "snapshots"
+	collectionsDir  = "collections"
+	walFile         = "data.wal"
+	snapshotFile    = "data.snap"
+	legacyIndexFile = "data.index"
+)
+
+var ErrDataDirLocked = errors.New("data directory is in use by another process")
+
+// ErrLegacyWAL is returned for a directory whose data.wal predates the
+// segmented log. This version cannot replay it, so its records have to be
+// folded into data.snap by the release that wrote it first.
+var ErrLegacyWAL = errors.New("legacy WAL, run migration")
+
+// Manifest describes a data directory. It is written once when the
+// directory is created and checked every time it is opened.
+type Manifest struct {
+	Version   int       `json:"version"`
+	NodeID    string    `json:"node_id,omitempty"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// DataDir is an open, locked data directory. Paths for the WAL, snapshots
+// and collections all come from here so several nodes (or tests) can run
+// side by side in different directories.
+type DataDir struct {
+	path     string
+	lock     *os.File
+	manifest Manifest
+}
+
+// OpenDataDir creates or opens the data directory at path and locks it.
+// A nodeID, if given, must match the one recorded in the manifest. Files
+// from the original flat layout (data.wal and data.snap directly in path)
+// are moved into place the first time the directory is opened.
+func OpenDataDir(path string, nodeID string) (*DataDir, error) {
+	if path == "" {
+		path = "."
+	}
+
+	if err := os.MkdirAll(path, 0755); err != nil {
+		return nil, err
+	}
+
+	lock, err := lockDir(filepath.Join(path, lockFile))
+	if err != nil {
+		return nil, err
+	}
+
+	d := &DataDir{path: path, lock: lock}
+
+	if err := d.init(nodeID); err != nil {
+		d.Close()
+		return nil, err
+	}
+
+	return d, nil
+}
+
+func (d *DataDir) init(nodeID string) error {
+	for _, sub := range []string{walDir, snapshotsDir, collectionsDir} {
+		if err := os.MkdirAll(filepath.Join(d.path, sub), 0755); err != nil {
+			return err
+		}
+	}
+
+	raw, err := os.ReadFile(filepath.Join(d.path, manifestFile))
+	if err == nil {
+		if err := json.Unmarshal(raw, &d.manifest); err != nil {
+			return fmt.Errorf("%s: %w", manifestFile, err)
+		}
+		if d.manifest.Version != dataDirLayoutVersion {
+			return fmt.Errorf("data directory layout version %d is not supported (want %d)", d.manifest.Version, dataDirLayoutVersion)
+		}
+		if nodeID != "" && d.manifest.NodeID != "" && nodeID != d.manifest.NodeID {
+			return fmt.Errorf("data directory belongs to node %q, not %q", d.manifest.NodeID, nodeID)
+		}
+		return nil
+	}
+
+	if !os.IsNotExist(err) {
+		return err
+	}
+
+	if err := d.migrateLegacy(); err != nil {
+		return err
+	}
+
+	d.manifest = Manifest{
+		Version:   dataDirLayoutVersion,
+		NodeID:    nodeID,
+		CreatedAt: time.Now().UTC(),
+	}
+
+	raw, err = json.MarshalIndent(d.manifest, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	// the manifest goes last, so a crash during setup is simply retried
+	return writeFileAtomic(filepath.Join(d.path, manifestFile), func(f *os.File) error {
+		_, err := f.Write(raw)
+		return err
+	})
+}
+
+// migrateLegacy moves data.wal (with its rolled segments), data.snap and
+// data.index from the top of the directory into the layout. A data.wal
+// that is not a segment is refused before anything is moved, so the
+// directory is left as it was.
+func (d *DataDir) migrateLegacy() error {
+	from := filepath.Join(d.path, walFile)
+
+	info, err := os.Stat(from)
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+
+	if err == nil && info.Size() > 0 {
+		ok, err := wal.IsSegment(from)
+		if err != nil {
+			return fmt.Errorf("%s: %w", from, err)
+		}
+		if !ok {
+			return fmt.Errorf("%s: %w", from, ErrLegacyWAL)
+		}
+	}
+
+	moves := map[string]string{
+		walFile:         d.WALPath(),
+		snapshotFile:    d.SnapshotPath(),
+		legacyIndexFile: indexPathFor(d.SnapshotPath()),
+	}
+
+	rolled, err := filepath.Glob(from + ".*")
+	if err != nil {
+		return err
+	}
+	for _, path := range rolled {
+		name := filepath.Base(path)
+		moves[name] = filepath.Join(d.WALDir(), name)
+	}
+
+	for from, to := range moves {
+		from = filepath.Join(d.path, from)
+
+		if _, err := os.Stat(from); os.IsNotExist(err) {
+			continue
+		}
+		if err := os.Rename(from, to); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Path is the root of the data directory
+func (d *DataDir) Path() string {
+	return d.path
+}
+
+// Manifest returns the manifest the directory was opened with
+func (d *DataDir) Manifest() Manifest {
+	return d.manifest
+}
+
+// WALDir holds the write-ahead log
+func (d *DataDir) WALDir() string {
+	return filepath.Join(d.path, walDir)
+}
+
+// WALPath is the log file inside WALDir
+func (d *DataDir) WALPath() string {
+	return filepath.Join(d.WALDir(), walFile)
+}
+
+// SnapshotPath is the latest snapshot; the persisted index sits next to it
+func (d *DataDir) SnapshotPath() string {
+	return filepath.Join(d.path, snapshotsDir, snapshotFile)
+}
+
+// CollectionsPath is the directory for OpenCatalog
+func (d *DataDir) CollectionsPath() string {
+	return filepath.Join(d.path, collectionsDir)
+}
+
+// Close releases the lock; stores using the directory should be closed first
+func (d *DataDir) Close() error {
+	if d.lock == nil {
+		return nil
+	}
+
+	err := unlockDir(d.lock)
+	d.lock = nil
+	return err
+}
@@ -0,0 +1,176 @@
+package storage
+
+import (
+	"context"
+	"encoding/gob"
+	"errors"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+
+	"flashvector/wal"
+)
+
+func TestDataDirLock(t *testing.T) {
+	dir := t.TempDir()
+
+	d, err := OpenDataDir(dir, "node-1")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := OpenDataDir(dir, "node-1"); !errors.Is(err, ErrDataDirLocked) {
+		t.Fatalf("expected the second open to be refused, got %v", err)
+	}
+
+	if err := d.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	d, err = OpenDataDir(dir, "node-1")
+	if err != nil {
+		t.Fatalf("expected reopen after close to succeed: %v", err)
+	}
+	if d.Manifest().NodeID != "node-1" || d.Manifest().Version != dataDirLayoutVersion {
+		t.Fatalf("unexpected manifest %+v", d.Manifest())
+	}
+	d.Close()
+
+	if _, err := OpenDataDir(dir, "node-2"); err == nil {
+		t.Fatalf("expected another node's directory to be refused")
+	}
+}
+
+func TestDataDirMigratesFlatLayout(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+
+	// a snapshot written by an older build straight into the directory
+	store, _ := NewStore(ctx, nil)
+	if err := store.Set("a", floatsToBytesTest([]float32{1, 2}), nil, ""); err != nil {
+		t.Fatal(err)
+	}
+	if err := store.SaveSnapShot(filepath.Join(dir, "data.snap")); err != nil {
+		t.Fatal(err)
+	}
+
+	d, err := OpenDataDir(dir, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer d.Close()
+
+	if _, err := os.Stat(filepath.Join(dir, "data.snap")); !os.IsNotExist(err) {
+		t.Fatalf("expected data.snap to be moved into the layout")
+	}
+
+	restored, err := NewStoreWithOptions(ctx, nil, Options{SnapshotPath: d.SnapshotPath()})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, _, ok := restored.Get("a"); !ok {
+		t.Fatalf("expected the migrated snapshot to load")
+	}
+}
+
+func TestDataDirRefusesLegacyWAL(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+
+	// the layout from before the series: an unversioned snapshot and a
+	// single-file log of bare records next to it
+	file, err := os.Create(filepath.Join(dir, "data.snap"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := gob.NewEncoder(file).Encode(map[string][]byte{"old": floatsToBytesTest([]float32{1, 2})}); err != nil {
+		t.Fatal(err)
+	}
+	file.Close()
+	if err := os.WriteFile(filepath.Join(dir, "data.wal"), []byte("{\"op\":\"set\",\"key\":\"new\"}\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	for range 2 {
+		if _, err := OpenDataDir(dir, ""); !errors.Is(err, ErrLegacyWAL) {
+			t.Fatalf("expected the legacy WAL to be refused, got %v", err)
+		}
+	}
+	for _, name := range []string{"data.wal", "data.snap"} {
+		if _, err := os.Stat(filepath.Join(dir, name)); err != nil {
+			t.Fatalf("expected %s to be left in place: %v", name, err)
+		}
+	}
+	if _, err := os.Stat(filepath.Join(dir, "MANIFEST")); !os.IsNotExist(err) {
+		t.Fatalf("expected no manifest for a refused directory")
+	}
+
+	// once the log has been migrated away the snapshot moves in as usual
+	if err := os.Remove(filepath.Join(dir, "data.wal")); err != nil {
+		t.Fatal(err)
+	}
+	d, err := OpenDataDir(dir, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer d.Close()
+
+	store, err := NewStoreWithOptions(ctx, nil, Options{SnapshotPath: d.SnapshotPath()})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, _, ok := store.Get("old"); !ok {
+		t.Fatalf("expected the legacy snapshot to load")
+	}
+}
+
+func TestDataDirMigratesRolledSegments(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+
+	// a segmented log written straight into the directory, rolled a few times
+	w, err := wal.OpenWithOptions(filepath.Join(dir, "data.wal"), wal.Options{SegmentSize: 256})
+	if err != nil {
+		t.Fatal(err)
+	}
+	store, _ := NewStore(ctx, w)
+	for i := 0; i < 20; i++ {
+		if err := store.Set("key-"+strconv.Itoa(i), floatsToBytesTest([]float32{float32(i), 1}), nil, ""); err != nil {
+			t.Fatal(err)
+		}
+	}
+	store.Close()
+	w.Close()
+
+	if rolled, _ := filepath.Glob(filepath.Join(dir, "data.wal.*")); len(rolled) == 0 {
+		t.Fatalf("expected the log to have rolled")
+	}
+
+	d, err := OpenDataDir(dir, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer d.Close()
+
+	if rolled, _ := filepath.Glob(filepath.Join(dir, "data.wal*")); len(rolled) != 0 {
+		t.Fatalf("expected every segment to be moved, left %v", rolled)
+	}
+
+	w, err = wal.OpenWithOptions(d.WALPath(), wal.Options{SegmentSize: 256})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer w.Close()
+
+	restored, err := NewStore(ctx, w)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer restored.Close()
+	for i := 0; i < 20; i++ {
+		if _, _, ok := restored.Get("key-" + strconv.Itoa(i)); !ok {
+			t.Fatalf("expected key-%d to be replayed from the migrated log", i)
+		}
+	}
+}
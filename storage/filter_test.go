@@ -2,12 +2,22 @@ package storage
 
 import (
 	"context"
+	"sort"
+	"strings"
 	"testing"
+
+	"flashvector/metadata"
+	"flashvector/query"
+	"flashvector/vector"
 )
 
 func TestMetadataFiltering(t *testing.T) {
 	ctx := context.Background()
-	store, _ := NewStore(ctx, nil)
+	store, err := NewStore(ctx, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { store.Close() })
 
 	// 1. Create Dummy Vectors
 	// We use the same vector for both so they are identical in similarity.
@@ -16,13 +26,13 @@ func TestMetadataFiltering(t *testing.T) {
 	vecData[0] = 1 // Just some data
 
 	// 2. Insert Data with Metadata
-	metaCat := map[string]string{"type": "cat", "name": "Whiskers"}
-	metaDog := map[string]string{"type": "dog", "name": "Buddy"}
+	metaCat := metadata.Strings(map[string]string{"type": "cat", "name": "Whiskers"})
+	metaDog := metadata.Strings(map[string]string{"type": "dog", "name": "Buddy"})
 
-	if err := store.Set("cat1", vecData, metaCat); err != nil {
+	if err := store.Set("cat1", vecData, metaCat, ""); err != nil {
 		t.Fatal(err)
 	}
-	if err := store.Set("dog1", vecData, metaDog); err != nil {
+	if err := store.Set("dog1", vecData, metaDog, ""); err != nil {
 		t.Fatal(err)
 	}
 
@@ -59,4 +69,62 @@ func TestMetadataFiltering(t *testing.T) {
 	if len(results3) != 0 {
 		t.Errorf("Expected 0 results for 'bird', got %d", len(results3))
 	}
-}
\ No newline at end of file
+}
+
+func TestFilterAcrossSearches(t *testing.T) {
+	store, err := NewStore(context.Background(), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { store.Close() })
+
+	docs := []struct {
+		id       string
+		severity string
+		text     string
+	}{
+		{"a", "1", "burst pipe"},
+		{"b", "3", "burst pipe on the main road"},
+		{"c", "5", "leaking pipe"},
+	}
+	for _, d := range docs {
+		if err := store.Set(d.id, floatsToBytesTest([]float32{1, 0}), Metadata{"severity": metadata.StringValue(d.severity)}, d.text); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	filter, err := query.ParseFilter([]byte(`{"field": "severity", "gte": 2}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ids := func(results []vector.Result) string {
+		out := make([]string, len(results))
+		for i, r := range results {
+			out[i] = r.ID
+		}
+		sort.Strings(out)
+		return strings.Join(out, ",")
+	}
+
+	if got := ids(store.VectorSearchWithOptions([]float32{1, 0}, 10, nil, SearchOptions{Filter: filter})); got != "b,c" {
+		t.Fatalf("vector search: got %s", got)
+	}
+	// the map and the filter both apply
+	if got := ids(store.VectorSearchWithOptions([]float32{1, 0}, 10, map[string]string{"severity": "5"}, SearchOptions{Filter: filter})); got != "c" {
+		t.Fatalf("vector search with map: got %s", got)
+	}
+
+	store.View(func(v View) {
+		if got := ids(v.KeywordSearch("pipe", 10, filter)); got != "b,c" {
+			t.Errorf("keyword search: got %s", got)
+		}
+		// filtering before ranking still fills k
+		if got := ids(v.KeywordSearch("burst", 1, filter)); got != "b" {
+			t.Errorf("keyword search with k=1: got %s", got)
+		}
+		if got := ids(v.AdaptiveSearch("burst", []float32{1, 0}, 10, 60, filter)); got != "b,c" {
+			t.Errorf("hybrid search: got %s", got)
+		}
+	})
+}
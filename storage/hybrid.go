@@ -1,12 +1,23 @@
 package storage
 
 import (
+	"flashvector/query"
 	"flashvector/vector"
 	"sync"
 )
  
 //explain
 func (s *Store) AdaptiveSearch(text string, queryVector []float32, k int, rrfWeight int) []vector.Result {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	return s.adaptiveSearchLocked(text, queryVector, k, rrfWeight, nil)
+}
+
+// adaptiveSearchLocked runs both legs under the caller's read lock, each
+// restricted by filter when it is set
+func (s *Store) adaptiveSearchLocked(text string, queryVector []float32, k int, rrfWeight int, filter query.Filter) []vector.Result {
+	predicate := s.predicateLocked(nil, filter)
 
 	var keywordResults []vector.Result
 	var vectorResults []vector.Result
@@ -16,12 +27,12 @@ func (s *Store) AdaptiveSearch(text string, queryVector []float32, k int, rrfWei
 
 	go func() {
 		defer wg.Done()
-		keywordResults = s.KeywordSearch(text, k)
+		keywordResults = s.keyword.search(text, k, predicate)
 	}()
 
 	go func() {
 		defer wg.Done()
-		vectorResults = s.VectorSearch(queryVector, k, nil)
+		vectorResults = s.vectorSearchLocked(queryVector, k, nil, SearchOptions{Filter: filter})
 	}()
 
 	wg.Wait()
@@ -2,62 +2,203 @@ package storage
 
 
 import(
-	"strings"
-	"unicode"
+	"maps"
+	"math"
+	"slices"
 	"sort"
 
+	"flashvector/analysis"
+	"flashvector/query"
 	"flashvector/vector"
 )
 
-func tokenize(text string) []string{
-	return strings.FieldsFunc(strings.ToLower(text),func(r rune)bool{
-		return !unicode.IsLetter(r) && !unicode.IsNumber(r)
-	})
+// BM25Params tunes keyword scoring. K1 is how quickly repeated terms stop
+// adding score; B is how strongly long documents are penalized (0 to 1).
+// A zero K1 or nil B takes the default; B may be 0, which turns length
+// normalization off.
+type BM25Params struct{
+	K1 float64 `json:"k1,omitempty"`
+	B *float64 `json:"b,omitempty"`
 }
 
+// The usual Lucene defaults
+const (
+	DefaultBM25K1 = 1.2
+	DefaultBM25B = 0.75
+)
 
-func (s *Store) KeywordSearch(query string ,k int)[]vector.Result{
-	s.mu.RLock()
-	defer s.mu.RUnlock()
+// withDefaults fills in the defaults, B included when it is out of range.
+// The result has its own B, never the caller's.
+func (p BM25Params) withDefaults() BM25Params{
+	if p.K1 <= 0{
+		p.K1 = DefaultBM25K1
+	}
+	b := DefaultBM25B
+	if p.B != nil && *p.B >= 0 && *p.B <= 1{
+		b = *p.B
+	}
+	p.B = &b
+	return p
+}
 
-	// tokenise query
-	queryTokens := tokenize(query)
+// keywordIndex is an inverted index over document text. Postings hold the
+// positions of a term in each document, in order: their count is the term
+// frequency BM25 needs, and phrases match on consecutive positions. A
+// position counts analyzed terms, so stopwords the analyzer drops leave no
+// gap. It is guarded by the store lock.
+type keywordIndex struct{
+	analyzer *analysis.Analyzer
+	params BM25Params
 
-	if len(queryTokens) == 0{
-		return nil
+	postings map[string]map[string][]int32 // term -> doc -> positions
+	docLen map[string]int                  // terms per doc
+	totalLen int
+
+	// after state, the snapshot shares postings and docLen until the next
+	// change copies them; owned holds the terms whose documents have been
+	// copied since. nil owned means no snapshot shares anything.
+	shared bool
+	owned map[string]bool
+}
+
+// keywordState is a keywordIndex as persisted in snapshots. Snapshots from
+// before positions were kept have term frequencies in a Postings field
+// instead, which decoding skips; those indexes are rebuilt from the text.
+type keywordState struct{
+	Analyzer analysis.Config
+	Positions map[string]map[string][]int32
+	DocLen map[string]int
+}
+
+func newKeywordIndex(analyzer *analysis.Analyzer,params BM25Params) *keywordIndex{
+	if analyzer == nil{
+		analyzer = analysis.Standard()
 	}
 
-	results := make([]vector.Result,0)
+	return &keywordIndex{
+		analyzer: analyzer,
+		params: params.withDefaults(),
+		postings: make(map[string]map[string][]int32),
+		docLen: make(map[string]int),
+	}
+}
 
-	// iterate over all stored doc
-	for id,value := range s.data{
-		text := string(value)
-		docTokens := tokenize(text)
+// add indexes a document's text; the document must not be indexed already
+func (ki *keywordIndex) add(id string,text string){
+	terms := ki.analyzer.Analyze(text)
+	if len(terms) == 0{
+		return
+	}
 
-		// count matches
-		score := 0
+	ki.unshare()
+	for pos,term := range terms{
+		docs := ki.termDocs(term)
+		docs[id] = append(docs[id],int32(pos))
+	}
 
-		for _,qt := range queryTokens{
-			for _,dt := range docTokens{
-				if qt == dt{
-					score++
-				}
-			}
+	ki.docLen[id] = len(terms)
+	ki.totalLen += len(terms)
+}
+
+// remove drops a document, given the text it was indexed with. Analyzing
+// it again finds its postings without keeping a term list per document.
+func (ki *keywordIndex) remove(id string,text string){
+	n,ok := ki.docLen[id]
+	if !ok{
+		return
+	}
+
+	ki.unshare()
+	for _,term := range ki.analyzer.Analyze(text){
+		if _,ok := ki.postings[term]; !ok{
+			continue
 		}
-		// keep only matching doc
-		if score > 0{
-			results = append(results, vector.Result{
-				ID : id,
-				Score : float32(score),
-			})
+		docs := ki.termDocs(term)
+		delete(docs,id)
+		if len(docs) == 0{
+			delete(ki.postings,term)
 		}
+	}
+
+	delete(ki.docLen,id)
+	ki.totalLen -= n
+}
+
+// unshare copies the maps a snapshot holds before they change
+func (ki *keywordIndex) unshare(){
+	if !ki.shared{
+		return
+	}
+	ki.postings = maps.Clone(ki.postings)
+	ki.docLen = maps.Clone(ki.docLen)
+	ki.shared = false
+}
+
+// termDocs returns a term's postings ready to change, copied first if a
+// snapshot may still hold them. Caller has called unshare.
+func (ki *keywordIndex) termDocs(term string) map[string][]int32{
+	docs,ok := ki.postings[term]
+	switch{
+	case !ok:
+		docs = make(map[string][]int32)
+	case ki.owned != nil && !ki.owned[term]:
+		docs = maps.Clone(docs)
+	default:
+		return docs
+	}
+
+	ki.postings[term] = docs
+	if ki.owned != nil{
+		ki.owned[term] = true
+	}
+	return docs
+}
+
+// rebuild reindexes every document from scratch
+func (ki *keywordIndex) rebuild(texts map[string]string){
+	ki.postings = make(map[string]map[string][]int32)
+	ki.docLen = make(map[string]int,len(texts))
+	ki.totalLen = 0
+	ki.shared,ki.owned = false,nil
+
+	for id,text := range texts{
+		ki.add(id,text)
+	}
+}
+
+// search runs a keyword query (see query.ParseKeywordQuery) and returns
+// the k best documents by BM25, highest score first. Filter, when not nil,
+// drops documents before they are ranked.
+func (ki *keywordIndex) search(q string,k int,filter func(id string) bool) []vector.Result{
+	if len(ki.docLen) == 0{
+		return nil
+	}
+
+	n := float64(len(ki.docLen))
+	ks := keywordSearch{
+		ki: ki,
+		n: n,
+		avgLen: float64(ki.totalLen) / n,
+	}
+
+	scores,_ := ks.boolean(query.ParseKeywordQuery(q))
 
+	results := make([]vector.Result,0,len(scores))
+	for id,score := range scores{
+		if filter != nil && !filter(id){
+			continue
+		}
+		results = append(results,vector.Result{ID: id,Score: float32(score)})
 	}
-	// sort by score
+
+	// sort by score, ties by id so results are stable
 	sort.Slice(results,func(i ,j int)bool{
-		return results[i].Score>results[j].Score
+		if results[i].Score != results[j].Score{
+			return results[i].Score>results[j].Score
+		}
+		return results[i].ID < results[j].ID
 	})
-	
+
 	if len(results) > k{
 		return results[:k]
 	}
@@ -65,3 +206,372 @@ func (s *Store) KeywordSearch(query string ,k int)[]vector.Result{
 	return results
 }
 
+// keywordSearch evaluates one query against a keywordIndex
+type keywordSearch struct{
+	ki *keywordIndex
+	n float64
+	avgLen float64
+}
+
+// boolean combines clauses: every Must clause has to match and no MustNot
+// clause may; Should clauses add to the score, and when nothing is
+// required at least one of them has to match. The bool is false when no
+// clause had a searchable term (only stopwords, say), so the caller can
+// ignore it rather than match nothing.
+func (ks *keywordSearch) boolean(clauses []query.Clause) (map[string]float64,bool){
+	var must,should,mustNot []map[string]float64
+
+	for _,c := range clauses{
+		scores,ok := ks.clause(c)
+		if !ok{
+			continue
+		}
+
+		switch c.Occur{
+		case query.Must:
+			must = append(must,scores)
+		case query.MustNot:
+			mustNot = append(mustNot,scores)
+		default:
+			should = append(should,scores)
+		}
+	}
+
+	if len(must) == 0 && len(should) == 0{
+		// exclusions alone match nothing
+		return map[string]float64{},len(mustNot) > 0
+	}
+
+	out := make(map[string]float64)
+	if len(must) > 0{
+		for id,score := range must[0]{
+			out[id] = score
+		}
+		for _,scores := range must[1:]{
+			for id := range out{
+				score,ok := scores[id]
+				if !ok{
+					delete(out,id)
+					continue
+				}
+				out[id] += score
+			}
+		}
+		for _,scores := range should{
+			for id := range out{
+				out[id] += scores[id]
+			}
+		}
+	}else{
+		for _,scores := range should{
+			for id,score := range scores{
+				out[id] += score
+			}
+		}
+	}
+
+	for _,scores := range mustNot{
+		for id := range scores{
+			delete(out,id)
+		}
+	}
+
+	return out,true
+}
+
+// clause scores the documents one clause matches
+func (ks *keywordSearch) clause(c query.Clause) (map[string]float64,bool){
+	switch{
+	case c.Group != nil:
+		return ks.boolean(c.Group)
+	case c.Phrase != "":
+		return ks.phrase(ks.ki.analyzer.Analyze(c.Phrase))
+	}
+
+	terms := ks.ki.analyzer.Analyze(c.Term)
+	if len(terms) == 1 && c.Fuzzy > 0{
+		return ks.fuzzy(terms[0],c.Fuzzy),true
+	}
+
+	// a word the analyzer splits (e-mail, vec-12) must keep its parts together
+	return ks.phrase(terms)
+}
+
+// term scores every document holding term with BM25
+func (ks *keywordSearch) term(term string) map[string]float64{
+	docs := ks.ki.postings[term]
+	scores := make(map[string]float64,len(docs))
+	if len(docs) == 0{
+		return scores
+	}
+
+	k1,b := ks.ki.params.K1,*ks.ki.params.B
+	df := float64(len(docs))
+	idf := math.Log(1 + (ks.n-df+0.5)/(df+0.5))
+
+	for id,positions := range docs{
+		f := float64(len(positions))
+		norm := k1 * (1 - b + b*float64(ks.ki.docLen[id])/ks.avgLen)
+		scores[id] = idf * f * (k1 + 1) / (f + norm)
+	}
+
+	return scores
+}
+
+// phrase matches documents holding terms next to each other and in order,
+// scored as the sum of the terms. Documents with every term are checked
+// for a run of consecutive positions.
+func (ks *keywordSearch) phrase(terms []string) (map[string]float64,bool){
+	switch len(terms){
+	case 0:
+		return nil,false
+	case 1:
+		return ks.term(terms[0]),true
+	}
+
+	perTerm := make(map[string]map[string]float64,len(terms))
+	for _,term := range terms{
+		if _,ok := perTerm[term]; !ok{
+			perTerm[term] = ks.term(term)
+		}
+	}
+
+	out := make(map[string]float64)
+	for id := range perTerm[terms[0]]{
+		score := 0.0
+		for _,scores := range perTerm{
+			s,ok := scores[id]
+			if !ok{
+				score = -1
+				break
+			}
+			score += s
+		}
+
+		if score >= 0 && ks.ki.hasRun(id,terms){
+			out[id] = score
+		}
+	}
+
+	return out,true
+}
+
+// fuzzy matches indexed terms within edits of term. Each document keeps
+// its best matching term, scored lower the more edits it took.
+func (ks *keywordSearch) fuzzy(term string,edits int) map[string]float64{
+	out := make(map[string]float64)
+	n := float64(len([]rune(term)))
+
+	for candidate,d := range ks.ki.fuzzyTerms(term,edits){
+		weight := 1 - float64(d)/(n+1)
+		for id,score := range ks.term(candidate){
+			if score *= weight; score > out[id]{
+				out[id] = score
+			}
+		}
+	}
+
+	return out
+}
+
+// fuzzyTerms returns the indexed terms within edits of term and how many
+// edits each is away
+func (ki *keywordIndex) fuzzyTerms(term string,edits int) map[string]int{
+	want := []rune(term)
+	out := make(map[string]int)
+
+	for candidate := range ki.postings{
+		got := []rune(candidate)
+		if abs(len(got)-len(want)) > edits{
+			continue
+		}
+		if d := editDistance(want,got); d <= edits{
+			out[candidate] = d
+		}
+	}
+
+	return out
+}
+
+// matchTerms collects the terms a query looks for, fuzzy terms expanded to
+// what they match in the index. Excluded clauses are left out.
+func (ki *keywordIndex) matchTerms(clauses []query.Clause,terms map[string]bool){
+	for _,c := range clauses{
+		switch{
+		case c.Occur == query.MustNot:
+		case c.Group != nil:
+			ki.matchTerms(c.Group,terms)
+		case c.Phrase != "":
+			for _,term := range ki.analyzer.Analyze(c.Phrase){
+				terms[term] = true
+			}
+		default:
+			analyzed := ki.analyzer.Analyze(c.Term)
+			if len(analyzed) == 1 && c.Fuzzy > 0{
+				for term := range ki.fuzzyTerms(analyzed[0],c.Fuzzy){
+					terms[term] = true
+				}
+				continue
+			}
+			for _,term := range analyzed{
+				terms[term] = true
+			}
+		}
+	}
+}
+
+// hasRun reports whether terms appear in the document at consecutive
+// positions
+func (ki *keywordIndex) hasRun(id string,terms []string) bool{
+	runs := make([][]int32,len(terms))
+	for i,term := range terms{
+		runs[i] = ki.postings[term][id]
+	}
+
+	for _,start := range runs[0]{
+		match := true
+		for i := 1; i < len(runs); i++{
+			if _,ok := slices.BinarySearch(runs[i],start+int32(i)); !ok{
+				match = false
+				break
+			}
+		}
+		if match{
+			return true
+		}
+	}
+
+	return false
+}
+
+// editDistance is the Levenshtein distance between a and b, counting a
+// swap of neighbouring letters as one edit the way typos usually happen
+func editDistance(a ,b []rune) int{
+	prev2 := make([]int,len(b)+1)
+	prev := make([]int,len(b)+1)
+	cur := make([]int,len(b)+1)
+	for j := range prev{
+		prev[j] = j
+	}
+
+	for i := 1; i <= len(a); i++{
+		cur[0] = i
+		for j := 1; j <= len(b); j++{
+			cost := 1
+			if a[i-1] == b[j-1]{
+				cost = 0
+			}
+			cur[j] = min(prev[j]+1,cur[j-1]+1,prev[j-1]+cost)
+			if i > 1 && j > 1 && a[i-1] == b[j-2] && a[i-2] == b[j-1]{
+				cur[j] = min(cur[j],prev2[j-2]+1)
+			}
+		}
+		prev2,prev,cur = prev,cur,prev2
+	}
+
+	return prev[len(b)]
+}
+
+func abs(x int) int{
+	if x < 0{
+		return -x
+	}
+	return x
+}
+
+// state hands the index to a snapshot without copying it: later changes
+// copy what they touch instead. Nil when the analyzer is a custom chain
+// whose output cannot be checked on load. Caller holds the store's read
+// lock and checkpointMu, so no change or other state runs alongside.
+func (ki *keywordIndex) state() *keywordState{
+	cfg,ok := ki.analyzer.Config()
+	if !ok{
+		return nil
+	}
+
+	ki.shared = true
+	ki.owned = make(map[string]bool)
+
+	return &keywordState{Analyzer: cfg,Positions: ki.postings,DocLen: ki.docLen}
+}
+
+// restore loads a persisted index if it was built by the same analyzer
+// chain and only covers documents that have text
+func (ki *keywordIndex) restore(st *keywordState,texts map[string]string) bool{
+	cfg,ok := ki.analyzer.Config()
+	if st == nil || !ok || st.Analyzer != cfg{
+		return false
+	}
+	if st.Positions == nil && len(st.DocLen) > 0{
+		return false
+	}
+
+	total := 0
+	for id,n := range st.DocLen{
+		if _,ok := texts[id]; !ok{
+			return false
+		}
+		total += n
+	}
+
+	ki.postings = st.Positions
+	ki.docLen = st.DocLen
+	ki.totalLen = total
+	ki.shared,ki.owned = false,nil
+	if ki.postings == nil{
+		ki.postings = make(map[string]map[string][]int32)
+	}
+	if ki.docLen == nil{
+		ki.docLen = make(map[string]int)
+	}
+
+	return true
+}
+
+// KeywordSearch ranks documents by BM25 over their text, analyzed the same
+// way as the query. The query may use phrases, +/- and OR groups and fuzzy
+// terms; see query.ParseKeywordQuery.
+func (s *Store) KeywordSearch(query string ,k int)[]vector.Result{
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	return s.keyword.search(query,k,nil)
+}
+
+// Highlight is why a document matched a keyword query: where the query
+// terms are in its text and a snippet with them marked
+type Highlight struct{
+	Offsets []analysis.Span `json:"offsets,omitempty"`
+	Snippet string `json:"snippet"`
+}
+
+// Highlight finds the query's terms in the text of each document, using the
+// analyzer the text was indexed with. Phrase words are marked wherever they
+// occur. Documents without text get an empty Highlight.
+func (s *Store) Highlight(q string,ids []string,opts analysis.SnippetOptions) []Highlight{
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	return s.highlightLocked(q,ids,opts)
+}
+
+func (s *Store) highlightLocked(q string,ids []string,opts analysis.SnippetOptions) []Highlight{
+	terms := make(map[string]bool)
+	s.keyword.matchTerms(query.ParseKeywordQuery(q),terms)
+
+	out := make([]Highlight,len(ids))
+	for i,id := range ids{
+		text,ok := s.text[id]
+		if !ok{
+			continue
+		}
+
+		spans := s.keyword.analyzer.Spans(text,terms)
+		out[i] = Highlight{
+			Offsets: spans,
+			Snippet: analysis.Snippet(text,spans,opts),
+		}
+	}
+
+	return out
+}
@@ -0,0 +1,357 @@
+package storage
+
+import (
+	"context"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"testing"
+
+	"flashvector/analysis"
+	"flashvector/wal"
+)
+
+func TestKeywordSearchUsesText(t *testing.T) {
+	dir := t.TempDir()
+	walPath := filepath.Join(dir, "data.wal")
+	snapPath := filepath.Join(dir, "data.snap")
+	ctx := context.Background()
+
+	w, err := wal.Open(walPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	store, err := NewStoreWithOptions(ctx, w, Options{SnapshotPath: snapPath})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := store.Set("fox", floatsToBytesTest([]float32{1, 0}), nil, "The quick brown fox"); err != nil {
+		t.Fatal(err)
+	}
+	if err := store.SaveSnapShot(snapPath); err != nil {
+		t.Fatal(err)
+	}
+
+	// after the snapshot, so this one comes back from the WAL
+	if _, err := store.SetBatch([]BatchItem{{Key: "dog", Value: floatsToBytesTest([]float32{0, 1}), Text: "A lazy brown dog"}}); err != nil {
+		t.Fatal(err)
+	}
+	// no text: only the vector bytes, which keyword search must not read
+	if err := store.Set("raw", floatsToBytesTest([]float32{1, 1}), nil, ""); err != nil {
+		t.Fatal(err)
+	}
+	store.Close()
+
+	w2, err := wal.Open(walPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer w2.Close()
+
+	restored, err := NewStoreWithOptions(ctx, w2, Options{SnapshotPath: snapPath})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if results := restored.KeywordSearch("brown", 10); len(results) != 2 {
+		t.Fatalf("expected both documents to match, got %v", results)
+	}
+	if results := restored.KeywordSearch("lazy", 10); len(results) != 1 || results[0].ID != "dog" {
+		t.Fatalf("expected only dog to match, got %v", results)
+	}
+
+	texts := restored.Texts([]string{"fox", "raw", "missing"})
+	if texts[0] != "The quick brown fox" || texts[1] != "" || texts[2] != "" {
+		t.Fatalf("unexpected texts %q", texts)
+	}
+}
+
+func TestKeywordSearchBM25(t *testing.T) {
+	dir := t.TempDir()
+	walPath := filepath.Join(dir, "data.wal")
+	snapPath := filepath.Join(dir, "data.snap")
+	ctx := context.Background()
+
+	english, err := analysis.New(analysis.Config{Language: "english"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	w, err := wal.Open(walPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	store, err := NewStoreWithOptions(ctx, w, Options{SnapshotPath: snapPath, Analyzer: english})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	docs := map[string]string{
+		"short":  "leaking pipe",
+		"long":   "the pipe under the kitchen sink was replaced last year by a plumber",
+		"other":  "a plumber fixed the roof",
+		"repeat": "pipes, pipes and more pipes",
+	}
+	for id, text := range docs {
+		if err := store.Set(id, floatsToBytesTest([]float32{1, 0}), nil, text); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// stemming matches pipe and pipes; more occurrences and shorter
+	// documents rank higher
+	results := store.KeywordSearch("Pipes", 10)
+	if len(results) != 3 || results[0].ID != "repeat" || results[1].ID != "short" || results[2].ID != "long" {
+		t.Fatalf("unexpected ranking %v", results)
+	}
+
+	// stopwords alone match nothing
+	if results := store.KeywordSearch("the and", 10); len(results) != 0 {
+		t.Fatalf("expected no stopword matches, got %v", results)
+	}
+
+	// overwriting and deleting update the postings
+	if err := store.Set("short", floatsToBytesTest([]float32{1, 0}), nil, "dry roof"); err != nil {
+		t.Fatal(err)
+	}
+	if err := store.Delete("repeat"); err != nil {
+		t.Fatal(err)
+	}
+	if results := store.KeywordSearch("pipe", 10); len(results) != 1 || results[0].ID != "long" {
+		t.Fatalf("expected only long to match, got %v", results)
+	}
+	if err := store.SaveSnapShot(snapPath); err != nil {
+		t.Fatal(err)
+	}
+	want := store.KeywordSearch("roof plumber", 10)
+	store.Close()
+
+	// the persisted index is reused with the same analyzer and rebuilt
+	// with a different one
+	for _, analyzer := range []*analysis.Analyzer{english, analysis.Standard()} {
+		w2, err := wal.Open(walPath)
+		if err != nil {
+			t.Fatal(err)
+		}
+		restored, err := NewStoreWithOptions(ctx, w2, Options{SnapshotPath: snapPath, Analyzer: analyzer})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		got := restored.KeywordSearch("roof plumber", 10)
+		if analyzer == english && !reflect.DeepEqual(got, want) {
+			t.Fatalf("expected %v after restore, got %v", want, got)
+		}
+		if len(got) != len(want) {
+			t.Fatalf("expected %d matches after rebuild, got %v", len(want), got)
+		}
+		stemmed := len(restored.KeywordSearch("plumbers", 10)) > 0
+		if stemmed != (analyzer == english) {
+			t.Fatalf("expected stemming only with the english analyzer")
+		}
+		restored.Close()
+	}
+}
+
+func TestKeywordBM25ZeroBIgnoresLength(t *testing.T) {
+	b := 0.0
+	cfg := CollectionConfig{Name: "docs", BM25: BM25Params{B: &b}}
+	if err := cfg.normalize(); err != nil {
+		t.Fatal(err)
+	}
+	if cfg.BM25.B == nil || *cfg.BM25.B != 0 {
+		t.Fatalf("expected b=0 to be kept, got %v", cfg.BM25.B)
+	}
+
+	w, err := wal.Open(filepath.Join(t.TempDir(), "data.wal"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	store, err := NewStoreWithOptions(context.Background(), w, Options{BM25: cfg.BM25})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer store.Close()
+
+	if err := store.Set("short", floatsToBytesTest([]float32{1, 0}), nil, "pipe"); err != nil {
+		t.Fatal(err)
+	}
+	if err := store.Set("long", floatsToBytesTest([]float32{1, 0}), nil, "pipe under the old kitchen sink"); err != nil {
+		t.Fatal(err)
+	}
+
+	results := store.KeywordSearch("pipe", 10)
+	if len(results) != 2 || results[0].Score != results[1].Score {
+		t.Fatalf("expected equal scores regardless of length, got %v", results)
+	}
+}
+
+func TestKeywordPhrasesSurviveSnapshot(t *testing.T) {
+	dir := t.TempDir()
+	walPath := filepath.Join(dir, "data.wal")
+	snapPath := filepath.Join(dir, "data.snap")
+	ctx := context.Background()
+
+	english, err := analysis.New(analysis.Config{Language: "english"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	w, err := wal.Open(walPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	store, err := NewStoreWithOptions(ctx, w, Options{SnapshotPath: snapPath, Analyzer: english})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// "sink" appears twice, only the second time right after "kitchen"
+	if err := store.Set("sink", floatsToBytesTest([]float32{1, 0}), nil, "sink drain, kitchen tap and kitchen sink"); err != nil {
+		t.Fatal(err)
+	}
+	if err := store.Set("tap", floatsToBytesTest([]float32{1, 0}), nil, "sink of the kitchen"); err != nil {
+		t.Fatal(err)
+	}
+	if err := store.SaveSnapShot(snapPath); err != nil {
+		t.Fatal(err)
+	}
+	store.Close()
+
+	w2, err := wal.Open(walPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	restored, err := NewStoreWithOptions(ctx, w2, Options{SnapshotPath: snapPath, Analyzer: english})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer restored.Close()
+
+	if results := restored.KeywordSearch(`"kitchen sink"`, 10); len(results) != 1 || results[0].ID != "sink" {
+		t.Fatalf("expected only sink to match the phrase, got %v", results)
+	}
+	// the dropped stopwords leave no gap
+	if results := restored.KeywordSearch(`"sink kitchen"`, 10); len(results) != 1 || results[0].ID != "tap" {
+		t.Fatalf("expected only tap to match across stopwords, got %v", results)
+	}
+}
+
+func TestKeywordQueryOperators(t *testing.T) {
+	english, err := analysis.New(analysis.Config{Language: "english"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	w, err := wal.Open(filepath.Join(t.TempDir(), "data.wal"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	store, err := NewStoreWithOptions(context.Background(), w, Options{Analyzer: english})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer store.Close()
+
+	docs := map[string]string{
+		"burst":   "a burst water pipe in the basement",
+		"reverse": "the pipe burst after the frost",
+		"gas":     "gas pipe burst on the main road",
+		"drain":   "blocked drain near the station",
+	}
+	for id, text := range docs {
+		if err := store.Set(id, floatsToBytesTest([]float32{1, 0}), nil, text); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	ids := func(q string) []string {
+		var out []string
+		for _, r := range store.KeywordSearch(q, 10) {
+			out = append(out, r.ID)
+		}
+		sort.Strings(out)
+		return out
+	}
+
+	cases := map[string][]string{
+		"pipe drain":                 {"burst", "drain", "gas", "reverse"},
+		`"burst pipe"`:               nil,
+		`"bursting pipes"`:           nil,
+		`"pipe bursts"`:              {"gas", "reverse"},
+		`"burst water pipe"`:         {"burst"},
+		"+pipe -gas":                 {"burst", "reverse"},
+		"+(drain OR frost) basement": {"drain", "reverse"},
+		"-pipe":                      nil,
+		"+the drain":                 {"drain"}, // a required stopword constrains nothing
+		"drian~1":                    {"drain"},
+		"drian":                      nil,
+		"statoin~2 +blocked":         {"drain"},
+	}
+	for q, want := range cases {
+		if got := ids(q); !reflect.DeepEqual(got, want) {
+			t.Errorf("KeywordSearch(%q) = %v, want %v", q, got, want)
+		}
+	}
+
+	// an exact term outranks a fuzzy neighbour
+	if err := store.Set("brain", floatsToBytesTest([]float32{1, 0}), nil, "brain freeze near the station"); err != nil {
+		t.Fatal(err)
+	}
+	if results := store.KeywordSearch("drain~1", 10); len(results) != 2 || results[0].ID != "drain" {
+		t.Fatalf("unexpected fuzzy ranking %v", results)
+	}
+}
+
+func TestHighlight(t *testing.T) {
+	english, err := analysis.New(analysis.Config{Language: "english"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	w, err := wal.Open(filepath.Join(t.TempDir(), "data.wal"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	store, err := NewStoreWithOptions(context.Background(), w, Options{Analyzer: english})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer store.Close()
+
+	texts := map[string]string{
+		"a": "Burst pipes flooded the station; gas was shut off.",
+		"b": "The drain is blocked.",
+	}
+	for id, text := range texts {
+		if err := store.Set(id, floatsToBytesTest([]float32{1, 0}), nil, text); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := store.Set("raw", floatsToBytesTest([]float32{0, 1}), nil, ""); err != nil {
+		t.Fatal(err)
+	}
+
+	// stemmed, fuzzy and phrase terms are marked; excluded ones are not
+	got := store.Highlight(`"burst pipe" statoin~1 drains -gas`, []string{"a", "b", "raw"}, analysis.SnippetOptions{})
+
+	marked := func(h Highlight, text string) []string {
+		var out []string
+		for _, s := range h.Offsets {
+			out = append(out, text[s.Start:s.End])
+		}
+		return out
+	}
+	if words := marked(got[0], texts["a"]); !reflect.DeepEqual(words, []string{"Burst", "pipes", "station"}) {
+		t.Fatalf("unexpected matches in a: %q", words)
+	}
+	if want := "<em>Burst</em> <em>pipes</em> flooded the <em>station</em>; gas was shut off."; got[0].Snippet != want {
+		t.Fatalf("got snippet %q, want %q", got[0].Snippet, want)
+	}
+	if words := marked(got[1], texts["b"]); !reflect.DeepEqual(words, []string{"drain"}) {
+		t.Fatalf("unexpected matches in b: %q", words)
+	}
+	if got[2].Snippet != "" || got[2].Offsets != nil {
+		t.Fatalf("expected an empty highlight without text, got %+v", got[2])
+	}
+}
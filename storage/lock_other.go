@@ -0,0 +1,26 @@
+//go:build !unix
+
+package storage
+
+import (
+	"os"
+)
+
+// lockDir creates path exclusively. Without flock a crashed process leaves
+// the file behind, and it has to be removed by hand.
+func lockDir(path string) (*os.File, error) {
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_EXCL|os.O_RDWR, 0644)
+	if err != nil {
+		if os.IsExist(err) {
+			return nil, ErrDataDirLocked
+		}
+		return nil, err
+	}
+
+	return f, nil
+}
+
+func unlockDir(f *os.File) error {
+	f.Close()
+	return os.Remove(f.Name())
+}
@@ -0,0 +1,96 @@
+package storage
+
+import (
+	"flashvector/vector"
+	"math/rand"
+	"strconv"
+	"sync"
+	"testing"
+)
+
+// 100k x 384 dims matches a realistic all-MiniLM-L6-v2 collection
+const (
+	quantBenchVectors = 100000
+	quantBenchDim     = 384
+)
+
+var (
+	quantBenchOnce  sync.Once
+	quantBenchCodes []vector.QuantizedVector
+	quantBenchQuery []float32
+)
+
+func quantBenchData() ([]vector.QuantizedVector, []float32) {
+	quantBenchOnce.Do(func() {
+		rng := rand.New(rand.NewSource(1))
+
+		quantBenchCodes = make([]vector.QuantizedVector, quantBenchVectors)
+		for i := range quantBenchCodes {
+			vec := make([]float32, quantBenchDim)
+			for j := range vec {
+				vec[j] = rng.Float32()
+			}
+			quantBenchCodes[i] = vector.Quantize(vec)
+		}
+
+		quantBenchQuery = make([]float32, quantBenchDim)
+		for j := range quantBenchQuery {
+			quantBenchQuery[j] = rng.Float32()
+		}
+	})
+
+	return quantBenchCodes, quantBenchQuery
+}
+
+// BenchmarkScoreDequantize is the old IVF scoring path: one []float32
+// allocation per candidate plus both magnitudes recomputed every call
+func BenchmarkScoreDequantize(b *testing.B) {
+	codes, query := quantBenchData()
+
+	b.ReportAllocs()
+	b.ResetTimer()
+
+	for i := 0; i < b.N; i++ {
+		for _, qv := range codes {
+			vector.CosineSimilarity(vector.Dequantize(qv), query)
+		}
+	}
+}
+
+// BenchmarkScoreQuantized scores the int8 codes directly with cached norms
+func BenchmarkScoreQuantized(b *testing.B) {
+	codes, query := quantBenchData()
+	queryNorm := vector.Magnitude(query)
+
+	b.ReportAllocs()
+	b.ResetTimer()
+
+	for i := 0; i < b.N; i++ {
+		for _, qv := range codes {
+			vector.MetricCosine.ScoreQuantized(query, queryNorm, qv)
+		}
+	}
+}
+
+// BenchmarkIVFSearch100k measures a full IVF search over 100k vectors
+func BenchmarkIVFSearch100k(b *testing.B) {
+	rng := rand.New(rand.NewSource(2))
+
+	idx := vector.NewIVFIndex(vector.RandomCentroids(16, quantBenchDim), 4)
+	for i := 0; i < quantBenchVectors; i++ {
+		vec := make([]float32, quantBenchDim)
+		for j := range vec {
+			vec[j] = rng.Float32()
+		}
+		idx.Add(strconv.Itoa(i), vec)
+	}
+
+	_, query := quantBenchData()
+
+	b.ReportAllocs()
+	b.ResetTimer()
+
+	for i := 0; i < b.N; i++ {
+		idx.Search(query, 10, nil)
+	}
+}
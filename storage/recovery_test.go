@@ -3,9 +3,14 @@ package storage
 import (
 	"bytes"
 	"context"
+	"flashvector/metadata"
 	"flashvector/wal"
 	"os"
+	"path/filepath"
+	"strconv"
+	"sync"
 	"testing"
+	"time"
 )
 
 // --- HELPER FUNCTION ---
@@ -38,10 +43,10 @@ func TestCrashRecovery(t *testing.T) {
 	valA := mockDataRecovery("valA")
 	valB := mockDataRecovery("valB")
 
-	if err := store.Set("a", valA,nil); err != nil {
+	if err := store.Set("a", valA,nil, ""); err != nil {
 		t.Fatal(err)
 	}
-	if err := store.Set("b", valB,nil); err != nil {
+	if err := store.Set("b", valB,nil, ""); err != nil {
 		t.Fatal(err)
 	}
 
@@ -95,8 +100,8 @@ func TestCorruptedWALRecovery(t *testing.T) {
 	val1 := mockDataRecovery("val1")
 	val2 := mockDataRecovery("val2")
 
-	store.Set("key1", val1,nil)
-	store.Set("key2", val2,nil)
+	store.Set("key1", val1,nil, "")
+	store.Set("key2", val2,nil, "")
 	w.Close()
 
 	// 2. CORRUPT THE FILE
@@ -125,7 +130,7 @@ func TestCorruptedWALRecovery(t *testing.T) {
 	}
 
 	// 4. Verify we can continue writing
-	if err := store2.Set("key3", mockDataRecovery("val3"),nil); err != nil {
+	if err := store2.Set("key3", mockDataRecovery("val3"),nil, ""); err != nil {
 		t.Fatalf("failed to write after recovery: %v", err)
 	}
 }
@@ -143,13 +148,13 @@ func TestInterleavedOperations(t *testing.T) {
 	}
 	store, _ := NewStore(ctx, w)
 
-	store.Set("a", mockDataRecovery("1"),nil)
-	store.Set("b", mockDataRecovery("2"),nil)
+	store.Set("a", mockDataRecovery("1"),nil, "")
+	store.Set("b", mockDataRecovery("2"),nil, "")
 	store.Delete("a")
-	store.Set("c", mockDataRecovery("3"),nil)
-	store.Set("b", mockDataRecovery("4"),nil) // Update
+	store.Set("c", mockDataRecovery("3"),nil, "")
+	store.Set("b", mockDataRecovery("4"),nil, "") // Update
 	store.Delete("c")
-	store.Set("c", mockDataRecovery("5"),nil) // Re-create
+	store.Set("c", mockDataRecovery("5"),nil, "") // Re-create
 	w.Close()
 
 	// 2. Recover
@@ -174,4 +179,170 @@ func TestInterleavedOperations(t *testing.T) {
 	if !ok || !bytes.Equal(valC, mockDataRecovery("5")) {
 		t.Errorf("key 'c' should be '5'")
 	}
-}
\ No newline at end of file
+}
+func TestCheckpointTruncatesCoveredSegments(t *testing.T) {
+	dir := t.TempDir()
+	walPath := dir + "/data.wal"
+	snapPath := dir + "/data.snap"
+	ctx := context.Background()
+
+	w, err := wal.OpenWithOptions(walPath, wal.Options{SegmentSize: 4096})
+	if err != nil {
+		t.Fatal(err)
+	}
+	store, err := NewStoreWithOptions(ctx, w, Options{SnapshotPath: snapPath})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for i := 0; i < 120; i++ {
+		if err := store.Set("key-"+strconv.Itoa(i), mockDataRecovery(strconv.Itoa(i)), nil, ""); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := store.Checkpoint(); err != nil {
+		t.Fatal(err)
+	}
+	store.Close()
+
+	// each record is ~1.5KB, so without truncation there would be ~40 segments
+	segments, _ := filepath.Glob(walPath + ".*")
+	if len(segments) > 10 {
+		t.Fatalf("expected covered segments to be removed, %d left", len(segments))
+	}
+
+	w2, err := wal.OpenWithOptions(walPath, wal.Options{SegmentSize: 4096})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer w2.Close()
+
+	store2, err := NewStoreWithOptions(ctx, w2, Options{SnapshotPath: snapPath})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 120; i++ {
+		if _, _, ok := store2.Get("key-" + strconv.Itoa(i)); !ok {
+			t.Fatalf("key-%d lost across snapshot and WAL", i)
+		}
+	}
+	if store2.seq != 120 {
+		t.Fatalf("expected seq 120 after recovery, got %d", store2.seq)
+	}
+}
+
+func TestBackgroundCheckpointKeepsConcurrentWrites(t *testing.T) {
+	dir := t.TempDir()
+	walPath := dir + "/data.wal"
+	snapPath := dir + "/data.snap"
+	ctx := context.Background()
+
+	w, err := wal.OpenWithOptions(walPath, wal.Options{SegmentSize: 4096})
+	if err != nil {
+		t.Fatal(err)
+	}
+	store, err := NewStoreWithOptions(ctx, w, Options{SnapshotPath: snapPath, SnapshotEvery: 25})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// writers keep going while the checkpointer snapshots behind them
+	var wg sync.WaitGroup
+	for g := 0; g < 4; g++ {
+		wg.Add(1)
+		go func(g int) {
+			defer wg.Done()
+			for i := 0; i < 100; i++ {
+				key := "key-" + strconv.Itoa(g) + "-" + strconv.Itoa(i)
+				if err := store.Set(key, mockDataRecovery(key), nil, ""); err != nil {
+					t.Error(err)
+					return
+				}
+			}
+		}(g)
+	}
+	wg.Wait()
+
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		if _, err := os.Stat(snapPath); err == nil {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("expected the checkpointer to write a snapshot")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	store.Close()
+
+	w2, err := wal.OpenWithOptions(walPath, wal.Options{SegmentSize: 4096})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer w2.Close()
+
+	store2, err := NewStoreWithOptions(ctx, w2, Options{SnapshotPath: snapPath})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if store2.Len() != 400 || store2.seq != 400 {
+		t.Fatalf("expected 400 keys at seq 400, got %d at %d", store2.Len(), store2.seq)
+	}
+}
+
+func TestBatchIsOneRecordAndRecovers(t *testing.T) {
+	dir := t.TempDir()
+	walPath := dir + "/data.wal"
+	snapPath := dir + "/data.snap"
+	ctx := context.Background()
+
+	w, err := wal.Open(walPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	store, err := NewStoreWithOptions(ctx, w, Options{SnapshotPath: snapPath, Dimension: 2})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	errs, err := store.SetBatch([]BatchItem{
+		{Key: "a", Value: floatsToBytesTest([]float32{1, 0}), Metadata: Metadata{"n": metadata.IntValue(1)}},
+		{Key: "bad", Value: floatsToBytesTest([]float32{1, 2, 3})},
+		{Key: "b", Value: floatsToBytesTest([]float32{0, 1})},
+		{Key: "c", Value: floatsToBytesTest([]float32{1, 1})},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if errs[0] != nil || errs[1] == nil || errs[2] != nil || errs[3] != nil {
+		t.Fatalf("expected only the 3-dim item to be rejected, got %v", errs)
+	}
+	if store.seq != 1 {
+		t.Fatalf("expected the batch to take one LSN, got %d", store.seq)
+	}
+
+	if err := store.DeleteBatch([]string{"b", "c"}); err != nil {
+		t.Fatal(err)
+	}
+	store.Close()
+
+	w2, err := wal.Open(walPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer w2.Close()
+
+	store2, err := NewStoreWithOptions(ctx, w2, Options{SnapshotPath: snapPath})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if store2.seq != 2 || store2.Len() != 1 {
+		t.Fatalf("expected only a left at seq 2, got %d keys at %d", store2.Len(), store2.seq)
+	}
+	if _, meta, ok := store2.Get("a"); !ok || !meta["n"].Equal(metadata.IntValue(1)) {
+		t.Fatalf("expected a and its metadata to be recovered")
+	}
+	if results := store2.VectorSearch([]float32{1, 0}, 1, nil); len(results) != 1 || results[0].ID != "a" {
+		t.Fatalf("expected the recovered batch to be indexed, got %v", results)
+	}
+}
@@ -1,28 +1,234 @@
 package storage
 
 import (
-	"os"
+	"bufio"
+	"bytes"
+	"encoding/binary"
 	"encoding/gob"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"flashvector/metadata"
+	"flashvector/vector"
+)
+
+// Snapshot file layout:
+//
+//	magic   [4]byte  "FVSN"
+//	version uint32
+//	length  uint64   payload bytes
+//	crc     uint32   CRC-32C of the payload
+//	_       uint32   reserved
+//	payload          gob-encoded snapshotState
+//
+// All integers are little-endian. Files without the magic are the original
+// unversioned format (a bare gob data map) and are still accepted. Version
+// 1 kept metadata as plain strings; it loads with every value a string.
+//
+// Persisted indexes (see vector.PersistentIndex) use the same framing with
+// magic "FVIX"; their payload is the little-endian uint64 snapshot sequence
+// they match, followed by the index's own versioned state.
+const (
+	snapshotMagic      = "FVSN"
+	snapshotVersion    = 2
+	snapshotHeaderSize = 24
+
+	indexFileMagic   = "FVIX"
+	indexFileVersion = 1
 )
 
+var (
+	ErrSnapshotCorrupt = errors.New("snapshot is corrupt")
+	ErrSnapshotVersion = errors.New("unsupported snapshot version")
+)
+
+var snapshotCRC = crc32.MakeTable(crc32.Castagnoli)
+
+// snapshotState is the full store state a snapshot restores
+type snapshotState struct{
+	// Seq is the last mutation the snapshot covers; WAL records up to it
+	// are already reflected in Data and Metadata
+	Seq uint64
+	Dimension int
+	ElementType vector.ElementType
+	Data map[string][]byte
+	// Metadata holds typed values; version 1 snapshots have Meta instead
+	Metadata map[string]Metadata
+	Meta map[string]map[string]string
+	// Text is the document text by key; absent from older snapshots
+	Text map[string]string
+	// Keyword is the inverted index over Text, reused on load when the
+	// analyzer is unchanged
+	Keyword *keywordState
+	// trained IVF-PQ codebooks, so restarts skip training
+	PQ *vector.IVFPQState
+
+	// legacy marks an unversioned snapshot, which did not record its element type
+	legacy bool
+}
+
+// SaveSnapShot writes the store to a temp file next to path, fsyncs it and
+// renames it over path, so a crash leaves either the old or the new snapshot.
+// Indexes that can persist themselves are written the same way to the
+// matching .index file, tagged with the sequence the snapshot covers.
 func (s *Store) SaveSnapShot(path string) error{
+	s.checkpointMu.Lock()
+	defer s.checkpointMu.Unlock()
+
+	_,err := s.saveSnapshotLocked(path)
+	return err
+}
+
+// saveSnapshotLocked is SaveSnapShot, returning the sequence the snapshot
+// covers. Caller holds checkpointMu, so the snapshot and index files of two
+// checkpoints never interleave.
+func (s *Store) saveSnapshotLocked(path string) (uint64,error){
+	state,indexState := s.captureSnapshot()
+
+	err := writeFileAtomic(path,func(f *os.File) error{
+		return writeFramed(f,snapshotMagic,snapshotVersion,func(w io.Writer) error{
+			return gob.NewEncoder(w).Encode(state)
+		})
+	})
+	if err != nil{
+		return 0,err
+	}
+
+	if indexState == nil{
+		return state.Seq,nil
+	}
+
+	err = writeFileAtomic(indexPathFor(path),func(f *os.File) error{
+		return writeFramed(f,indexFileMagic,indexFileVersion,func(w io.Writer) error{
+			seq := make([]byte,8)
+			binary.LittleEndian.PutUint64(seq,state.Seq)
+			if _,err := w.Write(seq);err != nil{
+				return err
+			}
+			return indexState.Encode(w)
+		})
+	})
+	return state.Seq,err
+}
+
+// captureSnapshot takes a point-in-time view of the store under the read
+// lock: the key and metadata maps are copied, the values are shared since
+// writes replace them rather than modify them, and the keyword and
+// persistent indexes capture their own state the same cheap way. Nothing
+// is encoded under the lock; the caller writes it all out after. Caller
+// holds checkpointMu.
+func (s *Store) captureSnapshot() (snapshotState,*vector.IndexState){
 	s.mu.RLock()
 	defer s.mu.RUnlock()
 
-	file,err := os.Create(path)
+	state := snapshotState{
+		Seq: s.seq,
+		Dimension: s.dim,
+		ElementType: s.elemType,
+		Data: make(map[string][]byte,len(s.data)),
+		Metadata: make(map[string]Metadata,len(s.meta)),
+		Text: make(map[string]string,len(s.text)),
+	}
+	for k,v := range s.data{
+		state.Data[k] = v
+	}
+	for k,v := range s.meta{
+		state.Metadata[k] = v
+	}
+	for k,v := range s.text{
+		state.Text[k] = v
+	}
+	state.Keyword = s.keyword.state()
+
+	if pq,ok := s.index.(*vector.IVFPQIndex); ok && pq.Trained(){
+		pqState := pq.State()
+		state.PQ = &pqState
+	}
+
+	pidx,ok := s.index.(vector.PersistentIndex)
+	if !ok{
+		return state,nil
+	}
+
+	indexState := pidx.CaptureState()
+	return state,&indexState
+}
 
+// writeFileAtomic writes a temp file next to path with write, fsyncs it and
+// renames it over path
+func writeFileAtomic(path string,write func(f *os.File) error) error{
+	tmp,err := os.CreateTemp(filepath.Dir(path),filepath.Base(path)+".tmp-*")
 	if err != nil{
 		return err
 	}
 
-	defer file.Close()
+	// clean up unless the rename below succeeds
+	committed := false
+	defer func(){
+		if !committed{
+			tmp.Close()
+			os.Remove(tmp.Name())
+		}
+	}()
 
-	encoder := gob.NewEncoder(file)
+	if err := write(tmp);err != nil{
+		return err
+	}
 
-	return encoder.Encode(s.data)
+	if err := tmp.Sync();err != nil{
+		return err
+	}
 
+	if err := tmp.Close();err != nil{
+		return err
+	}
+
+	if err := os.Rename(tmp.Name(),path);err != nil{
+		return err
+	}
+	committed = true
+
+	// persist the rename itself
+	return syncDir(filepath.Dir(path))
+}
+
+// writeFramed streams the payload after a placeholder header, then fills
+// the header in once the length and checksum are known
+func writeFramed(f *os.File,magic string,version uint32,encode func(w io.Writer) error) error{
+	if _,err := f.Write(make([]byte,snapshotHeaderSize));err != nil{
+		return err
+	}
+
+	crc := crc32.New(snapshotCRC)
+	counter := &countingWriter{}
+	buf := bufio.NewWriter(io.MultiWriter(f,crc,counter))
+
+	if err := encode(buf);err != nil{
+		return err
+	}
+
+	if err := buf.Flush();err != nil{
+		return err
+	}
+
+	header := make([]byte,snapshotHeaderSize)
+	copy(header[0:4],magic)
+	binary.LittleEndian.PutUint32(header[4:8],version)
+	binary.LittleEndian.PutUint64(header[8:16],counter.n)
+	binary.LittleEndian.PutUint32(header[16:20],crc.Sum32())
+
+	_,err := f.WriteAt(header,0)
+	return err
 }
 
+// LoadSnapshot restores data, metadata, the covered sequence and any
+// trained index state from path. The file is validated in full before any
+// of it replaces the store's state; a missing file is not an error.
 func (s *Store) LoadSnapshot(path string) error{
 	file,err := os.Open(path)
 
@@ -35,19 +241,244 @@ func (s *Store) LoadSnapshot(path string) error{
 
 	defer file.Close()
 
-	decoder := gob.NewDecoder(file)
-
-	data := make(map[string][]byte)
-
-	if err := decoder.Decode(&data);err != nil{
-		return err
+	state,err := readSnapshot(file)
+	if err != nil{
+		return fmt.Errorf("%s: %w",path,err)
 	}
 
 	s.mu.Lock()
 	defer s.mu.Unlock()
 
-	s.data = data
-	s.index.RebuildFromData(data)
+	if !state.legacy && state.ElementType != s.elemType{
+		return fmt.Errorf("%s: snapshot holds %s vectors, store expects %s",path,state.ElementType,s.elemType)
+	}
+
+	// a store without a configured dimension takes it from the snapshot;
+	// unversioned snapshots only have their data to go by
+	dim := state.Dimension
+	if dim == 0{
+		for _,value := range state.Data{
+			dim = len(s.decodeVector(value))
+			break
+		}
+	}
+
+	if dim != 0{
+		if err := s.checkDimension(dim);err != nil{
+			return fmt.Errorf("%s: %w",path,err)
+		}
+	}
+
+	s.data = state.Data
+	s.meta = state.Metadata
+	s.text = state.Text
+	s.seq = state.Seq
+
+	if s.data == nil{
+		s.data = make(map[string][]byte)
+	}
+	if s.meta == nil{
+		s.meta = make(map[string]Metadata)
+	}
+	if s.text == nil{
+		s.text = make(map[string]string)
+	}
+	if !s.keyword.restore(state.Keyword,s.text){
+		s.keyword.rebuild(s.text)
+	}
+
+	if s.index == nil{
+		return nil
+	}
+
+	if pq,ok := s.index.(*vector.IVFPQIndex); ok && state.PQ != nil{
+		if err := pq.Restore(*state.PQ);err != nil{
+			return err
+		}
+	}
+
+	if !s.loadIndex(indexPathFor(path),state.Seq){
+		s.rebuildIndex()
+	}
 	return nil
-	
-}
\ No newline at end of file
+
+}
+
+// readSnapshot checks the header, length and checksum and returns the
+// decoded state. Unversioned files fall back to readLegacySnapshot.
+func readSnapshot(file *os.File) (snapshotState,error){
+	var state snapshotState
+
+	err := readFramed(file,snapshotMagic,1,snapshotVersion,func(r io.Reader) error{
+		if err := gob.NewDecoder(r).Decode(&state);err != nil{
+			return fmt.Errorf("%w: %v",ErrSnapshotCorrupt,err)
+		}
+		return nil
+	})
+
+	if err == nil && state.Metadata == nil && state.Meta != nil{
+		state.Metadata = make(map[string]Metadata,len(state.Meta))
+		for k,m := range state.Meta{
+			state.Metadata[k] = metadata.Strings(m)
+		}
+	}
+
+	if errors.Is(err,errNoMagic){
+		if _,err := file.Seek(0,io.SeekStart);err != nil{
+			return state,err
+		}
+		return readLegacySnapshot(file)
+	}
+
+	return state,err
+}
+
+// errNoMagic means a file does not start with the expected magic
+var errNoMagic = errors.New("missing file magic")
+
+// readFramed validates a file written by writeFramed, in any version from
+// oldest to newest, and returns decode's
+// error unchanged. decode receives the payload as an io.ByteReader, so
+// several gob streams can be read from it back to back. The checksum is
+// verified over every payload byte before decode runs, so decode only ever
+// sees intact data and may apply it as it goes, as LoadState does.
+func readFramed(file *os.File,magic string,oldest,newest uint32,decode func(r io.Reader) error) error{
+	header := make([]byte,snapshotHeaderSize)
+	n,err := io.ReadFull(file,header)
+
+	if n < len(magic) || !bytes.Equal(header[:len(magic)],[]byte(magic)){
+		return errNoMagic
+	}
+
+	if err != nil{
+		return fmt.Errorf("%w: truncated header",ErrSnapshotCorrupt)
+	}
+
+	if v := binary.LittleEndian.Uint32(header[4:8]); v < oldest || v > newest{
+		return fmt.Errorf("%w: %d",ErrSnapshotVersion,v)
+	}
+
+	length := binary.LittleEndian.Uint64(header[8:16])
+	want := binary.LittleEndian.Uint32(header[16:20])
+
+	info,err := file.Stat()
+	if err != nil{
+		return err
+	}
+	if uint64(info.Size()) != snapshotHeaderSize+length{
+		return fmt.Errorf("%w: expected %d payload bytes, file has %d",ErrSnapshotCorrupt,length,info.Size()-snapshotHeaderSize)
+	}
+
+	// a first pass checks the whole payload, then decoding starts over
+	crc := crc32.New(snapshotCRC)
+	if _,err := io.Copy(crc,io.LimitReader(file,int64(length)));err != nil{
+		return err
+	}
+	if crc.Sum32() != want{
+		return fmt.Errorf("%w: checksum mismatch",ErrSnapshotCorrupt)
+	}
+
+	if _,err := file.Seek(snapshotHeaderSize,io.SeekStart);err != nil{
+		return err
+	}
+
+	return decode(bufio.NewReader(io.LimitReader(file,int64(length))))
+}
+
+// readLegacySnapshot reads snapshots written before the versioned format:
+// the data map, optionally followed by IVF-PQ state
+func readLegacySnapshot(r io.Reader) (snapshotState,error){
+	state := snapshotState{legacy: true}
+
+	decoder := gob.NewDecoder(r)
+
+	if err := decoder.Decode(&state.Data);err != nil{
+		return state,fmt.Errorf("%w: %v",ErrSnapshotCorrupt,err)
+	}
+
+	var pqState vector.IVFPQState
+	if decoder.Decode(&pqState) == nil{
+		state.PQ = &pqState
+	}
+
+	return state,nil
+}
+
+// indexPathFor is where the persisted index for a snapshot lives,
+// e.g. data.snap -> data.index
+func indexPathFor(snapshotPath string) string{
+	return strings.TrimSuffix(snapshotPath,filepath.Ext(snapshotPath))+".index"
+}
+
+// loadIndex loads the persisted index written with the snapshot at seq.
+// It reports false when the store has to rebuild instead: no file, an index
+// that cannot persist itself, or a file that is stale, corrupt or was
+// written by an incompatible index. Caller holds the write lock.
+func (s *Store) loadIndex(path string,seq uint64) bool{
+	pidx,ok := s.index.(vector.PersistentIndex)
+	if !ok{
+		return false
+	}
+
+	file,err := os.Open(path)
+	if err != nil{
+		if !os.IsNotExist(err){
+			fmt.Printf("Rebuilding index: %v\n",err)
+		}
+		return false
+	}
+	defer file.Close()
+
+	err = readFramed(file,indexFileMagic,indexFileVersion,indexFileVersion,func(r io.Reader) error{
+		header := make([]byte,8)
+		if _,err := io.ReadFull(r,header);err != nil{
+			return err
+		}
+		if got := binary.LittleEndian.Uint64(header); got != seq{
+			return fmt.Errorf("index covers sequence %d, snapshot %d",got,seq)
+		}
+		return pidx.LoadState(r)
+	})
+
+	if err != nil{
+		fmt.Printf("Rebuilding index from %s: %v\n",path,err)
+		return false
+	}
+
+	return true
+}
+
+// rebuildIndex repopulates the index from s.data. Indexes rebuild from
+// float32 bytes, so other element types are decoded and added one by one.
+func (s *Store) rebuildIndex(){
+	if s.elemType == vector.ElementFloat32{
+		s.index.RebuildFromData(s.data)
+		return
+	}
+
+	s.index.RebuildFromData(nil)
+
+	for key,value := range s.data{
+		s.index.Add(key,s.decodeVector(value))
+	}
+}
+
+type countingWriter struct{
+	n uint64
+}
+
+func (c *countingWriter) Write(p []byte) (int,error){
+	c.n += uint64(len(p))
+	return len(p),nil
+}
+
+// syncDir fsyncs a directory so a rename into it survives a crash
+func syncDir(dir string) error{
+	d,err := os.Open(dir)
+	if err != nil{
+		return err
+	}
+	defer d.Close()
+
+	return d.Sync()
+}
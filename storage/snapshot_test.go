@@ -0,0 +1,334 @@
+package storage
+
+import (
+	"bytes"
+	"context"
+	"encoding/gob"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strconv"
+	"testing"
+	"time"
+
+	"flashvector/metadata"
+	"flashvector/vector"
+)
+
+func TestSnapshotRestoresMetadata(t *testing.T) {
+	ctx := context.Background()
+	path := filepath.Join(t.TempDir(), "data.snap")
+
+	store, _ := NewStore(ctx, nil)
+	meta := Metadata{
+		"lang":     metadata.StringValue("en"),
+		"price":    metadata.FloatValue(9.5),
+		"reported": metadata.TimeValue(time.Date(2024, 3, 1, 10, 0, 0, 0, time.UTC)),
+		"tags":     metadata.ListValue("a", "b"),
+	}
+	if err := store.Set("a", floatsToBytesTest([]float32{1, 0}), meta, ""); err != nil {
+		t.Fatal(err)
+	}
+	if err := store.Set("b", floatsToBytesTest([]float32{0, 1}), Metadata{"lang": metadata.StringValue("de")}, ""); err != nil {
+		t.Fatal(err)
+	}
+	if err := store.Delete("b"); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := store.SaveSnapShot(path); err != nil {
+		t.Fatal(err)
+	}
+
+	// no temp files are left behind
+	if tmp, _ := filepath.Glob(path + ".tmp-*"); len(tmp) != 0 {
+		t.Fatalf("temp files left behind: %v", tmp)
+	}
+
+	restored, err := NewStoreWithOptions(ctx, nil, Options{SnapshotPath: path})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, got, ok := restored.Get("a"); !ok || !reflect.DeepEqual(got, meta) {
+		t.Fatalf("expected a with its typed metadata, got %v %v", got, ok)
+	}
+	if _, _, ok := restored.Get("b"); ok {
+		t.Fatalf("deleted key came back from the snapshot")
+	}
+	if restored.seq != 3 || restored.Dimension() != 2 {
+		t.Fatalf("expected seq 3 and dimension 2, got %d and %d", restored.seq, restored.Dimension())
+	}
+	if results := restored.VectorSearch([]float32{1, 0}, 1, map[string]string{"lang": "en"}); len(results) != 1 {
+		t.Fatalf("expected the restored index to honour metadata filters, got %v", results)
+	}
+}
+
+func TestSnapshotRejectsCorruption(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+	path := filepath.Join(dir, "data.snap")
+
+	store, _ := NewStore(ctx, nil)
+	for _, key := range []string{"a", "b", "c"} {
+		if err := store.Set(key, floatsToBytesTest([]float32{1, 2, 3}), nil, ""); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := store.SaveSnapShot(path); err != nil {
+		t.Fatal(err)
+	}
+
+	raw, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	flipped := append([]byte(nil), raw...)
+	flipped[len(flipped)-5] ^= 0xff
+	if err := os.WriteFile(path, flipped, 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := NewStoreWithOptions(ctx, nil, Options{SnapshotPath: path}); !errors.Is(err, ErrSnapshotCorrupt) {
+		t.Fatalf("expected a checksum failure, got %v", err)
+	}
+
+	if err := os.WriteFile(path, raw[:len(raw)/2], 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := NewStoreWithOptions(ctx, nil, Options{SnapshotPath: path}); !errors.Is(err, ErrSnapshotCorrupt) {
+		t.Fatalf("expected a truncated snapshot to be rejected, got %v", err)
+	}
+}
+
+func TestLegacySnapshotStillLoads(t *testing.T) {
+	ctx := context.Background()
+	path := filepath.Join(t.TempDir(), "data.snap")
+
+	file, err := os.Create(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data := map[string][]byte{"old": floatsToBytesTest([]float32{1, 2, 3, 4})}
+	if err := gob.NewEncoder(file).Encode(data); err != nil {
+		t.Fatal(err)
+	}
+	file.Close()
+
+	store, err := NewStoreWithOptions(ctx, nil, Options{SnapshotPath: path})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, _, ok := store.Get("old"); !ok || store.Dimension() != 4 {
+		t.Fatalf("expected the unversioned snapshot to load")
+	}
+}
+
+func TestSnapshotLoadsPersistedIndex(t *testing.T) {
+	ctx := context.Background()
+	path := filepath.Join(t.TempDir(), "data.snap")
+
+	store, _ := NewStore(ctx, nil)
+	for i := 0; i < 50; i++ {
+		vec := []float32{float32(i), float32(50 - i), 1, float32(i % 7)}
+		if err := store.Set("key-"+strconv.Itoa(i), floatsToBytesTest(vec), nil, ""); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := store.SaveSnapShot(path); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(filepath.Join(filepath.Dir(path), "data.index")); err != nil {
+		t.Fatalf("expected the index to be persisted next to the snapshot: %v", err)
+	}
+
+	saved := store.index.(*vector.IVFIndex).Centroids()
+
+	// a fresh store starts from new random centroids; loading the persisted
+	// index brings the saved ones back instead of rebuilding
+	restored, err := NewStoreWithOptions(ctx, nil, Options{SnapshotPath: path})
+	if err != nil {
+		t.Fatal(err)
+	}
+	loaded := restored.index.(*vector.IVFIndex).Centroids()
+	if len(loaded) != len(saved) || loaded[0][0] != saved[0][0] || loaded[1][3] != saved[1][3] {
+		t.Fatalf("expected the persisted centroids to be loaded")
+	}
+
+	query := []float32{10, 40, 1, 3}
+	if got := restored.VectorSearch(query, 1, nil); len(got) != 1 || got[0].ID != store.VectorSearch(query, 1, nil)[0].ID {
+		t.Fatalf("loaded index returned %v", got)
+	}
+
+	// an index that does not match the snapshot's sequence is rebuilt
+	if err := store.Set("late", floatsToBytesTest([]float32{1, 1, 1, 1}), nil, ""); err != nil {
+		t.Fatal(err)
+	}
+	snapOnly := filepath.Join(t.TempDir(), "data.snap")
+	if err := store.SaveSnapShot(snapOnly); err != nil {
+		t.Fatal(err)
+	}
+	if err := copyFileTest(filepath.Join(filepath.Dir(path), "data.index"), filepath.Join(filepath.Dir(snapOnly), "data.index")); err != nil {
+		t.Fatal(err)
+	}
+
+	rebuilt, err := NewStoreWithOptions(ctx, nil, Options{SnapshotPath: snapOnly})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := rebuilt.VectorSearch([]float32{1, 1, 1, 1}, 1, nil); len(got) != 1 || got[0].ID != "late" {
+		t.Fatalf("expected the stale index to be rebuilt, got %v", got)
+	}
+}
+
+func copyFileTest(from, to string) error {
+	raw, err := os.ReadFile(from)
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(to, raw, 0644)
+}
+
+func TestSnapshotVersion1MetadataLoadsAsStrings(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "data.snap")
+
+	// the version 1 state, from before metadata had types
+	v1 := struct {
+		Seq         uint64
+		Dimension   int
+		ElementType vector.ElementType
+		Data        map[string][]byte
+		Meta        map[string]map[string]string
+	}{
+		Seq:       1,
+		Dimension: 2,
+		Data:      map[string][]byte{"a": floatsToBytesTest([]float32{1, 0})},
+		Meta:      map[string]map[string]string{"a": {"lang": "en", "n": "5"}},
+	}
+
+	err := writeFileAtomic(path, func(f *os.File) error {
+		return writeFramed(f, snapshotMagic, 1, func(w io.Writer) error {
+			return gob.NewEncoder(w).Encode(v1)
+		})
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	restored, err := NewStoreWithOptions(context.Background(), nil, Options{SnapshotPath: path})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := Metadata{"lang": metadata.StringValue("en"), "n": metadata.StringValue("5")}
+	if _, got, ok := restored.Get("a"); !ok || !reflect.DeepEqual(got, want) {
+		t.Fatalf("expected string metadata, got %v %v", got, ok)
+	}
+}
+
+func TestIndexFileChecksumIsVerifiedBeforeLoading(t *testing.T) {
+	ctx := context.Background()
+	path := filepath.Join(t.TempDir(), "data.snap")
+
+	store, _ := NewStore(ctx, nil)
+	for i := 0; i < 50; i++ {
+		vec := []float32{float32(i), float32(50 - i), 1, float32(i % 7)}
+		if err := store.Set("key-"+strconv.Itoa(i), floatsToBytesTest(vec), nil, ""); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := store.SaveSnapShot(path); err != nil {
+		t.Fatal(err)
+	}
+	saved := store.index.(*vector.IVFIndex).Centroids()
+
+	// break only the stored checksum, so the payload still decodes
+	indexPath := filepath.Join(filepath.Dir(path), "data.index")
+	raw, err := os.ReadFile(indexPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	raw[16] ^= 0xff
+	if err := os.WriteFile(indexPath, raw, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	restored, err := NewStoreWithOptions(ctx, nil, Options{SnapshotPath: path})
+	if err != nil {
+		t.Fatal(err)
+	}
+	loaded := restored.index.(*vector.IVFIndex).Centroids()
+	if len(loaded) == len(saved) && loaded[0][0] == saved[0][0] && loaded[1][3] == saved[1][3] {
+		t.Fatal("expected the unverified centroids not to be loaded")
+	}
+
+	query := []float32{10, 40, 1, 3}
+	if got := restored.VectorSearch(query, 1, nil); len(got) != 1 || got[0].ID != store.VectorSearch(query, 1, nil)[0].ID {
+		t.Fatalf("rebuilt index returned %v", got)
+	}
+}
+
+func TestSnapshotCaptureIsUnaffectedByLaterWrites(t *testing.T) {
+	ctx := context.Background()
+	store, err := NewStoreWithIndex(ctx, nil, vector.NewHNSWIndex(2, 0, 0, 0))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for i := 0; i < 20; i++ {
+		text := "pipe burst on floor " + strconv.Itoa(i)
+		if err := store.Set("doc-"+strconv.Itoa(i), floatsToBytesTest([]float32{float32(i), 1}), nil, text); err != nil {
+			t.Fatal(err)
+		}
+	}
+	want := store.KeywordSearch("pipe", 100)
+
+	store.checkpointMu.Lock()
+	state, indexState := store.captureSnapshot()
+	store.checkpointMu.Unlock()
+
+	// writes after the capture touch the same terms and graph nodes
+	for i := 0; i < 20; i += 2 {
+		if err := store.Delete("doc-" + strconv.Itoa(i)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for i := 20; i < 60; i++ {
+		if err := store.Set("doc-"+strconv.Itoa(i), floatsToBytesTest([]float32{float32(i), 2}), nil, "pipe leak"); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// encoded only now, as saveSnapshotLocked does outside the lock
+	var buf bytes.Buffer
+	if err := gob.NewEncoder(&buf).Encode(state); err != nil {
+		t.Fatal(err)
+	}
+	var decoded snapshotState
+	if err := gob.NewDecoder(&buf).Decode(&decoded); err != nil {
+		t.Fatal(err)
+	}
+
+	restored, _ := NewStoreWithIndex(ctx, nil, vector.NewHNSWIndex(2, 0, 0, 0))
+	if !restored.keyword.restore(decoded.Keyword, decoded.Text) {
+		t.Fatal("expected the captured keyword index to restore")
+	}
+	restored.text = decoded.Text
+	if got := restored.KeywordSearch("pipe", 100); !reflect.DeepEqual(got, want) {
+		t.Fatalf("captured keyword index changed: got %d results, want %d", len(got), len(want))
+	}
+
+	buf.Reset()
+	if err := indexState.Encode(&buf); err != nil {
+		t.Fatal(err)
+	}
+	graph := vector.NewHNSWIndex(2, 0, 0, 0)
+	if err := graph.LoadState(&buf); err != nil {
+		t.Fatal(err)
+	}
+	if graph.Len() != 20 {
+		t.Fatalf("expected the captured graph to hold 20 nodes, got %d", graph.Len())
+	}
+}
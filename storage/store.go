@@ -2,17 +2,34 @@ package storage
 
 import (
 	"context"
+	"errors"
+	"flashvector/analysis"
+	"flashvector/metadata"
 	"flashvector/metrics"
+	"flashvector/query"
 	"flashvector/vector"
 	"flashvector/wal"
 	"fmt"
 	"sync"
 	"encoding/binary"
 	"math"
+	"time"
 )
 
-// Metadata is a simple key-value map for storing tags (e.g., "category": "news")
-type Metadata map[string]string
+const (
+	// minTrainingVectors is the smallest store NewStore trains IVF centroids for
+	minTrainingVectors = 1000
+	// trainingSampleSize caps how many stored vectors k-means sees
+	trainingSampleSize = 50000
+)
+
+// ErrInvalidVector is wrapped by errors for vectors no dimension could
+// accept: empty, cut off mid-component, or a binary length that is not a
+// whole number of bytes. Length mismatches are *vector.DimensionError.
+var ErrInvalidVector = errors.New("invalid vector")
+
+// Metadata holds a document's typed tags (e.g., "category": "news", "price": 9.5)
+type Metadata = metadata.Map
 
 // Store holds data and protects it with a lock
 // Store holds the data, metadata, and the vector index
@@ -20,47 +37,290 @@ type Store struct {
 	mu            sync.RWMutex
 	data          map[string][]byte
 	meta          map[string]Metadata
+	text          map[string]string // document text, kept apart from the vector bytes
+	schema        metadata.Schema   // checked by Set and SetBatch; nil allows anything
+	keyword       *keywordIndex     // inverted index over text
 	wal           *wal.WAL
 	index         vector.VectorIndex
+	ownsIndex     bool // index is the default IVF/binary index built by the store
+	dim           int  // 0 until configured or fixed by the first vector
+	metric        vector.Metric
+	elemType      vector.ElementType
+	snapshotPath  string
 	Metrics       *metrics.Metrics
 	ctx           context.Context
+	stopRebalance context.CancelFunc // stops the default IVF index's rebalancer
 	opCount       int
 	snapshotEvery int
+	seq           uint64 // WAL LSN of the last applied mutation, recorded in snapshots
+
+	// background checkpointer; see Checkpoint
+	snapshotInterval time.Duration
+	checkpointMu     sync.Mutex    // serializes snapshot writes
+	lastCheckpoint   uint64        // seq of the newest snapshot, under checkpointMu
+	checkpointC      chan struct{} // wakes the checkpointer; writers never block on it
+	stopCheckpoint   chan struct{}
+	checkpointDone   chan struct{}
+}
+
+// Options configures a new store
+type Options struct {
+	// Index is the vector index to use; nil builds the default IVF index,
+	// or a BinaryIndex for binary element types
+	Index vector.VectorIndex
+	// ElementType is how vectors are encoded in Store.data, the WAL and
+	// snapshots; Set expects values in this encoding
+	ElementType vector.ElementType
+	// Dimension fixes the vector length; 0 takes it from the index, or
+	// from the first vector inserted or recovered
+	Dimension int
+	// Metric is used by the default IVF index; ignored when Index is set
+	Metric vector.Metric
+	// SnapshotPath is where snapshots are written and loaded; "" means data.snap
+	SnapshotPath string
+	// Analyzer turns document and query text into keyword terms; nil is
+	// analysis.Standard
+	Analyzer *analysis.Analyzer
+	// BM25 tunes keyword scoring
+	BM25 BM25Params
+	// Schema declares metadata field types that writes must match
+	Schema metadata.Schema
+	// SnapshotEvery wakes the background checkpointer after this many
+	// writes; 0 means 1000
+	SnapshotEvery int
+	// SnapshotInterval also checkpoints on a timer when there were writes
+	// since the last snapshot; 0 checkpoints on SnapshotEvery alone
+	SnapshotInterval time.Duration
 }
 
-// NewStore creates and returns a pointer to a new store
+// NewStore creates and returns a pointer to a new store backed by an IVF index
 func NewStore(ctx context.Context, w *wal.WAL) (*Store, error) {
-	// Use 384 dimensions for Real World compatibility (e.g. all-MiniLM-L6-v2)
-	centroids := vector.RandomCentroids(2, 384)
-	index := vector.NewIVFIndex(centroids, 3)
+	return NewStoreWithOptions(ctx, w, Options{})
+}
+
+// NewStoreWithIndex creates a store that uses the given vector index
+// (e.g. vector.NewHNSWIndex) instead of the default IVF index
+func NewStoreWithIndex(ctx context.Context, w *wal.WAL, index vector.VectorIndex) (*Store, error) {
+	return NewStoreWithOptions(ctx, w, Options{Index: index})
+}
 
+// NewStoreWithOptions creates a store from explicit options
+func NewStoreWithOptions(ctx context.Context, w *wal.WAL, opts Options) (*Store, error) {
 	s := &Store{
 		data:          make(map[string][]byte),
 		meta:          make(map[string]Metadata), // <--- Initialize metadata map
+		text:          make(map[string]string),
+		keyword:       newKeywordIndex(opts.Analyzer, opts.BM25),
+		schema:        opts.Schema,
 		wal:           w,
-		index:         index,
+		index:         opts.Index,
+		metric:        opts.Metric,
+		elemType:      opts.ElementType,
+		snapshotPath:  opts.SnapshotPath,
 		opCount:       0,
-		snapshotEvery: 1000, // Set to 1000 for real use (10 was for testing)
+		snapshotEvery: opts.SnapshotEvery,
 		ctx:           ctx,
+
+		snapshotInterval: opts.SnapshotInterval,
+		checkpointC:      make(chan struct{}, 1),
+	}
+
+	if s.snapshotPath == "" {
+		s.snapshotPath = "data.snap"
+	}
+	if s.snapshotEvery <= 0 {
+		s.snapshotEvery = 1000
+	}
+
+	dim := opts.Dimension
+	if dim == 0 && opts.Index != nil {
+		dim = opts.Index.Dim()
+	}
+
+	if dim != 0 {
+		if err := s.initDimension(dim); err != nil {
+			return nil, err
+		}
 	}
 
 	// 1. Try to load Snapshot first
-	if err := s.LoadSnapshot("data.snap"); err != nil {
-		// It's okay if snapshot doesn't exist yet
+	// A missing snapshot is fine; a corrupt one must not be silently
+	// replaced by an empty store, since the WAL it covered is gone
+	if err := s.LoadSnapshot(s.snapshotPath); err != nil {
+		return nil, err
 	}
+	s.lastCheckpoint = s.seq
 
 	// 2. Replay WAL (only events AFTER the snapshot)
 	if w != nil {
-		if err := w.Replay(s); err != nil {
+		if err := w.ReplayFrom(s.seq, s); err != nil {
 			return nil, err
 		}
+
+		// new records must sort after everything the snapshot covers
+		if err := w.AdvanceTo(s.seq); err != nil {
+			return nil, err
+		}
+		s.seq = w.LastLSN()
+	}
+
+	// Random centroids put almost everything in one list, so learn real
+	// ones as soon as there is enough recovered data to train on
+	if _, ok := s.index.(*vector.IVFIndex); ok && s.ownsIndex && len(s.data) >= minTrainingVectors {
+		if err := s.TrainIndex(0, trainingSampleSize); err != nil {
+			fmt.Printf("Error training index: %v\n", err)
+		}
+	}
+	s.trainQuantizer()
+
+	// 3. Snapshots are taken in the background from here on
+	if w != nil {
+		s.stopCheckpoint = make(chan struct{})
+		s.checkpointDone = make(chan struct{})
+		go s.runCheckpointer()
 	}
 
 	return s, nil
 }
 
-// Set stores a value for a given key
-func (s *Store) Set(key string, value []byte,metadata Metadata) error {
+// initDimension fixes the store's vector dimension and, unless an index was
+// supplied, builds the default one for it. Caller holds the lock (or the
+// store is not shared yet).
+func (s *Store) initDimension(dim int) error {
+	if err := s.validateDimension(dim); err != nil {
+		return err
+	}
+
+	if s.index != nil {
+		s.dim = dim
+		return nil
+	}
+
+	if s.elemType == vector.ElementBinary {
+		s.index = vector.NewBinaryIndex(dim)
+	} else {
+		ivf := vector.NewIVFIndexWithMetric(vector.RandomCentroids(2, dim), 3, s.metric)
+
+		// Keep lists balanced as bursty, topic-skewed ingestion shifts the
+		// data, until the store is closed
+		ctx, cancel := context.WithCancel(s.ctx)
+		ivf.StartAutoRebalance(ctx, vector.DefaultRebalanceConfig())
+		s.stopRebalance = cancel
+		s.index = ivf
+	}
+
+	s.ownsIndex = true
+	s.dim = dim
+	return nil
+}
+
+// validateDimension reports whether the store accepts vectors of dim
+// components, without fixing the dimension. Caller holds the lock.
+func (s *Store) validateDimension(dim int) error {
+	if s.dim != 0 {
+		if dim != s.dim {
+			return &vector.DimensionError{Expected: s.dim, Got: dim}
+		}
+		return nil
+	}
+
+	if dim <= 0 {
+		return fmt.Errorf("%w: dimension must be positive, got %d", ErrInvalidVector, dim)
+	}
+	if s.index != nil {
+		if d := s.index.Dim(); d != 0 && d != dim {
+			return &vector.DimensionError{Expected: d, Got: dim}
+		}
+	} else if s.elemType == vector.ElementBinary && dim%8 != 0 {
+		return fmt.Errorf("%w: binary dimension must be a multiple of 8, got %d", ErrInvalidVector, dim)
+	}
+
+	return nil
+}
+
+// checkDimension validates a vector length against the store, fixing the
+// dimension on the first vector. Caller holds the write lock.
+func (s *Store) checkDimension(dim int) error {
+	if s.dim == 0 {
+		return s.initDimension(dim)
+	}
+
+	return s.validateDimension(dim)
+}
+
+// valueDimension validates an encoded vector and returns its dimension.
+// It does not fix the store's dimension: writes do that once logged, so a
+// failed append leaves the store as it was. Caller holds the lock.
+func (s *Store) valueDimension(value []byte) (int, error) {
+	dim := len(s.decodeVector(value))
+	if s.elemType.EncodedSize(dim) != len(value) {
+		return 0, fmt.Errorf("%w: %d bytes is not a whole number of %s components", ErrInvalidVector, len(value), s.elemType)
+	}
+
+	return dim, s.validateDimension(dim)
+}
+
+// Dimension is the vector length the store accepts; 0 means not yet known
+func (s *Store) Dimension() int {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	return s.dim
+}
+
+// CheckDimension returns a *vector.DimensionError if vec cannot be searched
+// against or inserted into the store, or an error wrapping ErrInvalidVector
+// if no store could take it. Before the dimension is known any length the
+// index and element type allow is accepted.
+func (s *Store) CheckDimension(vec []float32) error {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	return s.validateDimension(len(vec))
+}
+
+// Texts returns the document text of each id, "" where there is none
+func (s *Store) Texts(ids []string) []string {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	out := make([]string, len(ids))
+	for i, id := range ids {
+		out[i] = s.text[id]
+	}
+
+	return out
+}
+
+// Len is the number of stored keys
+func (s *Store) Len() int {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	return len(s.data)
+}
+
+// Metric is the metric search results are scored with
+func (s *Store) Metric() vector.Metric {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	if s.index != nil {
+		return s.index.Metric()
+	}
+	return s.metric
+}
+
+// ElementType is the encoding Set expects vector values in
+func (s *Store) ElementType() vector.ElementType {
+	return s.elemType
+}
+
+// Set stores a value for a given key, with optional metadata and document
+// text. The text is what keyword search matches; "" means the key has none.
+// Metadata that does not match the store's schema is rejected with an error
+// wrapping metadata.ErrSchema.
+func (s *Store) Set(key string, value []byte,metadata Metadata, text string) error {
 	// 1. Check for shutdown
 	select {
 	case <-s.ctx.Done():
@@ -68,36 +328,44 @@ func (s *Store) Set(key string, value []byte,metadata Metadata) error {
 	default:
 	}
 
-	// 2. Write to WAL first
-	if s.wal != nil {
-		if err := s.wal.LogSet(key, value,metadata); err != nil {
-			return err
-		}
+	metadata, err := s.schema.Check(metadata)
+	if err != nil {
+		return err
 	}
 
-	// 3. LOCK HERE (The only lock)
+	// 2. LOCK HERE
 	s.mu.Lock()
-	// NOTE: We DO NOT defer Unlock() here because we might unlock early for snapshots
-
-	// 4. Update Memory (Calls internal function)
-	s.ApplySet(key, value,metadata)
+	// NOTE: We DO NOT defer Unlock() here because we wait for the WAL after unlocking
 
-	// 5. Snapshot Trigger
-	s.opCount++
-	if s.wal != nil && s.opCount%s.snapshotEvery == 0 {
-		// UNLOCK BEFORE SNAPSHOT to avoid deadlock
+	// 3. Reject vectors of the wrong length before they reach the WAL.
+	// The first vector fixes the dimension when none was configured, but
+	// only once ApplySet runs after it is logged.
+	if _, err := s.valueDimension(value); err != nil {
 		s.mu.Unlock()
+		return err
+	}
 
-		if err := s.SaveSnapShot("data.snap"); err != nil {
-			fmt.Printf("Error saving snapshot: %v\n", err)
-		} else {
-			if err := s.wal.Reset(); err != nil {
-				fmt.Printf("Error resetting WAL: %v\n", err)
-			}
-		}
-	} else {
-		// Normal unlock
+	// 4. Write to WAL first. Logging under the lock keeps LSN order equal to
+	// apply order, so s.seq is exactly what a snapshot covers.
+	if err := s.logSet(key, value, metadata, text); err != nil {
 		s.mu.Unlock()
+		return err
+	}
+
+	lsn := s.seq
+
+	// 5. Update Memory (Calls internal function)
+	s.ApplySet(key, value,metadata, text)
+
+	// 6. Snapshot Trigger: the checkpointer does the work in the background
+	s.countOps(1)
+	s.mu.Unlock()
+
+	// 7. Wait outside the lock for the WAL's sync mode, so concurrent writers
+	// can share a group commit. The write is already visible to readers;
+	// returning nil is the acknowledgement, see wal.SyncMode for what it covers.
+	if err := s.waitDurable(lsn); err != nil {
+		return err
 	}
 
 	if s.Metrics != nil {
@@ -136,38 +404,323 @@ func (s *Store) Delete(key string) error {
 	default:
 	}
 
-	if s.wal != nil {
-		if err := s.wal.LogDelete(key); err != nil {
-			return err
-		}
-	}
-
 	s.mu.Lock()
 	// No defer here either
 
+	if err := s.logDelete(key); err != nil {
+		s.mu.Unlock()
+		return err
+	}
+
+	lsn := s.seq
 	s.ApplyDelete(key)
 
-	s.opCount++
-	if s.wal != nil && s.opCount%s.snapshotEvery == 0 {
+	s.countOps(1)
+	s.mu.Unlock()
+
+	if err := s.waitDurable(lsn); err != nil {
+		return err
+	}
+
+	if s.Metrics != nil {
+		s.Metrics.IncDeletes()
+	}
+
+	return nil
+}
+
+// BatchItem is one write in a SetBatch
+type BatchItem struct {
+	Key      string
+	Value    []byte
+	Metadata Metadata
+	Text     string
+}
+
+// SetBatch writes many values with one lock acquisition and one WAL record.
+// Items that cannot be stored (a vector of the wrong length, metadata that
+// does not match the schema) are left out
+// and reported in the returned slice, which has an entry per item, nil for
+// the ones written. The rest are logged and applied atomically: after a
+// crash either all of them are recovered or none are. The error is for
+// failures that reject the whole batch, such as the WAL being unwritable.
+func (s *Store) SetBatch(items []BatchItem) ([]error, error) {
+	select {
+	case <-s.ctx.Done():
+		return nil, fmt.Errorf("store shutting down")
+	default:
+	}
+
+	errs := make([]error, len(items))
+	entries := make([]wal.Record, 0, len(items))
+
+	s.mu.Lock()
+
+	// the first valid item fixes the dimension for the rest, as it will
+	// for the store once the batch is logged
+	dim := s.dim
+	for i, item := range items {
+		d, err := s.valueDimension(item.Value)
+		if err == nil && dim != 0 && d != dim {
+			err = &vector.DimensionError{Expected: dim, Got: d}
+		}
+		if err != nil {
+			errs[i] = err
+			continue
+		}
+
+		meta, err := s.schema.Check(item.Metadata)
+		if err != nil {
+			errs[i] = err
+			continue
+		}
+		dim = d
+		entries = append(entries, wal.Record{Op: wal.OpSet, Key: item.Key, Value: item.Value, Metadata: meta, Text: item.Text})
+	}
+
+	if len(entries) == 0 {
 		s.mu.Unlock()
-		if err := s.SaveSnapShot("data.snap"); err != nil {
-			fmt.Printf("Error saving snapshot: %v\n", err)
-		} else {
-			if err := s.wal.Reset(); err != nil {
-				fmt.Printf("Error resetting WAL: %v\n", err)
-			}
+		return errs, nil
+	}
+
+	if err := s.logBatch(entries); err != nil {
+		s.mu.Unlock()
+		return errs, err
+	}
+
+	lsn := s.seq
+	for _, e := range entries {
+		s.ApplySet(e.Key, e.Value, e.Metadata, e.Text)
+	}
+
+	s.countOps(len(entries))
+	s.mu.Unlock()
+
+	if err := s.waitDurable(lsn); err != nil {
+		return errs, err
+	}
+
+	if s.Metrics != nil {
+		for range entries {
+			s.Metrics.IncWrites()
 		}
-	} else {
+	}
+
+	return errs, nil
+}
+
+// DeleteBatch removes keys with one lock acquisition and one WAL record,
+// atomically in the same way as SetBatch
+func (s *Store) DeleteBatch(keys []string) error {
+	select {
+	case <-s.ctx.Done():
+		return fmt.Errorf("store shutting down")
+	default:
+	}
+
+	if len(keys) == 0 {
+		return nil
+	}
+
+	entries := make([]wal.Record, len(keys))
+	for i, key := range keys {
+		entries[i] = wal.Record{Op: wal.OpDelete, Key: key}
+	}
+
+	s.mu.Lock()
+
+	if err := s.logBatch(entries); err != nil {
 		s.mu.Unlock()
+		return err
+	}
+
+	lsn := s.seq
+	for _, key := range keys {
+		s.ApplyDelete(key)
+	}
+
+	s.countOps(len(keys))
+	s.mu.Unlock()
+
+	if err := s.waitDurable(lsn); err != nil {
+		return err
 	}
 
 	if s.Metrics != nil {
-		s.Metrics.IncDeletes()
+		for range keys {
+			s.Metrics.IncDeletes()
+		}
+	}
+
+	return nil
+}
+
+// countOps adds n writes to opCount and wakes the checkpointer if that
+// crossed a multiple of snapshotEvery. Caller holds the write lock.
+func (s *Store) countOps(n int) {
+	before := s.opCount / s.snapshotEvery
+	s.opCount += n
+	if s.opCount/s.snapshotEvery != before {
+		s.requestCheckpoint()
+	}
+}
+
+// logSet writes a set to the WAL and advances s.seq to its LSN; without a
+// WAL the sequence just counts mutations. Caller holds the write lock.
+func (s *Store) logSet(key string, value []byte, metadata Metadata, text string) error {
+	if s.wal == nil {
+		s.seq++
+		return nil
+	}
+
+	lsn, err := s.wal.AppendSet(key, value, metadata, text)
+	if err != nil {
+		return err
+	}
+
+	s.seq = lsn
+	return nil
+}
+
+// logDelete is logSet for deletes
+func (s *Store) logDelete(key string) error {
+	if s.wal == nil {
+		s.seq++
+		return nil
 	}
 
+	lsn, err := s.wal.AppendDelete(key)
+	if err != nil {
+		return err
+	}
+
+	s.seq = lsn
+	return nil
+}
+
+// logBatch is logSet for a batch, which takes a single LSN
+func (s *Store) logBatch(entries []wal.Record) error {
+	if s.wal == nil {
+		s.seq++
+		return nil
+	}
+
+	lsn, err := s.wal.AppendBatch(entries)
+	if err != nil {
+		return err
+	}
+
+	s.seq = lsn
 	return nil
 }
 
+// waitDurable blocks until the WAL record at lsn is as durable as the WAL's
+// sync mode promises. Caller must not hold the lock.
+func (s *Store) waitDurable(lsn uint64) error {
+	if s.wal == nil {
+		return nil
+	}
+
+	return s.wal.WaitDurable(lsn)
+}
+
+// requestCheckpoint wakes the checkpointer without waiting for it; a
+// request made while one is already pending is folded into it
+func (s *Store) requestCheckpoint() {
+	select {
+	case s.checkpointC <- struct{}{}:
+	default:
+	}
+}
+
+// runCheckpointer checkpoints whenever writers ask for it and, with a
+// SnapshotInterval, on a timer, until the store is closed
+func (s *Store) runCheckpointer() {
+	defer close(s.checkpointDone)
+
+	var tick <-chan time.Time
+	if s.snapshotInterval > 0 {
+		ticker := time.NewTicker(s.snapshotInterval)
+		defer ticker.Stop()
+		tick = ticker.C
+	}
+
+	for {
+		select {
+		case <-s.ctx.Done():
+			return
+		case <-s.stopCheckpoint:
+			return
+		case <-s.checkpointC:
+		case <-tick:
+		}
+
+		// trained first, so the snapshot holds the codebooks
+		s.trainQuantizer()
+
+		if err := s.Checkpoint(); err != nil {
+			fmt.Printf("Error saving snapshot: %v\n", err)
+		}
+	}
+}
+
+// trainQuantizer trains an IVF-PQ index that has no codebooks yet once the
+// store holds minTrainingVectors. Until then the index keeps full float32
+// copies and searches them exhaustively, so stores that grow past the
+// threshold are trained by the checkpointer, without waiting for a restart.
+func (s *Store) trainQuantizer() {
+	s.mu.RLock()
+	pq, ok := s.index.(*vector.IVFPQIndex)
+	n := len(s.data)
+	s.mu.RUnlock()
+
+	if !ok || n < minTrainingVectors || pq.Trained() {
+		return
+	}
+
+	if err := s.TrainIndex(0, trainingSampleSize); err != nil && !errors.Is(err, vector.ErrRetrainInProgress) {
+		fmt.Printf("Error training index: %v\n", err)
+	}
+}
+
+// Checkpoint snapshots the store as of now and drops the WAL segments the
+// snapshot covers. Only capturing the state holds the read lock; writes
+// carry on while it is written out, land after the captured sequence and
+// so stay in the log. It does nothing if there were no writes since the
+// last snapshot.
+func (s *Store) Checkpoint() error {
+	s.checkpointMu.Lock()
+	defer s.checkpointMu.Unlock()
+
+	s.mu.RLock()
+	seq := s.seq
+	s.mu.RUnlock()
+
+	if seq == s.lastCheckpoint {
+		return nil
+	}
+
+	seq, err := s.saveSnapshotLocked(s.snapshotPath)
+	if err != nil {
+		return err
+	}
+	s.lastCheckpoint = seq
+
+	if s.wal == nil {
+		return nil
+	}
+
+	return s.wal.Truncate(seq)
+}
+
+// decodeVector decodes a stored value in the store's element type
+func (s *Store) decodeVector(b []byte) []float32 {
+	if s.elemType == vector.ElementFloat32 {
+		return bytesToVector(b)
+	}
+	return vector.DecodeVector(b, s.elemType)
+}
+
 // changed from here down
 func bytesToVector(b []byte) []float32 {
 	// A float32 takes 4 bytes. So if we have 12 bytes, we have 3 floats.
@@ -183,63 +736,223 @@ func bytesToVector(b []byte) []float32 {
 	return vec
 }
 
+// SearchOptions tunes a single vector search
+type SearchOptions struct {
+	// RescoreFactor > 1 over-fetches k*RescoreFactor candidates from the
+	// quantized index and re-ranks them against the stored float32 vectors
+	RescoreFactor int
+	// Filter restricts results by metadata, on top of the exact matches in
+	// the filter map
+	Filter query.Filter
+}
+
 func (s *Store) VectorSearch(query []float32, k int,filterMap map[string]string) []vector.Result {
+	return s.VectorSearchWithOptions(query, k, filterMap, SearchOptions{})
+}
+
+// VectorSearchWithOptions is VectorSearch with per-query tuning
+func (s *Store) VectorSearchWithOptions(query []float32, k int, filterMap map[string]string, opts SearchOptions) []vector.Result {
 	s.mu.RLock()
 	defer s.mu.RUnlock()
 
-	// Define the Bouncer Function
-	predicate := func(id string) bool {
-		// If no filter is requested, everyone is allowed
-		if len(filterMap) == 0 {
-			return true
+	return s.vectorSearchLocked(query, k, filterMap, opts)
+}
+
+func (s *Store) vectorSearchLocked(query []float32, k int, filterMap map[string]string, opts SearchOptions) []vector.Result {
+	// Nothing indexed yet, or a query the index cannot score
+	if s.index == nil || len(query) != s.dim {
+		return nil
+	}
+
+	predicate := s.predicateLocked(filterMap, opts.Filter)
+
+	if opts.RescoreFactor <= 1 {
+		return s.index.Search(query, k,predicate)
+	}
+
+	// Re-rank with the original vectors from the same read-locked view
+	candidates := s.index.Search(query, k*opts.RescoreFactor, predicate)
+
+	return vector.Rescore(query, candidates, k, s.index.Metric(), func(id string) []float32 {
+		value, ok := s.data[id]
+		if !ok {
+			return nil
+		}
+		return s.decodeVector(value)
+	})
+}
+
+
+
+// predicateLocked compiles the exact-match map and the filter into the
+// predicate the index calls for each candidate; nil when neither is set
+func (s *Store) predicateLocked(filterMap map[string]string, filter query.Filter) func(id string) bool {
+	var filters query.And
+	if len(filterMap) > 0 {
+		filters = append(filters, query.Equals(filterMap))
+	}
+	if filter != nil {
+		filters = append(filters, filter)
+	}
+	if len(filters) == 0 {
+		return nil
+	}
+
+	return func(id string) bool {
+		return filters.Match(s.meta[id])
+	}
+}
+
+// TrainIndex learns k IVF centroids with k-means over a random sample of up
+// to sampleSize stored vectors and retrains the index with them. k <= 0 picks
+// sqrt(n) lists. The store stays online: only the sample is taken under the
+// read lock, and the index swaps its lists in once reassignment is done.
+// IVF-PQ indexes also get fresh product quantizer codebooks.
+func (s *Store) TrainIndex(k int, sampleSize int) error {
+	var dim int
+	var metric vector.Metric
+
+	s.mu.RLock()
+	index := s.index
+	s.mu.RUnlock()
+
+	switch idx := index.(type) {
+	case *vector.IVFIndex:
+		dim, metric = idx.Dim(), idx.Metric()
+	case *vector.IVFPQIndex:
+		dim, metric = idx.Dim(), idx.Metric()
+	default:
+		return fmt.Errorf("index does not support training")
+	}
+
+	s.mu.RLock()
+	samples := vector.SampleVectors(s.data, sampleSize, dim, s.elemType)
+	s.mu.RUnlock()
+
+	if len(samples) == 0 {
+		return fmt.Errorf("no vectors to train on")
+	}
+
+	if k <= 0 {
+		k = int(math.Sqrt(float64(len(samples))))
+	}
+
+	centroids := vector.TrainKMeans(samples, vector.KMeansConfig{
+		K:         k,
+		MaxIter:   25,
+		BatchSize: 1024,
+		Tolerance: 1e-4,
+		Metric:    metric,
+	})
+
+	switch idx := index.(type) {
+	case *vector.IVFIndex:
+		if err := idx.Retrain(centroids); err != nil {
+			return err
 		}
 
-		// Get the metadata for this candidate ID
-		meta, exists := s.meta[id]
-		if !exists {
-			return false // No metadata? Blocked.
+		// scan roughly a quarter of the lists per query
+		idx.SetProbes(len(centroids)/4 + 1)
+
+	case *vector.IVFPQIndex:
+		pq, err := vector.TrainProductQuantizer(samples, idx.Subspaces(), 15)
+		if err != nil {
+			return err
 		}
 
-		// Check if it matches ALL criteria
-		for key, requiredValue := range filterMap {
-			if meta[key] != requiredValue {
-				return false // Mismatch? Blocked.
+		// codes are rebuilt from the original vectors; the map is copied so
+		// encoding can run without holding the store lock. Writes hold the
+		// write lock, so starting the retrain under the read lock records
+		// every write the copy misses.
+		s.mu.RLock()
+		if err := idx.BeginRetrain(); err != nil {
+			s.mu.RUnlock()
+			return err
+		}
+		data := make(map[string][]byte, len(s.data))
+		for key, value := range s.data {
+			if s.elemType != vector.ElementFloat32 {
+				value = vector.EncodeVector(s.decodeVector(value), vector.ElementFloat32)
 			}
+			data[key] = value
 		}
-		return true // Allowed!
-	}
+		s.mu.RUnlock()
 
-	return s.index.Search(query, k,predicate)
-}
+		if err := idx.FinishRetrain(centroids, pq, data); err != nil {
+			return err
+		}
 
+		idx.SetProbes(len(centroids)/4 + 1)
+	}
 
+	return nil
+}
 
 // --- INTERNAL FUNCTIONS (NO LOCKS) ---
 // These are called by Set/Delete which ALREADY hold the lock.
 
-func (s *Store) ApplySet(key string, value []byte,metadata map[string]string) {
+func (s *Store) ApplySet(key string, value []byte,metadata Metadata, text string) {
 	// REMOVED LOCK
+	_, existed := s.data[key]
 	s.data[key] = value
-	s.meta[key] = Metadata(metadata) // <--- Store the metadata in RAM
-	s.index.Remove(key)
-	vec := bytesToVector(value)
-	if vec != nil {
-		s.index.Add(key, vec)
+	s.meta[key] = metadata // <--- Store the metadata in RAM
+
+	if old, ok := s.text[key]; ok {
+		s.keyword.remove(key, old)
+	}
+	if text != "" {
+		s.text[key] = text
+		s.keyword.add(key, text)
+	} else {
+		delete(s.text, key)
+	}
+
+	// Set validated the length already; this guards WAL replay
+	vec := s.decodeVector(value)
+	if err := s.checkDimension(len(vec)); err != nil {
+		fmt.Printf("Not indexing %q: %v\n", key, err)
+		if s.index != nil {
+			s.index.Remove(key)
+		}
+		return
+	}
+
+	// a new key cannot be in the index, so skip the removal scan
+	if existed {
+		s.index.Remove(key)
 	}
+	s.index.Add(key, vec)
 }
 
 func (s *Store) ApplyDelete(key string) {
 	// REMOVED LOCK
 	delete(s.data, key)
 	delete(s.meta, key) // <--- Remove metadata from RAM
-	s.index.Remove(key)
+	if old, ok := s.text[key]; ok {
+		s.keyword.remove(key, old)
+		delete(s.text, key)
+	}
+	if s.index != nil {
+		s.index.Remove(key)
+	}
 	// REMOVED UNLOCK
 }
 
 func (s *Store) Close() error {
+	if s.stopCheckpoint != nil {
+		close(s.stopCheckpoint)
+		<-s.checkpointDone
+		s.stopCheckpoint = nil
+	}
+
 	s.mu.Lock()
 	defer s.mu.Unlock()
 
+	if s.stopRebalance != nil {
+		s.stopRebalance()
+		s.stopRebalance = nil
+	}
+
 	if s.wal != nil {
 		return s.wal.Close()
 	}
@@ -4,8 +4,12 @@ package storage
 
 import (
 	"context"
+	"path/filepath"
 	"strconv"
+	"sync/atomic"
 	"testing"
+
+	"flashvector/wal"
 )
 
 // --- HELPER FUNCTION ---
@@ -27,7 +31,7 @@ func BenchmarkStoreSet(b *testing.B) {
 
 	for i := 0; i < b.N; i++ {
 		key := "key-" + strconv.Itoa(i)
-		store.Set(key, data,nil) // <--- Now sends 8 bytes, not 5
+		store.Set(key, data,nil, "") // <--- Now sends 8 bytes, not 5
 	}
 }
 
@@ -38,7 +42,7 @@ func BenchmarkStoreGet(b *testing.B) {
 
 	// Pre-populate 1000 items
 	for i := 0; i < 1000; i++ {
-		store.Set("key-"+strconv.Itoa(i), data,nil)
+		store.Set("key-"+strconv.Itoa(i), data,nil, "")
 	}
 
 	b.ResetTimer()
@@ -57,11 +61,53 @@ func BenchmarkStoreDelete(b *testing.B) {
 	// Stop timer so setup doesn't ruin the benchmark result
 	b.StopTimer()
 	for i := 0; i < b.N; i++ {
-		store.Set("key-"+strconv.Itoa(i), data,nil)
+		store.Set("key-"+strconv.Itoa(i), data,nil, "")
 	}
 	b.StartTimer()
 
 	for i := 0; i < b.N; i++ {
 		store.Delete("key-" + strconv.Itoa(i))
 	}
-}
\ No newline at end of file
+}
+
+// BenchmarkStoreSetDurability runs concurrent writers against a real WAL in
+// each sync mode. "always" pays one fsync per write, "group" shares one
+// fsync between everyone who arrives within the window, and "periodic"
+// never waits for the disk at all.
+func BenchmarkStoreSetDurability(b *testing.B) {
+	modes := []wal.SyncMode{wal.SyncAlways, wal.SyncGroup, wal.SyncPeriodic}
+
+	for _, mode := range modes {
+		b.Run(mode.String(), func(b *testing.B) {
+			ctx := context.Background()
+			dir := b.TempDir()
+
+			w, err := wal.OpenWithOptions(filepath.Join(dir, "data.wal"), wal.Options{Sync: mode})
+			if err != nil {
+				b.Fatal(err)
+			}
+
+			store, err := NewStoreWithOptions(ctx, w, Options{SnapshotPath: filepath.Join(dir, "data.snap")})
+			if err != nil {
+				b.Fatal(err)
+			}
+			defer store.Close()
+
+			data := mockDataBench("val")
+			var next atomic.Int64
+
+			b.SetParallelism(8)
+			b.ResetTimer()
+
+			b.RunParallel(func(pb *testing.PB) {
+				for pb.Next() {
+					key := "key-" + strconv.FormatInt(next.Add(1), 10)
+					if err := store.Set(key, data, nil, ""); err != nil {
+						b.Error(err)
+						return
+					}
+				}
+			})
+		})
+	}
+}
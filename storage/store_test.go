@@ -3,7 +3,19 @@ package storage
 import (
 	"bytes"
 	"context"
+	"encoding/binary"
+	"errors"
+	"flashvector/metadata"
+	"flashvector/vector"
+	"flashvector/wal"
+	"math"
+	"math/rand"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strconv"
 	"testing"
+	"time"
 )
 
 // Helper to create 8-byte vectors (Matches your NewStore configuration)
@@ -20,7 +32,7 @@ func TestSetAndGet(t *testing.T) {
 	// FIX: Use mockDataTest instead of raw strings
 	val := mockDataTest("val1")
 	
-	if err := store.Set("key1", val,nil); err != nil {
+	if err := store.Set("key1", val,nil, ""); err != nil {
 		t.Fatal(err)
 	}
 
@@ -39,7 +51,7 @@ func TestDelete(t *testing.T) {
 	store, _ := NewStore(ctx, nil)
 
 	// FIX: Use mockDataTest
-	if err := store.Set("key2", mockDataTest("val2"),nil); err != nil {
+	if err := store.Set("key2", mockDataTest("val2"),nil, ""); err != nil {
 		t.Fatal(err)
 	}
 	if err := store.Delete("key2"); err != nil {
@@ -62,7 +74,7 @@ func TestConcurrentAccess(t *testing.T) {
 		go func(i int) {
 			key := "key"
 			// FIX: Use mockDataTest
-			if err := store.Set(key, mockDataTest("val"),nil); err != nil {
+			if err := store.Set(key, mockDataTest("val"),nil, ""); err != nil {
 				t.Error(err)
 			}
 
@@ -78,4 +90,455 @@ func TestConcurrentAccess(t *testing.T) {
 	for i := 0; i < 100; i++ {
 		<-done
 	}
-}
\ No newline at end of file
+}
+func TestTrainIndex(t *testing.T) {
+	ctx := context.Background()
+	store, _ := NewStore(ctx, nil)
+
+	for i := 0; i < 500; i++ {
+		vec := make([]float32, 384)
+		vec[i%8] = 1
+		vec[8+i%5] = 0.5
+		if err := store.Set("key-"+strconv.Itoa(i), floatsToBytesTest(vec), nil, ""); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if err := store.TrainIndex(8, 500); err != nil {
+		t.Fatal(err)
+	}
+
+	query := make([]float32, 384)
+	query[3] = 1
+	query[8+3] = 0.5
+
+	results := store.VectorSearch(query, 1, nil)
+	if len(results) != 1 || results[0].Score < 0.99 {
+		t.Fatalf("expected an exact match after training, got %v", results)
+	}
+}
+
+func floatsToBytesTest(floats []float32) []byte {
+	b := make([]byte, len(floats)*4)
+	for i, f := range floats {
+		binary.LittleEndian.PutUint32(b[i*4:(i+1)*4], math.Float32bits(f))
+	}
+	return b
+}
+
+func TestVectorSearchRescore(t *testing.T) {
+	ctx := context.Background()
+	store, _ := NewStore(ctx, nil)
+
+	for i := 0; i < 50; i++ {
+		vec := make([]float32, 384)
+		vec[0] = 1
+		vec[1] = float32(i) / 100
+		if err := store.Set("key-"+strconv.Itoa(i), floatsToBytesTest(vec), nil, ""); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	query := make([]float32, 384)
+	query[0] = 1
+	query[1] = 0.2
+
+	results := store.VectorSearchWithOptions(query, 3, nil, SearchOptions{RescoreFactor: 5})
+	if len(results) != 3 {
+		t.Fatalf("expected 3 results, got %d", len(results))
+	}
+	if results[0].ID != "key-20" {
+		t.Errorf("expected key-20 first after rescoring, got %s", results[0].ID)
+	}
+	for i := 1; i < len(results); i++ {
+		if results[i].Score > results[i-1].Score {
+			t.Errorf("results not ordered by score: %v", results)
+		}
+	}
+}
+
+func TestSnapshotKeepsPQCodebooks(t *testing.T) {
+	ctx := context.Background()
+	path := t.TempDir() + "/pq.snap"
+
+	newPQStore := func() (*Store, *vector.IVFPQIndex) {
+		index := vector.NewIVFPQIndex(vector.RandomCentroids(1, 384), 48, 2, vector.MetricCosine)
+		store, err := NewStoreWithIndex(ctx, nil, index)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return store, index
+	}
+
+	store, index := newPQStore()
+	for i := 0; i < 300; i++ {
+		vec := make([]float32, 384)
+		vec[i%384] = 1
+		vec[(i*7)%384] += 0.5
+		store.Set("key-"+strconv.Itoa(i), floatsToBytesTest(vec), nil, "")
+	}
+
+	if err := store.TrainIndex(4, 300); err != nil {
+		t.Fatal(err)
+	}
+	if err := store.SaveSnapShot(path); err != nil {
+		t.Fatal(err)
+	}
+
+	restored, restoredIndex := newPQStore()
+	if err := restored.LoadSnapshot(path); err != nil {
+		t.Fatal(err)
+	}
+
+	if !restoredIndex.Trained() {
+		t.Fatalf("codebooks were not restored from the snapshot")
+	}
+
+	before := index.State().Quantizer.Codebooks[0][0]
+	after := restoredIndex.State().Quantizer.Codebooks[0][0]
+	for i := range before {
+		if before[i] != after[i] {
+			t.Fatalf("restored codebook differs from the trained one")
+		}
+	}
+}
+
+func TestPQTrainingKeepsConcurrentWrites(t *testing.T) {
+	index := vector.NewIVFPQIndex(vector.RandomCentroids(1, 32), 8, 1, vector.MetricCosine)
+	store, err := NewStoreWithIndex(context.Background(), nil, index)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer store.Close()
+
+	rng := rand.New(rand.NewSource(2))
+	randomVec := func() []byte {
+		vec := make([]float32, 32)
+		for j := range vec {
+			vec[j] = rng.Float32()*2 - 1
+		}
+		return floatsToBytesTest(vec)
+	}
+	for i := 0; i < 2000; i++ {
+		if err := store.Set("key-"+strconv.Itoa(i), randomVec(), nil, ""); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// writes keep landing from before the data is copied until the swap,
+	// including on first training, when the raw vectors are replaced
+	done := make(chan struct{})
+	writerDone := make(chan struct{})
+	go func() {
+		defer close(writerDone)
+		for i := 0; i < 5000; i++ {
+			select {
+			case <-done:
+				return
+			default:
+			}
+			if err := store.Set("new-"+strconv.Itoa(i), randomVec(), nil, ""); err != nil {
+				t.Error(err)
+				return
+			}
+			if err := store.Delete("key-" + strconv.Itoa(i%2000)); err != nil {
+				t.Error(err)
+				return
+			}
+		}
+	}()
+
+	err = store.TrainIndex(8, 2000)
+	close(done)
+	<-writerDone
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// with every list probed, the index must hold exactly the stored keys
+	index.SetProbes(8)
+	seen := make(map[string]bool)
+	for _, r := range index.Search(make([]float32, 32), 1<<20, nil) {
+		if seen[r.ID] {
+			t.Fatalf("%s indexed twice", r.ID)
+		}
+		seen[r.ID] = true
+		if _, _, ok := store.Get(r.ID); !ok {
+			t.Fatalf("deleted key %s came back after training", r.ID)
+		}
+	}
+	if len(seen) != store.Len() {
+		t.Fatalf("expected %d indexed keys, got %d", store.Len(), len(seen))
+	}
+}
+
+func TestElementTypes(t *testing.T) {
+	ctx := context.Background()
+
+	for _, elem := range []vector.ElementType{vector.ElementFloat16, vector.ElementBinary} {
+		store, err := NewStoreWithOptions(ctx, nil, Options{ElementType: elem})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		for i := 0; i < 20; i++ {
+			vec := make([]float32, 384)
+			for j := range vec {
+				if (j+i)%3 == 0 {
+					vec[j] = 1
+				} else {
+					vec[j] = -1
+				}
+			}
+			value := vector.EncodeVector(vec, elem)
+			if len(value) != elem.EncodedSize(384) {
+				t.Fatalf("%s: unexpected encoded size %d", elem, len(value))
+			}
+			if err := store.Set("key-"+strconv.Itoa(i), value, nil, ""); err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		query := make([]float32, 384)
+		for j := range query {
+			if (j+4)%3 == 0 {
+				query[j] = 1
+			} else {
+				query[j] = -1
+			}
+		}
+
+		results := store.VectorSearch(query, 1, nil)
+		if len(results) != 1 {
+			t.Fatalf("%s: expected 1 result, got %d", elem, len(results))
+		}
+
+		// keys 1, 4, 7... share the pattern; any of them is an exact match
+		got, _, _ := store.Get(results[0].ID)
+		if !bytes.Equal(got, vector.EncodeVector(query, elem)) {
+			t.Errorf("%s: expected an exact match, got %s", elem, results[0].ID)
+		}
+	}
+}
+
+func TestDimensionFromFirstInsert(t *testing.T) {
+	ctx := context.Background()
+	store, _ := NewStore(ctx, nil)
+
+	if store.Dimension() != 0 {
+		t.Fatalf("expected no dimension before the first insert, got %d", store.Dimension())
+	}
+
+	if err := store.Set("a", floatsToBytesTest([]float32{1, 0, 0}), nil, ""); err != nil {
+		t.Fatal(err)
+	}
+	if store.Dimension() != 3 {
+		t.Fatalf("expected dimension 3, got %d", store.Dimension())
+	}
+
+	err := store.Set("b", floatsToBytesTest([]float32{1, 0}), nil, "")
+	var dimErr *vector.DimensionError
+	if !errors.As(err, &dimErr) || dimErr.Expected != 3 || dimErr.Got != 2 {
+		t.Fatalf("expected a dimension error, got %v", err)
+	}
+	if _, _, ok := store.Get("b"); ok {
+		t.Fatalf("mismatched vector should not be stored")
+	}
+
+	// a wrong-length query returns nothing instead of panicking
+	if results := store.VectorSearch([]float32{1, 0}, 1, nil); len(results) != 0 {
+		t.Fatalf("expected no results, got %v", results)
+	}
+	if results := store.VectorSearch([]float32{1, 0, 0}, 1, nil); len(results) != 1 || results[0].ID != "a" {
+		t.Fatalf("expected a, got %v", results)
+	}
+}
+
+func TestConfiguredDimension(t *testing.T) {
+	ctx := context.Background()
+	store, err := NewStoreWithOptions(ctx, nil, Options{Dimension: 4})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := store.CheckDimension([]float32{1, 2, 3}); err == nil {
+		t.Fatalf("expected a 3-dim query to be rejected")
+	}
+	if err := store.Set("a", floatsToBytesTest([]float32{1, 2, 3}), nil, ""); err == nil {
+		t.Fatalf("expected a 3-dim insert to be rejected")
+	}
+	if err := store.Set("a", floatsToBytesTest([]float32{1, 2, 3, 4}), nil, ""); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := NewStoreWithOptions(ctx, nil, Options{Dimension: 12, ElementType: vector.ElementBinary}); err == nil {
+		t.Fatalf("expected binary dimension not divisible by 8 to fail")
+	}
+}
+
+func TestSchemaValidatesMetadata(t *testing.T) {
+	schema := metadata.Schema{"price": metadata.Float, "stock": metadata.Int, "reported": metadata.Timestamp}
+	store, err := NewStoreWithOptions(context.Background(), nil, Options{Schema: schema})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	vec := floatsToBytesTest([]float32{1, 0})
+
+	// whole numbers for floats, integral floats for ints and dates for
+	// timestamps are converted; fields outside the schema take any type
+	err = store.Set("a", vec, Metadata{
+		"price":    metadata.IntValue(10),
+		"stock":    metadata.FloatValue(3),
+		"reported": metadata.StringValue("2024-03-01"),
+		"note":     metadata.BoolValue(true),
+	}, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, meta, _ := store.Get("a")
+	want := Metadata{
+		"price":    metadata.FloatValue(10),
+		"stock":    metadata.IntValue(3),
+		"reported": metadata.TimeValue(time.Date(2024, 3, 1, 0, 0, 0, 0, time.UTC)),
+		"note":     metadata.BoolValue(true),
+	}
+	if !reflect.DeepEqual(meta, want) {
+		t.Fatalf("got %v, want %v", meta, want)
+	}
+
+	for _, bad := range []Metadata{
+		{"price": metadata.StringValue("cheap")},
+		{"stock": metadata.FloatValue(2.5)},
+		{"reported": metadata.StringValue("yesterday")},
+	} {
+		if err := store.Set("b", vec, bad, ""); !errors.Is(err, metadata.ErrSchema) {
+			t.Fatalf("expected %v to be rejected, got %v", bad, err)
+		}
+	}
+
+	errs, err := store.SetBatch([]BatchItem{
+		{Key: "c", Value: vec, Metadata: Metadata{"stock": metadata.IntValue(1)}},
+		{Key: "d", Value: vec, Metadata: Metadata{"stock": metadata.ListValue("x")}},
+	})
+	if err != nil || errs[0] != nil || !errors.Is(errs[1], metadata.ErrSchema) {
+		t.Fatalf("expected only d to be rejected, got %v %v", errs, err)
+	}
+	if _, _, ok := store.Get("b"); ok || store.Len() != 2 {
+		t.Fatalf("expected rejected writes to store nothing, have %d keys", store.Len())
+	}
+}
+
+func TestDefaultIndexRebalancesAsItGrows(t *testing.T) {
+	store, err := NewStore(context.Background(), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer store.Close()
+
+	// an empty store never trains, so only rebalancing can give it more
+	// than its two starting lists
+	rng := rand.New(rand.NewSource(1))
+	vecs := make([][]float32, 20000)
+	for i := range vecs {
+		vecs[i] = make([]float32, 32)
+		for j := range vecs[i] {
+			vecs[i][j] = rng.Float32()*2 - 1
+		}
+		if err := store.Set(strconv.Itoa(i), floatsToBytesTest(vecs[i]), nil, ""); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	ivf := store.index.(*vector.IVFIndex)
+	for i := 0; i < 20; i++ {
+		changed, err := ivf.Rebalance(vector.DefaultRebalanceConfig())
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !changed {
+			break
+		}
+	}
+
+	lists := len(ivf.ListSizes())
+	if lists <= 2 {
+		t.Fatalf("expected the default config to split the starting lists, still have %d", lists)
+	}
+
+	// splitting lists must not leave each query scanning fewer vectors
+	hits, queries := 0, 50
+	for q := 0; q < queries; q++ {
+		query := vecs[rng.Intn(len(vecs))]
+
+		scores := make([]float32, len(vecs))
+		for i, v := range vecs {
+			scores[i] = vector.CosineSimilarity(query, v)
+		}
+		ids := make([]int, len(vecs))
+		for i := range ids {
+			ids[i] = i
+		}
+		sort.Slice(ids, func(a, b int) bool { return scores[ids[a]] > scores[ids[b]] })
+
+		want := make(map[string]bool, 10)
+		for _, id := range ids[:10] {
+			want[strconv.Itoa(id)] = true
+		}
+		for _, res := range store.VectorSearch(query, 10, nil) {
+			if want[res.ID] {
+				hits++
+			}
+		}
+	}
+
+	recall := float64(hits) / float64(queries*10)
+	t.Logf("%d lists, recall@10 %.2f", lists, recall)
+	if recall < 0.9 {
+		t.Fatalf("expected recall@10 of at least 0.9 after rebalancing into %d lists, got %.2f", lists, recall)
+	}
+}
+
+func TestInvalidVectorsAreRejectedWithoutSideEffects(t *testing.T) {
+	w, err := wal.Open(filepath.Join(t.TempDir(), "data.wal"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	store, err := NewStoreWithOptions(context.Background(), w, Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// a float32 value cut off mid-component is not silently truncated
+	if err := store.Set("a", []byte{1, 2, 3, 4, 5, 6, 7}, nil, ""); !errors.Is(err, ErrInvalidVector) {
+		t.Fatalf("expected ErrInvalidVector for 7 bytes, got %v", err)
+	}
+	if err := store.Set("a", nil, nil, ""); !errors.Is(err, ErrInvalidVector) {
+		t.Fatalf("expected ErrInvalidVector for an empty vector, got %v", err)
+	}
+
+	// a write that fails to log must not fix the dimension
+	w.Close()
+	if err := store.Set("a", floatsToBytesTest([]float32{1, 2, 3}), nil, ""); err == nil {
+		t.Fatal("expected the write to fail with the WAL closed")
+	}
+	errs, err := store.SetBatch([]BatchItem{{Key: "b", Value: floatsToBytesTest([]float32{1, 2})}})
+	if err == nil || errs[0] != nil {
+		t.Fatalf("expected the batch to fail as a whole, got %v %v", errs, err)
+	}
+	if d := store.Dimension(); d != 0 {
+		t.Fatalf("expected no dimension after failed writes, got %d", d)
+	}
+
+	binary, err := NewStoreWithOptions(context.Background(), nil, Options{ElementType: vector.ElementBinary})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := binary.CheckDimension(make([]float32, 12)); !errors.Is(err, ErrInvalidVector) {
+		t.Fatalf("expected a 12-bit binary vector to be invalid, got %v", err)
+	}
+	if err := binary.CheckDimension(make([]float32, 16)); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,136 @@
+package storage
+
+import (
+	"slices"
+
+	"flashvector/analysis"
+	"flashvector/metadata"
+	"flashvector/query"
+	"flashvector/vector"
+)
+
+// View is a read-only view of the store. Everything read through one View
+// sees the same state: no write lands between a search and the lookup of
+// its hits. A View is only valid inside the function passed to Store.View.
+type View struct {
+	s *Store
+}
+
+// View runs fn with the store read-locked. fn must not write to the store.
+func (s *Store) View(fn func(v View)) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	fn(View{s: s})
+}
+
+// VectorSearch is Store.VectorSearchWithOptions within the view
+func (v View) VectorSearch(query []float32, k int, filterMap map[string]string, opts SearchOptions) []vector.Result {
+	return v.s.vectorSearchLocked(query, k, filterMap, opts)
+}
+
+// KeywordSearch is Store.KeywordSearch within the view, keeping only
+// documents filter matches when it is set
+func (v View) KeywordSearch(q string, k int, filter query.Filter) []vector.Result {
+	return v.s.keyword.search(q, k, v.s.predicateLocked(nil, filter))
+}
+
+// AdaptiveSearch is Store.AdaptiveSearch within the view, keeping only
+// documents filter matches when it is set
+func (v View) AdaptiveSearch(text string, queryVector []float32, k int, rrfWeight int, filter query.Filter) []vector.Result {
+	return v.s.adaptiveSearchLocked(text, queryVector, k, rrfWeight, filter)
+}
+
+// Highlight is Store.Highlight within the view
+func (v View) Highlight(q string, ids []string, opts analysis.SnippetOptions) []Highlight {
+	return v.s.highlightLocked(q, ids, opts)
+}
+
+// Document is what a lookup returns for one key. Fields that were not
+// asked for, or that the key does not have, are left empty.
+type Document struct {
+	Metadata Metadata
+	Text     string
+	Vector   []float32
+}
+
+// Documents looks up the stored fields include asks for, one Document per
+// id; ids that are not stored get an empty Document
+func (v View) Documents(ids []string, include query.Include) []Document {
+	out := make([]Document, len(ids))
+
+	for i, id := range ids {
+		value, ok := v.s.data[id]
+		if !ok {
+			continue
+		}
+
+		doc := &out[i]
+		if include.Text {
+			doc.Text = v.s.text[id]
+		}
+		if include.Vector {
+			doc.Vector = v.s.decodeVector(value)
+		}
+		if include.Metadata || len(include.Fields) > 0 {
+			doc.Metadata = project(v.s.meta[id], include.Fields)
+		}
+	}
+
+	return out
+}
+
+// project copies meta, keeping only fields when any are given
+func project(meta Metadata, fields []string) Metadata {
+	if len(meta) == 0 {
+		return nil
+	}
+	if len(fields) == 0 {
+		return meta.Clone()
+	}
+
+	out := make(Metadata, len(fields))
+	for _, k := range fields {
+		if val, ok := meta[k]; ok {
+			val.List = slices.Clone(val.List)
+			out[k] = val
+		}
+	}
+	return out
+}
+
+// Sort orders results by the metadata fields in by, stably, so results
+// that tie keep their order. Results without a field sort after those
+// with it, whichever the direction.
+func (v View) Sort(results []vector.Result, by []query.SortField) {
+	if len(by) == 0 {
+		return
+	}
+
+	slices.SortStableFunc(results, func(a, b vector.Result) int {
+		ma, mb := v.s.meta[a.ID], v.s.meta[b.ID]
+
+		for _, key := range by {
+			va, okA := ma[key.Field]
+			vb, okB := mb[key.Field]
+
+			switch {
+			case !okA && !okB:
+				continue
+			case !okA:
+				return 1
+			case !okB:
+				return -1
+			}
+
+			c := metadata.Compare(va, vb)
+			if key.Desc {
+				c = -c
+			}
+			if c != 0 {
+				return c
+			}
+		}
+		return 0
+	})
+}
@@ -0,0 +1,121 @@
+package storage
+
+import (
+	"context"
+	"path/filepath"
+	"reflect"
+	"slices"
+	"testing"
+
+	"flashvector/metadata"
+	"flashvector/query"
+	"flashvector/vector"
+	"flashvector/wal"
+)
+
+func TestViewDocuments(t *testing.T) {
+	w, err := wal.Open(filepath.Join(t.TempDir(), "data.wal"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	store, err := NewStoreWithOptions(context.Background(), w, Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer store.Close()
+
+	meta := Metadata{"ward": metadata.StringValue("north"), "tags": metadata.ListValue("open", "urgent")}
+	if err := store.Set("a", floatsToBytesTest([]float32{1, 0}), meta, "burst pipe"); err != nil {
+		t.Fatal(err)
+	}
+	if err := store.Set("b", floatsToBytesTest([]float32{0, 1}), nil, ""); err != nil {
+		t.Fatal(err)
+	}
+
+	var docs, projected, none []Document
+	store.View(func(v View) {
+		results := v.KeywordSearch("pipe", 10, nil)
+		if len(results) != 1 || results[0].ID != "a" {
+			t.Errorf("unexpected results %v", results)
+		}
+
+		ids := []string{"a", "b", "missing"}
+		docs = v.Documents(ids, query.Include{Metadata: true, Text: true, Vector: true})
+		projected = v.Documents(ids, query.Include{Fields: []string{"ward", "absent"}})
+		none = v.Documents(ids, query.Include{})
+	})
+
+	want := []Document{
+		{Metadata: meta, Text: "burst pipe", Vector: []float32{1, 0}},
+		{Vector: []float32{0, 1}},
+		{},
+	}
+	if !reflect.DeepEqual(docs, want) {
+		t.Fatalf("got %+v, want %+v", docs, want)
+	}
+	if !reflect.DeepEqual(projected[0].Metadata, Metadata{"ward": metadata.StringValue("north")}) || projected[0].Text != "" || projected[0].Vector != nil {
+		t.Fatalf("unexpected projection %+v", projected[0])
+	}
+	if !reflect.DeepEqual(none, make([]Document, 3)) {
+		t.Fatalf("expected empty documents, got %+v", none)
+	}
+
+	// the returned metadata is a copy
+	docs[0].Metadata["ward"] = metadata.StringValue("south")
+	docs[0].Metadata["tags"].List[0] = "closed"
+	if _, got, _ := store.Get("a"); got["ward"].Str != "north" || got["tags"].List[0] != "open" {
+		t.Fatalf("stored metadata changed through a returned document")
+	}
+}
+
+func TestViewSort(t *testing.T) {
+	store, err := NewStoreWithOptions(context.Background(), nil, Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	docs := map[string]Metadata{
+		"a": {"price": metadata.FloatValue(9.5), "stock": metadata.IntValue(1)},
+		"b": {"price": metadata.IntValue(10), "stock": metadata.IntValue(2)},
+		"c": {"price": metadata.IntValue(2), "stock": metadata.IntValue(2)},
+		"d": {"stock": metadata.IntValue(2)},
+	}
+	for id, meta := range docs {
+		if err := store.Set(id, floatsToBytesTest([]float32{1, 0}), meta, ""); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	ids := func(results []vector.Result) []string {
+		out := make([]string, len(results))
+		for i, r := range results {
+			out[i] = r.ID
+		}
+		return out
+	}
+	results := func() []vector.Result {
+		return []vector.Result{{ID: "d"}, {ID: "c"}, {ID: "b"}, {ID: "a"}}
+	}
+
+	store.View(func(v View) {
+		// 10 sorts after 9.5 and 2 as a number, not before them as text
+		byPrice := results()
+		v.Sort(byPrice, []query.SortField{{Field: "price"}})
+		if got := ids(byPrice); !slices.Equal(got, []string{"c", "a", "b", "d"}) {
+			t.Errorf("price ascending: got %v", got)
+		}
+
+		// missing fields stay last when descending too
+		v.Sort(byPrice, []query.SortField{{Field: "price", Desc: true}})
+		if got := ids(byPrice); !slices.Equal(got, []string{"b", "a", "c", "d"}) {
+			t.Errorf("price descending: got %v", got)
+		}
+
+		// ties on stock fall through to price, and keep their order after it
+		byStock := results()
+		v.Sort(byStock, []query.SortField{{Field: "stock", Desc: true}, {Field: "price"}})
+		if got := ids(byStock); !slices.Equal(got, []string{"c", "b", "d", "a"}) {
+			t.Errorf("stock then price: got %v", got)
+		}
+	})
+}
@@ -147,4 +147,70 @@ func TestHybridRankAccuracy(t *testing.T) {
 	
 	// doc2 is #2 in keyword and #1 in vector -> it should be very strong
 	t.Logf("Top result: %s with score %f", fused[0].ID, fused[0].Score)
-}
\ No newline at end of file
+}
+
+func TestRescoringRecall(t *testing.T) {
+	// --- Settings ---
+	dim := 384
+	numVectors := 20000
+	numCentroids := 20
+	probes := 20 // probe every list so only quantization error is measured
+	k := 10
+	rescoreFactor := 4
+	numQueries := 50
+
+	bruteForce := NewIndex()
+	ann := NewIVFIndex(generateCentroids(dim, numCentroids), probes)
+	originals := make(map[string][]float32, numVectors)
+
+	for i := 0; i < numVectors; i++ {
+		id := fmt.Sprintf("vec-%d", i)
+		vec := randomVector(dim)
+
+		originals[id] = vec
+		bruteForce.Add(id, vec)
+		ann.Add(id, vec)
+	}
+
+	lookup := func(id string) []float32 {
+		return originals[id]
+	}
+
+	plainRecall, rescoredRecall := 0.0, 0.0
+
+	for i := 0; i < numQueries; i++ {
+		query := randomVector(dim)
+
+		truthMap := make(map[string]bool)
+		for _, r := range bruteForce.Search(query, k, nil) {
+			truthMap[r.ID] = true
+		}
+
+		plain := ann.Search(query, k, nil)
+		rescored := Rescore(query, ann.Search(query, k*rescoreFactor, nil), k, MetricCosine, lookup)
+
+		for _, r := range plain {
+			if truthMap[r.ID] {
+				plainRecall++
+			}
+		}
+		for _, r := range rescored {
+			if truthMap[r.ID] {
+				rescoredRecall++
+			}
+		}
+	}
+
+	plainRecall /= float64(numQueries * k)
+	rescoredRecall /= float64(numQueries * k)
+
+	t.Logf("Recall without rescoring: %.2f%%", plainRecall*100)
+	t.Logf("Recall with %dx rescoring: %.2f%%", rescoreFactor, rescoredRecall*100)
+
+	if rescoredRecall < plainRecall {
+		t.Errorf("rescoring lowered recall (%.2f%% -> %.2f%%)", plainRecall*100, rescoredRecall*100)
+	}
+	if rescoredRecall < 0.95 {
+		t.Errorf("Recall with rescoring is too low (%.2f%%)", rescoredRecall*100)
+	}
+}
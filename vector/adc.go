@@ -0,0 +1,60 @@
+package vector
+
+import "math"
+
+// quantizedNorm is the magnitude of the vector a set of int8 codes decodes to
+func quantizedNorm(values []int8, scale float32) float32 {
+	var sum int64
+	for _, v := range values {
+		sum += int64(v) * int64(v)
+	}
+
+	return float32(math.Sqrt(float64(sum))) * scale
+}
+
+// dotQuantized is Dot(query, Dequantize(qv)) without materialising the
+// dequantized vector: the scale is applied once to the int8 dot product.
+func dotQuantized(query []float32, qv QuantizedVector) float32 {
+	var sum float32
+	values := qv.values[:len(query)]
+
+	for i, q := range query {
+		sum += q * float32(values[i])
+	}
+
+	return sum * qv.scale
+}
+
+// ScoreQuantized scores a float32 query against int8 codes (asymmetric
+// distance) using the norm cached on the quantized vector and the query norm
+// the caller computes once per search. The result matches
+// m.Score(query, Dequantize(qv)) without allocating.
+func (m Metric) ScoreQuantized(query []float32, queryNorm float32, qv QuantizedVector) float32 {
+	if m == MetricHamming {
+		dist := 0
+		for i, q := range query {
+			if (q > 0) != (qv.values[i] > 0) {
+				dist++
+			}
+		}
+		return float32(dist)
+	}
+
+	dot := dotQuantized(query, qv)
+
+	switch m {
+	case MetricInnerProduct:
+		return dot
+	case MetricL2:
+		d := queryNorm*queryNorm - 2*dot + qv.norm*qv.norm
+		if d < 0 {
+			d = 0
+		}
+		return float32(math.Sqrt(float64(d)))
+	default:
+		if queryNorm == 0 || qv.norm == 0 {
+			return 0
+		}
+		return dot / (queryNorm * qv.norm)
+	}
+}
@@ -0,0 +1,183 @@
+package vector
+
+import (
+	"encoding/gob"
+	"fmt"
+	"io"
+	"slices"
+	"sync"
+)
+
+// BinaryIndex is a brute-force index over packed sign bits scored by
+// Hamming distance with popcount, 32x smaller than float32 vectors. It is
+// meant for first-stage retrieval over binary embeddings.
+type BinaryIndex struct {
+	mu    sync.RWMutex
+	dim   int
+	ids   []string
+	codes [][]byte
+	slots map[string]int // id -> position in ids/codes
+}
+
+func NewBinaryIndex(dim int) *BinaryIndex {
+	if dim <= 0 {
+		panic("binary index dimension must be greater than 0")
+	}
+
+	return &BinaryIndex{
+		dim:   dim,
+		slots: make(map[string]int),
+	}
+}
+
+func (b *BinaryIndex) Metric() Metric {
+	return MetricHamming
+}
+
+func (b *BinaryIndex) Dim() int {
+	return b.dim
+}
+
+func (b *BinaryIndex) Add(id string, vec []float32) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if len(vec) != b.dim {
+		panic("vector dimension mismatch")
+	}
+
+	code := EncodeVector(vec, ElementBinary)
+
+	if slot, ok := b.slots[id]; ok {
+		b.codes[slot] = code
+		return
+	}
+
+	b.slots[id] = len(b.ids)
+	b.ids = append(b.ids, id)
+	b.codes = append(b.codes, code)
+}
+
+// Remove swaps the last entry into the freed slot
+func (b *BinaryIndex) Remove(id string) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	slot, ok := b.slots[id]
+	if !ok {
+		return
+	}
+
+	last := len(b.ids) - 1
+	b.ids[slot] = b.ids[last]
+	b.codes[slot] = b.codes[last]
+	b.slots[b.ids[slot]] = slot
+
+	b.ids = b.ids[:last]
+	b.codes = b.codes[:last]
+	delete(b.slots, id)
+}
+
+func (b *BinaryIndex) Search(query []float32, k int, filter func(id string) bool) []Result {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+
+	if len(query) != b.dim {
+		panic("vec dim mismatch")
+	}
+
+	q := EncodeVector(query, ElementBinary)
+	results := make([]Result, 0)
+
+	for i, code := range b.codes {
+		if filter != nil && !filter(b.ids[i]) {
+			continue
+		}
+
+		results = append(results, Result{
+			ID:    b.ids[i],
+			Score: float32(HammingDistance(q, code)),
+		})
+	}
+
+	SortResults(results, MetricHamming)
+
+	if len(results) > k {
+		return results[:k]
+	}
+
+	return results
+}
+
+// RebuildFromData clears the index and repopulates it from float32 data
+func (b *BinaryIndex) RebuildFromData(data map[string][]byte) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.ids = nil
+	b.codes = nil
+	b.slots = make(map[string]int)
+
+	for id, raw := range data {
+		vec := bytesToVector(raw)
+		if len(vec) != b.dim {
+			continue
+		}
+
+		b.slots[id] = len(b.ids)
+		b.ids = append(b.ids, id)
+		b.codes = append(b.codes, EncodeVector(vec, ElementBinary))
+	}
+}
+
+type binaryState struct {
+	IDs   []string
+	Codes [][]byte
+}
+
+// SaveState writes the packed codes
+func (b *BinaryIndex) SaveState(w io.Writer) error {
+	return b.CaptureState().Encode(w)
+}
+
+// CaptureState copies the id and code slices, whose slots Add and Remove
+// overwrite; the codes themselves are shared
+func (b *BinaryIndex) CaptureState() IndexState {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+
+	state := binaryState{IDs: slices.Clone(b.ids), Codes: slices.Clone(b.codes)}
+	return IndexState{kind: "binary", dim: b.dim, metric: MetricHamming, state: state}
+}
+
+// LoadState replaces the codes with ones written by SaveState
+func (b *BinaryIndex) LoadState(r io.Reader) error {
+	dec := gob.NewDecoder(r)
+	if err := readIndexHeader(dec, "binary", b.dim, MetricHamming); err != nil {
+		return err
+	}
+
+	var state binaryState
+	if err := dec.Decode(&state); err != nil {
+		return err
+	}
+	if len(state.IDs) != len(state.Codes) {
+		return fmt.Errorf("%w: %d ids for %d codes", ErrIndexFormat, len(state.IDs), len(state.Codes))
+	}
+
+	slots := make(map[string]int, len(state.IDs))
+	for i, id := range state.IDs {
+		if len(state.Codes[i]) != ElementBinary.EncodedSize(b.dim) {
+			return fmt.Errorf("%w: %q has %d bytes", ErrIndexFormat, id, len(state.Codes[i]))
+		}
+		slots[id] = i
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.ids = state.IDs
+	b.codes = state.Codes
+	b.slots = slots
+	return nil
+}
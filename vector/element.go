@@ -0,0 +1,198 @@
+package vector
+
+import (
+	"encoding/binary"
+	"fmt"
+	"math"
+	"math/bits"
+	"strings"
+)
+
+// ElementType is how a collection stores each vector component on disk, in
+// the WAL and in Store.data. Indexes always receive decoded []float32.
+type ElementType int
+
+const (
+	ElementFloat32 ElementType = iota // 4 bytes per dimension, little-endian
+	ElementFloat16                    // 2 bytes per dimension, IEEE 754 half precision
+	ElementBinary                     // 1 bit per dimension, packed LSB first; dims must be a multiple of 8
+)
+
+func (t ElementType) String() string {
+	switch t {
+	case ElementFloat16:
+		return "float16"
+	case ElementBinary:
+		return "binary"
+	default:
+		return "float32"
+	}
+}
+
+// ParseElementType accepts the names used in configs and API requests
+func ParseElementType(name string) (ElementType, error) {
+	switch strings.ToLower(strings.TrimSpace(name)) {
+	case "", "float32", "f32":
+		return ElementFloat32, nil
+	case "float16", "f16", "half":
+		return ElementFloat16, nil
+	case "binary", "bit", "bits":
+		return ElementBinary, nil
+	}
+
+	return ElementFloat32, fmt.Errorf("unknown element type %q", name)
+}
+
+// EncodedSize is the number of bytes a vector of dim components takes
+func (t ElementType) EncodedSize(dim int) int {
+	switch t {
+	case ElementFloat16:
+		return dim * 2
+	case ElementBinary:
+		return (dim + 7) / 8
+	default:
+		return dim * 4
+	}
+}
+
+// EncodeVector serialises vec in the given element type. Binary keeps only
+// the sign of each component: values > 0 become 1 bits.
+func EncodeVector(vec []float32, t ElementType) []byte {
+	switch t {
+	case ElementFloat16:
+		b := make([]byte, len(vec)*2)
+		for i, f := range vec {
+			binary.LittleEndian.PutUint16(b[i*2:], Float32ToFloat16(f))
+		}
+		return b
+
+	case ElementBinary:
+		b := make([]byte, (len(vec)+7)/8)
+		for i, f := range vec {
+			if f > 0 {
+				b[i/8] |= 1 << (i % 8)
+			}
+		}
+		return b
+
+	default:
+		b := make([]byte, len(vec)*4)
+		for i, f := range vec {
+			binary.LittleEndian.PutUint32(b[i*4:], math.Float32bits(f))
+		}
+		return b
+	}
+}
+
+// DecodeVector is the inverse of EncodeVector. Binary vectors decode to
+// 0/1 components, len(b)*8 of them.
+func DecodeVector(b []byte, t ElementType) []float32 {
+	switch t {
+	case ElementFloat16:
+		vec := make([]float32, len(b)/2)
+		for i := range vec {
+			vec[i] = Float16ToFloat32(binary.LittleEndian.Uint16(b[i*2:]))
+		}
+		return vec
+
+	case ElementBinary:
+		vec := make([]float32, len(b)*8)
+		for i := range vec {
+			if b[i/8]&(1<<(i%8)) != 0 {
+				vec[i] = 1
+			}
+		}
+		return vec
+
+	default:
+		return bytesToVector(b)
+	}
+}
+
+// Float32ToFloat16 converts to IEEE 754 half precision, rounding to nearest
+// even. Values beyond the half range become ±Inf.
+func Float32ToFloat16(f float32) uint16 {
+	x := math.Float32bits(f)
+	sign := uint16(x>>16) & 0x8000
+	exp := int((x>>23)&0xff) - 127 + 15
+	mant := x & 0x7fffff
+
+	switch {
+	case (x>>23)&0xff == 0xff:
+		// Inf or NaN
+		if mant != 0 {
+			return sign | 0x7e00
+		}
+		return sign | 0x7c00
+
+	case exp >= 0x1f:
+		return sign | 0x7c00
+
+	case exp <= 0:
+		// subnormal half or zero
+		if exp < -10 {
+			return sign
+		}
+		mant |= 0x800000
+		shift := uint32(14 - exp)
+		half := mant >> shift
+		rem := mant & (1<<shift - 1)
+		mid := uint32(1) << (shift - 1)
+		if rem > mid || (rem == mid && half&1 == 1) {
+			half++
+		}
+		return sign | uint16(half)
+	}
+
+	half := uint32(exp)<<10 | mant>>13
+	rem := mant & 0x1fff
+	if rem > 0x1000 || (rem == 0x1000 && half&1 == 1) {
+		// may carry into the exponent, which correctly rounds up to Inf
+		half++
+	}
+
+	return sign | uint16(half)
+}
+
+// Float16ToFloat32 expands IEEE 754 half precision bits
+func Float16ToFloat32(h uint16) float32 {
+	sign := uint32(h&0x8000) << 16
+	exp := uint32(h>>10) & 0x1f
+	mant := uint32(h & 0x3ff)
+
+	switch {
+	case exp == 0x1f:
+		return math.Float32frombits(sign | 0x7f800000 | mant<<13)
+
+	case exp == 0:
+		if mant == 0 {
+			return math.Float32frombits(sign)
+		}
+		// normalise the subnormal
+		e := uint32(127 - 15 + 1)
+		for mant&0x400 == 0 {
+			mant <<= 1
+			e--
+		}
+		mant &= 0x3ff
+		return math.Float32frombits(sign | e<<23 | mant<<13)
+	}
+
+	return math.Float32frombits(sign | (exp+127-15)<<23 | mant<<13)
+}
+
+// HammingDistance counts differing bits between two packed binary vectors
+func HammingDistance(a, b []byte) int {
+	dist := 0
+	i := 0
+
+	for ; i+8 <= len(a) && i+8 <= len(b); i += 8 {
+		dist += bits.OnesCount64(binary.LittleEndian.Uint64(a[i:]) ^ binary.LittleEndian.Uint64(b[i:]))
+	}
+
+	for ; i < len(a) && i < len(b); i++ {
+		dist += bits.OnesCount8(a[i] ^ b[i])
+	}
+
+	return dist
+}
@@ -0,0 +1,86 @@
+package vector
+
+import (
+	"fmt"
+	"math"
+	"math/rand"
+	"testing"
+)
+
+func TestFloat16RoundTrip(t *testing.T) {
+	cases := []float32{0, 1, -1, 0.5, 65504, -2.5, 1e-5, 3.14159}
+
+	for _, f := range cases {
+		got := Float16ToFloat32(Float32ToFloat16(f))
+		if diff := math.Abs(float64(got - f)); diff > math.Abs(float64(f))*1e-3+1e-7 {
+			t.Errorf("float16 round trip of %v gave %v", f, got)
+		}
+	}
+
+	if got := Float16ToFloat32(Float32ToFloat16(1e6)); !math.IsInf(float64(got), 1) {
+		t.Errorf("expected overflow to +Inf, got %v", got)
+	}
+}
+
+func TestEncodeDecodeElementTypes(t *testing.T) {
+	vec := []float32{0.25, -1, 3, 0, -0.5, 1, 1, -1}
+
+	if got := len(EncodeVector(vec, ElementFloat16)); got != ElementFloat16.EncodedSize(len(vec)) {
+		t.Errorf("float16 encoded to %d bytes", got)
+	}
+
+	bin := EncodeVector(vec, ElementBinary)
+	if len(bin) != 1 {
+		t.Fatalf("8 dims should pack into 1 byte, got %d", len(bin))
+	}
+
+	want := []float32{1, 0, 1, 0, 0, 1, 1, 0}
+	for i, v := range DecodeVector(bin, ElementBinary) {
+		if v != want[i] {
+			t.Fatalf("binary decode mismatch at %d: %v", i, DecodeVector(bin, ElementBinary))
+		}
+	}
+
+	for _, name := range []string{"float32", "float16", "binary"} {
+		et, err := ParseElementType(name)
+		if err != nil || et.String() != name {
+			t.Errorf("ParseElementType(%q) = %v, %v", name, et, err)
+		}
+	}
+}
+
+func TestBinaryIndexHamming(t *testing.T) {
+	rng := rand.New(rand.NewSource(31))
+	dim := 128
+
+	idx := NewBinaryIndex(dim)
+	flat := NewIndexWithMetric(MetricHamming)
+
+	vecs := make([][]float32, 500)
+	for i := range vecs {
+		vecs[i] = make([]float32, dim)
+		for j := range vecs[i] {
+			vecs[i][j] = rng.Float32()*2 - 1
+		}
+		id := fmt.Sprintf("vec-%d", i)
+		idx.Add(id, vecs[i])
+		flat.Add(id, vecs[i])
+	}
+
+	got := idx.Search(vecs[42], 5, nil)
+	want := flat.Search(vecs[42], 5, nil)
+
+	if got[0].ID != "vec-42" || got[0].Score != 0 {
+		t.Fatalf("expected exact match first, got %v", got[0])
+	}
+	for i := range got {
+		if got[i].Score != want[i].Score {
+			t.Errorf("popcount distance %v differs from float hamming %v", got[i].Score, want[i].Score)
+		}
+	}
+
+	idx.Remove("vec-42")
+	if r := idx.Search(vecs[42], 1, nil); r[0].ID == "vec-42" {
+		t.Fatalf("removed vector still returned")
+	}
+}
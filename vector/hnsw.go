@@ -0,0 +1,684 @@
+package vector
+
+import (
+	"container/heap"
+	"encoding/gob"
+	"fmt"
+	"io"
+	"math"
+	"math/rand"
+	"slices"
+	"sort"
+	"sync"
+	"time"
+)
+
+// Default HNSW parameters. M=16 / efConstruction=200 is the usual starting
+// point from the paper and works well for 384-dim sentence embeddings.
+const (
+	DefaultHNSWM              = 16
+	DefaultHNSWEfConstruction = 200
+	DefaultHNSWEfSearch       = 64
+)
+
+// HNSWIndex is a hierarchical navigable small-world graph index.
+// Deletes only tombstone a node so the graph stays navigable; once
+// tombstones outnumber the live nodes a graph of the live nodes is built in
+// the background and swapped in.
+type HNSWIndex struct {
+	mu             sync.RWMutex
+	m              int // max neighbours per node on upper layers
+	mMax0          int // max neighbours per node on layer 0
+	efConstruction int
+	efSearch       int
+	levelMult      float64
+	dim            int
+	metric         Metric
+
+	nodes    []*hnswNode
+	ids      map[string]int32 // live id -> node slot
+	entry    int32
+	maxLevel int
+	deleted  int
+	rng      *rand.Rand
+
+	// the running background compaction, if any
+	compaction *hnswCompaction
+}
+
+// hnswCompaction collects the writes that land while a compacted graph is
+// built, so they can be replayed onto it before it is swapped in
+type hnswCompaction struct {
+	pending []hnswPendingOp
+	done    chan struct{}
+}
+
+type hnswPendingOp struct {
+	id     string
+	vec    []float32
+	remove bool
+}
+
+type hnswNode struct {
+	id        string
+	vec       []float32 // unit length under MetricCosine, so Dot == CosineSimilarity
+	neighbors [][]int32 // one adjacency list per layer
+	deleted   bool
+}
+
+// NewHNSWIndex creates an empty cosine graph for vectors of the given
+// dimension. Non-positive parameters fall back to the defaults.
+func NewHNSWIndex(dim int, m int, efConstruction int, efSearch int) *HNSWIndex {
+	return NewHNSWIndexWithMetric(dim, MetricCosine, m, efConstruction, efSearch)
+}
+
+// NewHNSWIndexWithMetric creates an empty graph that links and scores with the given metric
+func NewHNSWIndexWithMetric(dim int, metric Metric, m int, efConstruction int, efSearch int) *HNSWIndex {
+	if dim <= 0 {
+		panic("hnsw dimension must be greater than 0")
+	}
+
+	if m <= 1 {
+		m = DefaultHNSWM
+	}
+
+	if efConstruction <= 0 {
+		efConstruction = DefaultHNSWEfConstruction
+	}
+
+	if efConstruction < m {
+		efConstruction = m
+	}
+
+	if efSearch <= 0 {
+		efSearch = DefaultHNSWEfSearch
+	}
+
+	return &HNSWIndex{
+		m:              m,
+		mMax0:          m * 2,
+		efConstruction: efConstruction,
+		efSearch:       efSearch,
+		levelMult:      1 / math.Log(float64(m)),
+		dim:            dim,
+		metric:         metric,
+		ids:            make(map[string]int32),
+		entry:          -1,
+		rng:            rand.New(rand.NewSource(time.Now().UnixNano())),
+	}
+}
+
+// Metric returns the metric the graph was created with
+func (h *HNSWIndex) Metric() Metric {
+	return h.metric
+}
+
+// Dim returns the vector dimension the graph accepts
+func (h *HNSWIndex) Dim() int {
+	return h.dim
+}
+
+// SetEfSearch changes the size of the dynamic candidate list used by Search.
+// Higher values trade latency for recall.
+func (h *HNSWIndex) SetEfSearch(ef int) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if ef > 0 {
+		h.efSearch = ef
+	}
+}
+
+// Len returns the number of live (non-tombstoned) vectors in the graph.
+func (h *HNSWIndex) Len() int {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+
+	return len(h.ids)
+}
+
+func (h *HNSWIndex) Add(id string, vec []float32) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if len(vec) != h.dim {
+		panic("vector dimension mismatch")
+	}
+
+	// re-adding an id replaces the old node
+	h.removeLocked(id)
+	h.insertLocked(id, vec)
+
+	if h.compaction != nil {
+		h.compaction.pending = append(h.compaction.pending, hnswPendingOp{id: id, vec: h.nodes[h.ids[id]].vec})
+	}
+}
+
+func (h *HNSWIndex) Remove(id string) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	h.removeLocked(id)
+
+	if h.compaction != nil {
+		h.compaction.pending = append(h.compaction.pending, hnswPendingOp{id: id, remove: true})
+		return
+	}
+
+	if h.deleted > len(h.ids) && h.deleted >= h.mMax0 {
+		h.startCompactionLocked()
+	}
+}
+
+func (h *HNSWIndex) Search(query []float32, k int, filter func(id string) bool) []Result {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+
+	if len(query) != h.dim {
+		panic("vec dim mismatch")
+	}
+
+	if k <= 0 || h.entry < 0 {
+		return []Result{}
+	}
+
+	if h.metric == MetricCosine {
+		query = normalize(query)
+	}
+
+	// greedy descent through the upper layers
+	ep := h.entry
+	epScore := h.sim(query, h.nodes[ep].vec)
+
+	for level := h.maxLevel; level > 0; level-- {
+		ep, epScore = h.greedyClosest(query, ep, epScore, level)
+	}
+
+	ef := h.efSearch
+	if ef < k {
+		ef = k
+	}
+
+	// tombstoned and filtered-out nodes are still walked through so that a
+	// selective filter keeps exploring instead of returning short
+	allowed := func(n int32) bool {
+		node := h.nodes[n]
+		if node.deleted {
+			return false
+		}
+		return filter == nil || filter(node.id)
+	}
+
+	found := h.searchLayer(query, ep, epScore, ef, 0, allowed)
+
+	results := make([]Result, 0, len(found))
+	for _, c := range found {
+		results = append(results, Result{
+			ID:    h.nodes[c.node].id,
+			Score: h.metric.fromSimilarity(c.score),
+		})
+	}
+
+	SortResults(results, h.metric)
+
+	if len(results) > k {
+		return results[:k]
+	}
+
+	return results
+}
+
+// RebuildFromData clears the graph and repopulates it from the snapshot data
+func (h *HNSWIndex) RebuildFromData(data map[string][]byte) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	h.resetLocked()
+	h.compaction = nil
+
+	for id, b := range data {
+		vec := bytesToVector(b)
+		if len(vec) != h.dim {
+			continue
+		}
+		h.insertLocked(id, vec)
+	}
+}
+
+type hnswState struct {
+	M              int
+	EfConstruction int
+	Entry          int32
+	MaxLevel       int
+	Nodes          []hnswPersistedNode
+}
+
+type hnswPersistedNode struct {
+	ID        string
+	Vec       []float32
+	Neighbors [][]int32
+	Deleted   bool
+}
+
+// SaveState writes the graph, tombstones included, so loading skips
+// re-inserting every vector
+func (h *HNSWIndex) SaveState(w io.Writer) error {
+	return h.CaptureState().Encode(w)
+}
+
+// CaptureState copies every adjacency list, since inserts relink existing
+// nodes in place; vectors are shared
+func (h *HNSWIndex) CaptureState() IndexState {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+
+	state := hnswState{
+		M:              h.m,
+		EfConstruction: h.efConstruction,
+		Entry:          h.entry,
+		MaxLevel:       h.maxLevel,
+		Nodes:          make([]hnswPersistedNode, len(h.nodes)),
+	}
+
+	for i, n := range h.nodes {
+		neighbors := make([][]int32, len(n.neighbors))
+		for l, links := range n.neighbors {
+			neighbors[l] = slices.Clone(links)
+		}
+		state.Nodes[i] = hnswPersistedNode{ID: n.id, Vec: n.vec, Neighbors: neighbors, Deleted: n.deleted}
+	}
+
+	return IndexState{kind: "hnsw", dim: h.dim, metric: h.metric, state: state}
+}
+
+// LoadState replaces the graph with one written by SaveState. Graphs built
+// with other M or efConstruction settings are rejected so they get rebuilt.
+func (h *HNSWIndex) LoadState(r io.Reader) error {
+	dec := gob.NewDecoder(r)
+	if err := readIndexHeader(dec, "hnsw", h.dim, h.metric); err != nil {
+		return err
+	}
+
+	var state hnswState
+	if err := dec.Decode(&state); err != nil {
+		return err
+	}
+
+	if state.M != h.m || state.EfConstruction != h.efConstruction {
+		return fmt.Errorf("%w: graph built with m=%d efConstruction=%d", ErrIndexFormat, state.M, state.EfConstruction)
+	}
+	if state.Entry >= int32(len(state.Nodes)) || (state.Entry < 0 && len(state.Nodes) > 0) {
+		return fmt.Errorf("%w: entry point %d out of range", ErrIndexFormat, state.Entry)
+	}
+
+	nodes := make([]*hnswNode, len(state.Nodes))
+	ids := make(map[string]int32, len(state.Nodes))
+	deleted := 0
+
+	// a node on level l has one adjacency list for each layer 0..l, and
+	// only links to nodes that also reach the layer of the link
+	if len(state.Nodes) > 0 && len(state.Nodes[state.Entry].Neighbors) != state.MaxLevel+1 {
+		return fmt.Errorf("%w: entry point is not on level %d", ErrIndexFormat, state.MaxLevel)
+	}
+
+	for i, p := range state.Nodes {
+		if len(p.Vec) != h.dim {
+			return fmt.Errorf("%w: %q has dimension %d", ErrIndexFormat, p.ID, len(p.Vec))
+		}
+		if len(p.Neighbors) == 0 || len(p.Neighbors) > state.MaxLevel+1 {
+			return fmt.Errorf("%w: %q has %d layers, max level is %d", ErrIndexFormat, p.ID, len(p.Neighbors), state.MaxLevel)
+		}
+		for layer, links := range p.Neighbors {
+			for _, nb := range links {
+				if nb < 0 || int(nb) >= len(state.Nodes) {
+					return fmt.Errorf("%w: %q links to missing node %d", ErrIndexFormat, p.ID, nb)
+				}
+				if len(state.Nodes[nb].Neighbors) <= layer {
+					return fmt.Errorf("%w: %q links to node %d above its level", ErrIndexFormat, p.ID, nb)
+				}
+			}
+		}
+
+		nodes[i] = &hnswNode{id: p.ID, vec: p.Vec, neighbors: p.Neighbors, deleted: p.Deleted}
+		if p.Deleted {
+			deleted++
+		} else {
+			ids[p.ID] = int32(i)
+		}
+	}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	h.nodes = nodes
+	h.ids = ids
+	h.entry = state.Entry
+	h.maxLevel = state.MaxLevel
+	h.deleted = deleted
+	h.compaction = nil
+	return nil
+}
+
+// --- internal graph operations (caller holds h.mu) ---
+
+func (h *HNSWIndex) resetLocked() {
+	h.nodes = nil
+	h.ids = make(map[string]int32)
+	h.entry = -1
+	h.maxLevel = 0
+	h.deleted = 0
+}
+
+func (h *HNSWIndex) randomLevel() int {
+	return int(math.Floor(-math.Log(1-h.rng.Float64()) * h.levelMult))
+}
+
+func (h *HNSWIndex) insertLocked(id string, vec []float32) {
+	if h.metric == MetricCosine {
+		vec = normalize(vec)
+	}
+	level := h.randomLevel()
+
+	n := int32(len(h.nodes))
+	h.nodes = append(h.nodes, &hnswNode{
+		id:        id,
+		vec:       vec,
+		neighbors: make([][]int32, level+1),
+	})
+	h.ids[id] = n
+
+	if h.entry < 0 {
+		h.entry = n
+		h.maxLevel = level
+		return
+	}
+
+	ep := h.entry
+	epScore := h.sim(vec, h.nodes[ep].vec)
+
+	for l := h.maxLevel; l > level; l-- {
+		ep, epScore = h.greedyClosest(vec, ep, epScore, l)
+	}
+
+	top := level
+	if top > h.maxLevel {
+		top = h.maxLevel
+	}
+
+	for l := top; l >= 0; l-- {
+		candidates := h.searchLayer(vec, ep, epScore, h.efConstruction, l, nil)
+
+		maxConn := h.m
+		if l == 0 {
+			maxConn = h.mMax0
+		}
+
+		selected := h.selectNeighbors(candidates, h.m)
+		h.nodes[n].neighbors[l] = selected
+
+		for _, nb := range selected {
+			h.link(nb, n, l, maxConn)
+		}
+
+		// closest candidate becomes the entry point for the next layer
+		best := candidates[0]
+		for _, c := range candidates[1:] {
+			if c.score > best.score {
+				best = c
+			}
+		}
+		ep, epScore = best.node, best.score
+	}
+
+	if level > h.maxLevel {
+		h.maxLevel = level
+		h.entry = n
+	}
+}
+
+// link adds a back edge from -> to on the given layer, shrinking the
+// adjacency list with the selection heuristic if it overflows.
+func (h *HNSWIndex) link(from int32, to int32, level int, maxConn int) {
+	node := h.nodes[from]
+	node.neighbors[level] = append(node.neighbors[level], to)
+
+	if len(node.neighbors[level]) <= maxConn {
+		return
+	}
+
+	candidates := make([]hnswCandidate, 0, len(node.neighbors[level]))
+	for _, nb := range node.neighbors[level] {
+		candidates = append(candidates, hnswCandidate{
+			node:  nb,
+			score: h.sim(node.vec, h.nodes[nb].vec),
+		})
+	}
+
+	node.neighbors[level] = h.selectNeighbors(candidates, maxConn)
+}
+
+// selectNeighbors implements the diversity heuristic from the HNSW paper:
+// a candidate is kept only if it is closer to the base than to any neighbour
+// already selected. Pruned candidates fill any remaining slots.
+func (h *HNSWIndex) selectNeighbors(candidates []hnswCandidate, m int) []int32 {
+	sort.Slice(candidates, func(i, j int) bool {
+		return candidates[i].score > candidates[j].score
+	})
+
+	selected := make([]int32, 0, m)
+	pruned := make([]int32, 0)
+
+	for _, c := range candidates {
+		if len(selected) >= m {
+			break
+		}
+
+		keep := true
+		for _, s := range selected {
+			if h.sim(h.nodes[c.node].vec, h.nodes[s].vec) > c.score {
+				keep = false
+				break
+			}
+		}
+
+		if keep {
+			selected = append(selected, c.node)
+		} else {
+			pruned = append(pruned, c.node)
+		}
+	}
+
+	for _, p := range pruned {
+		if len(selected) >= m {
+			break
+		}
+		selected = append(selected, p)
+	}
+
+	return selected
+}
+
+func (h *HNSWIndex) greedyClosest(query []float32, ep int32, epScore float32, level int) (int32, float32) {
+	for changed := true; changed; {
+		changed = false
+
+		for _, nb := range h.nodes[ep].neighbors[level] {
+			score := h.sim(query, h.nodes[nb].vec)
+			if score > epScore {
+				ep, epScore = nb, score
+				changed = true
+			}
+		}
+	}
+
+	return ep, epScore
+}
+
+// searchLayer runs the best-first beam search on one layer and returns up to
+// ef nodes accepted by allowed (nil accepts every node).
+func (h *HNSWIndex) searchLayer(query []float32, ep int32, epScore float32, ef int, level int, allowed func(n int32) bool) []hnswCandidate {
+	visited := map[int32]struct{}{ep: {}}
+
+	candidates := &hnswMaxHeap{{node: ep, score: epScore}}
+	results := &hnswMinHeap{}
+
+	if allowed == nil || allowed(ep) {
+		heap.Push(results, hnswCandidate{node: ep, score: epScore})
+	}
+
+	for candidates.Len() > 0 {
+		c := heap.Pop(candidates).(hnswCandidate)
+
+		if results.Len() >= ef && c.score < (*results)[0].score {
+			break
+		}
+
+		for _, nb := range h.nodes[c.node].neighbors[level] {
+			if _, seen := visited[nb]; seen {
+				continue
+			}
+			visited[nb] = struct{}{}
+
+			score := h.sim(query, h.nodes[nb].vec)
+
+			if results.Len() < ef || score > (*results)[0].score {
+				heap.Push(candidates, hnswCandidate{node: nb, score: score})
+
+				if allowed == nil || allowed(nb) {
+					heap.Push(results, hnswCandidate{node: nb, score: score})
+					if results.Len() > ef {
+						heap.Pop(results)
+					}
+				}
+			}
+		}
+	}
+
+	return []hnswCandidate(*results)
+}
+
+func (h *HNSWIndex) removeLocked(id string) {
+	n, ok := h.ids[id]
+	if !ok {
+		return
+	}
+
+	h.nodes[n].deleted = true
+	delete(h.ids, id)
+	h.deleted++
+}
+
+// startCompactionLocked copies out the live nodes and builds a graph of
+// them in the background. Searches and writes keep using the current graph
+// meanwhile; writes are also recorded and replayed onto the new graph when
+// it is swapped in.
+func (h *HNSWIndex) startCompactionLocked() {
+	live := make([]*hnswNode, 0, len(h.ids))
+	for _, node := range h.nodes {
+		if !node.deleted {
+			live = append(live, node)
+		}
+	}
+
+	c := &hnswCompaction{done: make(chan struct{})}
+	h.compaction = c
+
+	// vectors are never modified once inserted, so sharing them is safe
+	fresh := NewHNSWIndexWithMetric(h.dim, h.metric, h.m, h.efConstruction, h.efSearch)
+
+	go func() {
+		defer close(c.done)
+
+		for _, node := range live {
+			fresh.insertLocked(node.id, node.vec)
+		}
+
+		h.mu.Lock()
+		defer h.mu.Unlock()
+
+		// a rebuild or load replaced the graph the copy was taken from
+		if h.compaction != c {
+			return
+		}
+
+		for _, op := range c.pending {
+			fresh.removeLocked(op.id)
+			if !op.remove {
+				fresh.insertLocked(op.id, op.vec)
+			}
+		}
+
+		h.nodes = fresh.nodes
+		h.ids = fresh.ids
+		h.entry = fresh.entry
+		h.maxLevel = fresh.maxLevel
+		h.deleted = fresh.deleted
+		h.compaction = nil
+
+		// removals replayed above can leave enough tombstones for another round
+		if h.deleted > len(h.ids) && h.deleted >= h.mMax0 {
+			h.startCompactionLocked()
+		}
+	}()
+}
+
+// sim is the "higher is closer" score the graph is built and searched with
+func (h *HNSWIndex) sim(a, b []float32) float32 {
+	if h.metric == MetricCosine {
+		// vectors are pre-normalized
+		return Dot(a, b)
+	}
+	return h.metric.similarity(a, b)
+}
+
+// normalize returns a unit-length copy of vec; zero vectors stay zero so
+// they score 0 like CosineSimilarity does
+func normalize(vec []float32) []float32 {
+	out := make([]float32, len(vec))
+
+	mag := Magnitude(vec)
+	if mag == 0 {
+		return out
+	}
+
+	for i, v := range vec {
+		out[i] = v / mag
+	}
+
+	return out
+}
+
+// --- heaps ---
+
+type hnswCandidate struct {
+	node  int32
+	score float32
+}
+
+// hnswMaxHeap pops the most similar candidate first
+type hnswMaxHeap []hnswCandidate
+
+func (q hnswMaxHeap) Len() int            { return len(q) }
+func (q hnswMaxHeap) Less(i, j int) bool  { return q[i].score > q[j].score }
+func (q hnswMaxHeap) Swap(i, j int)       { q[i], q[j] = q[j], q[i] }
+func (q *hnswMaxHeap) Push(x interface{}) { *q = append(*q, x.(hnswCandidate)) }
+func (q *hnswMaxHeap) Pop() interface{} {
+	old := *q
+	item := old[len(old)-1]
+	*q = old[:len(old)-1]
+	return item
+}
+
+// hnswMinHeap keeps the least similar result on top so it can be evicted
+type hnswMinHeap []hnswCandidate
+
+func (q hnswMinHeap) Len() int            { return len(q) }
+func (q hnswMinHeap) Less(i, j int) bool  { return q[i].score < q[j].score }
+func (q hnswMinHeap) Swap(i, j int)       { q[i], q[j] = q[j], q[i] }
+func (q *hnswMinHeap) Push(x interface{}) { *q = append(*q, x.(hnswCandidate)) }
+func (q *hnswMinHeap) Pop() interface{} {
+	old := *q
+	item := old[len(old)-1]
+	*q = old[:len(old)-1]
+	return item
+}
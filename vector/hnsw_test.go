@@ -0,0 +1,198 @@
+package vector
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+func TestHNSWRecall(t *testing.T) {
+	dim := 64
+	numVectors := 10000
+	k := 10
+	numQueries := 50
+
+	bruteForce := NewIndex()
+	hnsw := NewHNSWIndex(dim, 16, 100, 100)
+
+	for i := 0; i < numVectors; i++ {
+		id := fmt.Sprintf("vec-%d", i)
+		vec := randomVector(dim)
+
+		bruteForce.Add(id, vec)
+		hnsw.Add(id, vec)
+	}
+
+	totalRecall := 0.0
+
+	for i := 0; i < numQueries; i++ {
+		query := randomVector(dim)
+
+		truth := make(map[string]bool)
+		for _, r := range bruteForce.Search(query, k, nil) {
+			truth[r.ID] = true
+		}
+
+		matches := 0
+		for _, r := range hnsw.Search(query, k, nil) {
+			if truth[r.ID] {
+				matches++
+			}
+		}
+
+		totalRecall += float64(matches) / float64(k)
+	}
+
+	avgRecall := totalRecall / float64(numQueries)
+	t.Logf("HNSW Average Recall: %.2f%%", avgRecall*100)
+
+	if avgRecall < 0.9 {
+		t.Errorf("HNSW recall is too low (%.2f%%)", avgRecall*100)
+	}
+}
+
+func TestHNSWRemove(t *testing.T) {
+	dim := 16
+	hnsw := NewHNSWIndex(dim, 8, 50, 50)
+
+	vecs := make(map[string][]float32)
+	for i := 0; i < 200; i++ {
+		id := strconv.Itoa(i)
+		vecs[id] = randomVector(dim)
+		hnsw.Add(id, vecs[id])
+	}
+
+	hnsw.Remove("7")
+
+	for _, r := range hnsw.Search(vecs["7"], 10, nil) {
+		if r.ID == "7" {
+			t.Fatalf("removed vector returned by search")
+		}
+	}
+
+	// removing most of the graph triggers compaction; survivors must still be found
+	for i := 0; i < 180; i++ {
+		hnsw.Remove(strconv.Itoa(i))
+	}
+
+	waitCompaction(hnsw)
+
+	if hnsw.Len() != 20 || len(hnsw.nodes) != 20 {
+		t.Fatalf("expected 20 live vectors and no tombstones, got %d of %d", hnsw.Len(), len(hnsw.nodes))
+	}
+
+	results := hnsw.Search(vecs["190"], 1, nil)
+	if len(results) != 1 || results[0].ID != "190" {
+		t.Fatalf("expected to find vector 190 after compaction, got %v", results)
+	}
+}
+
+func TestHNSWCompactsInBackground(t *testing.T) {
+	dim := 32
+	hnsw := NewHNSWIndex(dim, 16, 100, 100)
+
+	vecs := make(map[string][]float32)
+	for i := 0; i < 2000; i++ {
+		id := strconv.Itoa(i)
+		vecs[id] = randomVector(dim)
+		hnsw.Add(id, vecs[id])
+	}
+
+	// the removal that tips tombstones over the live nodes only starts the
+	// compaction; the graph is rebuilt after Remove has returned
+	for i := 0; i < 1001; i++ {
+		hnsw.Remove(strconv.Itoa(i))
+	}
+	hnsw.mu.RLock()
+	running := hnsw.compaction != nil
+	hnsw.mu.RUnlock()
+	if !running {
+		t.Fatalf("expected a background compaction to be running")
+	}
+
+	// writes during the compaction land in the old graph and in the new one
+	hnsw.Remove("1500")
+	vecs["1600"] = randomVector(dim)
+	hnsw.Add("1600", vecs["1600"])
+	vecs["new"] = randomVector(dim)
+	hnsw.Add("new", vecs["new"])
+
+	if r := hnsw.Search(vecs["new"], 1, nil); len(r) != 1 || r[0].ID != "new" {
+		t.Fatalf("expected a write during compaction to be searchable, got %v", r)
+	}
+
+	waitCompaction(hnsw)
+
+	if hnsw.Len() != 999 {
+		t.Fatalf("expected 999 live vectors, got %d", hnsw.Len())
+	}
+	if hnsw.deleted > 2 {
+		t.Fatalf("expected only the replayed writes to leave tombstones, got %d", hnsw.deleted)
+	}
+
+	for _, id := range []string{"1600", "new", "1999"} {
+		if r := hnsw.Search(vecs[id], 1, nil); len(r) != 1 || r[0].ID != id {
+			t.Fatalf("expected to find %s after compaction, got %v", id, r)
+		}
+	}
+	for _, r := range hnsw.Search(vecs["1500"], 10, nil) {
+		if r.ID == "1500" {
+			t.Fatalf("vector removed during compaction returned by search")
+		}
+	}
+}
+
+// waitCompaction blocks until no background compaction is running
+func waitCompaction(h *HNSWIndex) {
+	for {
+		h.mu.RLock()
+		c := h.compaction
+		h.mu.RUnlock()
+
+		if c == nil {
+			return
+		}
+		<-c.done
+	}
+}
+
+func TestHNSWFilteredSearchReturnsK(t *testing.T) {
+	dim := 32
+	hnsw := NewHNSWIndex(dim, 16, 100, 20)
+
+	for i := 0; i < 2000; i++ {
+		hnsw.Add(fmt.Sprintf("doc-%d", i), randomVector(dim))
+	}
+
+	// only 1% of the ids pass the filter, far fewer than efSearch would see
+	filter := func(id string) bool {
+		return strings.HasSuffix(id, "00")
+	}
+
+	results := hnsw.Search(randomVector(dim), 10, filter)
+	if len(results) != 10 {
+		t.Fatalf("expected 10 filtered results, got %d", len(results))
+	}
+
+	for _, r := range results {
+		if !filter(r.ID) {
+			t.Errorf("result %s does not pass the filter", r.ID)
+		}
+	}
+}
+
+func BenchmarkSearchHNSW(b *testing.B) {
+	dim := 64
+	idx := NewHNSWIndex(dim, 16, 200, 64)
+
+	for i := 0; i < 10000; i++ {
+		idx.Add(fmt.Sprintf("%d", i), randomVector(dim))
+	}
+	query := randomVector(dim)
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		idx.Search(query, 10, nil)
+	}
+}
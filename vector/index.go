@@ -1,6 +1,12 @@
 package vector
 
-import "sort"
+import (
+	"encoding/binary"
+	"encoding/gob"
+	"fmt"
+	"io"
+	"math"
+)
 
 // interface for vector index
 type VectorIndex interface{
@@ -8,6 +14,19 @@ type VectorIndex interface{
 	Remove(id string)
 	Search(query []float32,k int,filter func(id string) bool) []Result
 	RebuildFromData(data map[string][]byte)
+	Metric() Metric
+	// Dim is the vector dimension the index accepts; 0 accepts any
+	Dim() int
+}
+
+// DimensionError reports a vector whose length does not match the index
+type DimensionError struct{
+	Expected int
+	Got int
+}
+
+func (e *DimensionError) Error() string{
+	return fmt.Sprintf("vector dimension mismatch: expected %d, got %d",e.Expected,e.Got)
 }
 
 type Vector struct{
@@ -17,6 +36,8 @@ type Vector struct{
 
 type Index struct{
 	vectors []Vector
+	positions map[string]int // id -> slot in vectors
+	metric Metric
 }
 
 type Result struct{
@@ -25,13 +46,36 @@ type Result struct{
 }
 
 func NewIndex() *Index{
+	return NewIndexWithMetric(MetricCosine)
+}
+
+// NewIndexWithMetric creates a brute-force index that scores with the given metric
+func NewIndexWithMetric(metric Metric) *Index{
 	return &Index{
 		vectors : make([]Vector,0),
+		positions : make(map[string]int),
+		metric : metric,
 	}
 }
 
-// add vectors to index
+// Metric returns the metric the index was created with
+func (idx *Index) Metric() Metric{
+	return idx.metric
+}
+
+// Dim returns 0: the brute-force index scores vectors of any length
+func (idx *Index) Dim() int{
+	return 0
+}
+
+// add vectors to index; adding an id again replaces its vector
 func (idx *Index) Add(ID string,value []float32){
+	if i,ok := idx.positions[ID]; ok{
+		idx.vectors[i].values = value
+		return
+	}
+
+	idx.positions[ID] = len(idx.vectors)
 	idx.vectors = append(idx.vectors,Vector{
 		ID:ID,
 		values:value,
@@ -49,7 +93,7 @@ func (idx *Index) Search(query []float32,k int,filter func(id string) bool)[]Res
 			}
 		}
 
-		Score := CosineSimilarity(query,v.values)
+		Score := idx.metric.Score(query,v.values)
 
 		results = append(results,Result{
 			ID : v.ID,
@@ -57,10 +101,8 @@ func (idx *Index) Search(query []float32,k int,filter func(id string) bool)[]Res
 		})
 	}
 
-	// sort results by Score descending
-	sort.Slice(results,func(i ,j int)bool{
-		return results[i].Score>results[j].Score
-	})
+	// sort results best first for the metric
+	SortResults(results,idx.metric)
 
 	if len(results)>k{
 		return results[:k]
@@ -69,24 +111,31 @@ func (idx *Index) Search(query []float32,k int,filter func(id string) bool)[]Res
 	return results
 }
 
+// Remove moves the last vector into the removed one's slot, so it costs
+// the same however many vectors are indexed
 func (idx *Index) Remove(ID string){
-	newvector := make([]Vector,0)
-
-	for _,v := range idx.vectors{
-		if v.ID != ID{
-			newvector = append(newvector, v)
-		}
+	i,ok := idx.positions[ID]
+	if !ok{
+		return
 	}
 
-	idx.vectors = newvector
+	last := len(idx.vectors)-1
+	if i != last{
+		idx.vectors[i] = idx.vectors[last]
+		idx.positions[idx.vectors[i].ID] = i
+	}
 
+	idx.vectors[last] = Vector{}
+	idx.vectors = idx.vectors[:last]
+	delete(idx.positions,ID)
 }
 
+// bytesToVector decodes the little-endian float32 encoding the store writes
 func bytesToVector(b []byte) []float32{
-	vec := make([]float32,len(b))
+	vec := make([]float32,len(b)/4)
 
-	for i := range b{
-		vec[i] = float32(b[i])
+	for i := range vec{
+		vec[i] = math.Float32frombits(binary.LittleEndian.Uint32(b[i*4:(i+1)*4]))
 	}
 
 	return vec
@@ -94,9 +143,65 @@ func bytesToVector(b []byte) []float32{
 
 func (idx *Index) RebuildFromData(data map[string][]byte){
 	idx.vectors = nil
+	idx.positions = make(map[string]int,len(data))
 
 	for k , v := range data{
 		vec := bytesToVector(v)
 		idx.Add(k,vec)
 	}
-}
\ No newline at end of file
+}
+type flatState struct{
+	IDs []string
+	Vectors [][]float32
+}
+
+// SaveState writes the indexed vectors
+func (idx *Index) SaveState(w io.Writer) error{
+	return idx.CaptureState().Encode(w)
+}
+
+// CaptureState copies the ids and vector slices; the vectors are shared
+// since Add replaces them. The caller serializes it with writes, as it does
+// every other call.
+func (idx *Index) CaptureState() IndexState{
+	state := flatState{
+		IDs: make([]string,len(idx.vectors)),
+		Vectors: make([][]float32,len(idx.vectors)),
+	}
+	for i,v := range idx.vectors{
+		state.IDs[i] = v.ID
+		state.Vectors[i] = v.values
+	}
+
+	return IndexState{kind: "flat",metric: idx.metric,state: state}
+}
+
+// LoadState replaces the indexed vectors with ones written by SaveState
+func (idx *Index) LoadState(r io.Reader) error{
+	dec := gob.NewDecoder(r)
+	if err := readIndexHeader(dec,"flat",0,idx.metric);err != nil{
+		return err
+	}
+
+	var state flatState
+	if err := dec.Decode(&state);err != nil{
+		return err
+	}
+	if len(state.IDs) != len(state.Vectors){
+		return fmt.Errorf("%w: %d ids for %d vectors",ErrIndexFormat,len(state.IDs),len(state.Vectors))
+	}
+
+	vectors := make([]Vector,len(state.IDs))
+	positions := make(map[string]int,len(state.IDs))
+	for i,id := range state.IDs{
+		if _,dup := positions[id]; dup{
+			return fmt.Errorf("%w: id %q stored twice",ErrIndexFormat,id)
+		}
+		vectors[i] = Vector{ID: id,values: state.Vectors[i]}
+		positions[id] = i
+	}
+
+	idx.vectors = vectors
+	idx.positions = positions
+	return nil
+}
@@ -1,16 +1,43 @@
 package vector
 
 import (
+	"encoding/gob"
+	"errors"
+	"fmt"
+	"io"
 	"sort"
 	"sync"
 )
 
+var ErrRetrainInProgress = errors.New("ivf retrain already in progress")
+
 type IVFIndex struct{
 	centroids [][]float32
 	lists map[int][]QuantizedVector
+	// slots finds an id's entry in lists, so Remove does not scan. Removed
+	// entries are tombstoned in place (nil values) and counted in dead;
+	// a list is compacted once half of it is tombstones.
+	slots map[string]ivfSlot
+	dead map[int]int
 	probes int
 	dim int
+	metric Metric
 	mu  sync.RWMutex // Added Mutex for thread safety
+
+	// writes that land while Retrain reassigns lists, replayed on swap
+	retraining bool
+	pending []ivfPendingOp
+}
+
+type ivfSlot struct{
+	list int
+	pos int
+}
+
+type ivfPendingOp struct{
+	id string
+	qv QuantizedVector
+	remove bool
 }
 
 func (ivf *IVFIndex) Add(id string,vec []float32){
@@ -21,20 +48,17 @@ func (ivf *IVFIndex) Add(id string,vec []float32){
 		panic("vector dimension mismatch")
 	}
 
-	bestCentroid := -1
-	bestScore := float32(-2.0)
+	bestCentroid,_ := nearestCentroid(vec,ivf.centroids,ivf.metric)
+        qv := Quantize(vec)
+	    qv.id = id
 
-	for i,centroid := range ivf.centroids{
-		score := CosineSimilarity(vec,centroid)
+	// adding an id again replaces its vector
+	ivf.removeLocked(id)
+	ivf.insertLocked(bestCentroid,qv)
 
-		if score > bestScore{
-			bestScore = score
-			bestCentroid = i
-		}
+	if ivf.retraining{
+		ivf.pending = append(ivf.pending,ivfPendingOp{id: id,qv: qv})
 	}
-        qv := Quantize(vec)
-	    qv.id = id
-		ivf.lists[bestCentroid] = append(ivf.lists[bestCentroid],qv)
 
 }
 		
@@ -59,7 +83,7 @@ func (ivf *IVFIndex) Search(query []float32,k int,filter func(id string) bool)[]
 	scores := make([]centroidScore,0,len(ivf.centroids))
 
 	for i,centroid := range ivf.centroids{
-		score := CosineSimilarity(query,centroid)
+		score := ivf.metric.similarity(query,centroid)
 
 		scores = append(scores,centroidScore{
 			id : i,
@@ -76,6 +100,9 @@ func (ivf *IVFIndex) Search(query []float32,k int,filter func(id string) bool)[]
 
 		results := make([]Result,0)
 
+		// computed once so candidates are scored straight from int8 codes
+		queryNorm := Magnitude(query)
+
 		probeCount := ivf.probes
 
 		if probeCount > len(ivf.centroids){
@@ -87,6 +114,9 @@ func (ivf *IVFIndex) Search(query []float32,k int,filter func(id string) bool)[]
 			vectors := ivf.lists[centroidId]
 
 			for _,v := range vectors{
+				if v.values == nil{
+					continue // tombstone
+				}
 
 				if filter != nil {
 				if allowed := filter(v.id); !allowed {
@@ -94,9 +124,7 @@ func (ivf *IVFIndex) Search(query []float32,k int,filter func(id string) bool)[]
 				}
 			}
 
-				vec := Dequantize(v)
-
-				score := CosineSimilarity(vec,query)
+				score := ivf.metric.ScoreQuantized(query,queryNorm,v)
 
 				results = append(results,Result{
 					ID : v.id,
@@ -111,9 +139,7 @@ func (ivf *IVFIndex) Search(query []float32,k int,filter func(id string) bool)[]
 			}
 		}
 
-		sort.Slice(results,func(i,j int)bool{
-			return results[i].Score>results[j].Score
-		})
+		SortResults(results,ivf.metric)
 
 		// return top k results
 		if len(results)>k{
@@ -126,6 +152,11 @@ func (ivf *IVFIndex) Search(query []float32,k int,filter func(id string) bool)[]
 // constructor for ivf index
 
 func NewIVFIndex(centroids [][]float32,probes int) *IVFIndex{
+	return NewIVFIndexWithMetric(centroids,probes,MetricCosine)
+}
+
+// NewIVFIndexWithMetric creates an IVF index that assigns and scores with the given metric
+func NewIVFIndexWithMetric(centroids [][]float32,probes int,metric Metric) *IVFIndex{
 	// validat
 	if len(centroids)==0{
 		panic("ivfindex requires atleast one centroid")
@@ -162,24 +193,67 @@ func NewIVFIndex(centroids [][]float32,probes int) *IVFIndex{
 	return &IVFIndex{
 		centroids : centroids,
 		lists : lists,
+		slots : make(map[string]ivfSlot),
+		dead : make(map[int]int),
 		probes : probes,
 		dim : dim,
+		metric : metric,
 	}
 }
 
+// Remove tombstones id's entry; it costs the same however many vectors are
+// indexed, with compaction amortized over the removals that triggered it
 func (ivf *IVFIndex) Remove(id string){
 	ivf.mu.Lock()
 	defer ivf.mu.Unlock()
-	for centroidId,vectors := range ivf.lists{
-		newVectors := make([]QuantizedVector,0,len(vectors))
 
-		for _,qv := range vectors{
-			if qv.id != id{
-				newVectors = append(newVectors,qv)
-			}
+	ivf.removeLocked(id)
+
+	if ivf.retraining{
+		ivf.pending = append(ivf.pending,ivfPendingOp{id: id,remove: true})
+	}
+}
+
+// insertLocked appends qv to list c. Caller holds the write lock and has
+// removed any previous entry for the id.
+func (ivf *IVFIndex) insertLocked(c int,qv QuantizedVector){
+	ivf.slots[qv.id] = ivfSlot{list: c,pos: len(ivf.lists[c])}
+	ivf.lists[c] = append(ivf.lists[c],qv)
+}
+
+// removeLocked tombstones id's entry, if any, and compacts its list once
+// tombstones make up half of it. Caller holds the write lock.
+func (ivf *IVFIndex) removeLocked(id string){
+	slot,ok := ivf.slots[id]
+	if !ok{
+		return
+	}
+
+	delete(ivf.slots,id)
+	ivf.lists[slot.list][slot.pos] = QuantizedVector{}
+	ivf.dead[slot.list]++
+
+	if ivf.dead[slot.list]*2 >= len(ivf.lists[slot.list]){
+		ivf.compactLocked(slot.list)
+	}
+}
+
+// compactLocked drops the tombstones from list c into a fresh slice, so
+// slices handed out before stay unchanged. Caller holds the write lock.
+func (ivf *IVFIndex) compactLocked(c int){
+	old := ivf.lists[c]
+	list := make([]QuantizedVector,0,len(old)-ivf.dead[c])
+
+	for _,qv := range old{
+		if qv.values == nil{
+			continue
 		}
-		ivf.lists[centroidId] = newVectors
+		ivf.slots[qv.id] = ivfSlot{list: c,pos: len(list)}
+		list = append(list,qv)
 	}
+
+	ivf.lists[c] = list
+	delete(ivf.dead,c)
 }
 
 // RebuildFromData clears the index and repopulates it from the snapshot data
@@ -190,6 +264,8 @@ func (ivf *IVFIndex) RebuildFromData(data map[string][]byte) {
 	for i := range ivf.lists {
 		ivf.lists[i] = make([]QuantizedVector, 0)
 	}
+	ivf.slots = make(map[string]ivfSlot, len(data))
+	ivf.dead = make(map[int]int)
 
 	// 2. Re-add all vectors
 	for id, bytes := range data {
@@ -204,3 +280,256 @@ func (ivf *IVFIndex) RebuildFromData(data map[string][]byte) {
 		ivf.mu.Lock()
 	}
 }
+
+// Dim returns the vector dimension the index accepts
+func (ivf *IVFIndex) Dim() int{
+	return ivf.dim
+}
+
+// Metric returns the metric the index was created with
+func (ivf *IVFIndex) Metric() Metric{
+	return ivf.metric
+}
+
+// SetProbes changes how many lists Search scans
+func (ivf *IVFIndex) SetProbes(probes int){
+	ivf.mu.Lock()
+	defer ivf.mu.Unlock()
+
+	if probes <= 0{
+		probes = 1
+	}
+
+	if probes > len(ivf.centroids){
+		probes = len(ivf.centroids)
+	}
+
+	ivf.probes = probes
+}
+
+// Centroids returns a copy of the current centroids
+func (ivf *IVFIndex) Centroids() [][]float32{
+	ivf.mu.RLock()
+	defer ivf.mu.RUnlock()
+
+	out := make([][]float32,len(ivf.centroids))
+	for i,c := range ivf.centroids{
+		out[i] = cloneVector(c)
+	}
+
+	return out
+}
+
+// Retrain swaps in a new set of centroids and moves every quantized vector to
+// the list of its nearest new centroid. Reassignment runs without holding the
+// write lock, so searches and writes continue against the old lists; writes
+// made in the meantime are replayed onto the new lists before the swap.
+// Probes is scaled to search the same share of the lists as before.
+func (ivf *IVFIndex) Retrain(centroids [][]float32) error{
+	_,err := ivf.retrain(centroids,nil)
+	return err
+}
+
+// retrain is Retrain with a check on the reassigned list sizes: when accept
+// is set and returns false, the old lists are kept and retrain reports false
+func (ivf *IVFIndex) retrain(centroids [][]float32,accept func(sizes []int) bool) (bool,error){
+	if len(centroids) == 0{
+		return false,errors.New("ivf retrain requires at least one centroid")
+	}
+
+	for _,c := range centroids{
+		if len(c) != ivf.dim{
+			return false,errors.New("centroid dim mismatch")
+		}
+	}
+
+	// 1. Capture the current lists
+	ivf.mu.Lock()
+	if ivf.retraining{
+		ivf.mu.Unlock()
+		return false,ErrRetrainInProgress
+	}
+	ivf.retraining = true
+	ivf.pending = nil
+
+	// removal clears an entry's values inside the list slice rather than
+	// shrinking it, so the live entries are copied out while the lock is
+	// held; the reassignment below never touches the lists themselves
+	snapshot := make([]QuantizedVector,0,len(ivf.slots))
+	for _,vectors := range ivf.lists{
+		for _,qv := range vectors{
+			if qv.values != nil{
+				snapshot = append(snapshot,qv)
+			}
+		}
+	}
+	ivf.mu.Unlock()
+
+	// 2. Reassign outside the lock
+	lists := make(map[int][]QuantizedVector,len(centroids))
+	for i := range centroids{
+		lists[i] = make([]QuantizedVector,0)
+	}
+	slots := make(map[string]ivfSlot,len(snapshot))
+
+	for _,qv := range snapshot{
+		best,_ := nearestCentroid(Dequantize(qv),centroids,ivf.metric)
+		slots[qv.id] = ivfSlot{list: best,pos: len(lists[best])}
+		lists[best] = append(lists[best],qv)
+	}
+
+	if accept != nil{
+		sizes := make([]int,len(centroids))
+		for i := range centroids{
+			sizes[i] = len(lists[i])
+		}
+		if !accept(sizes){
+			ivf.mu.Lock()
+			ivf.retraining = false
+			ivf.pending = nil
+			ivf.mu.Unlock()
+			return false,nil
+		}
+	}
+
+	// 3. Swap and replay concurrent writes
+	ivf.mu.Lock()
+	defer ivf.mu.Unlock()
+
+	// keep probing the same share of the lists, rounding up
+	old := len(ivf.centroids)
+	ivf.probes = (ivf.probes*len(centroids) + old - 1)/old
+	if ivf.probes < 1{
+		ivf.probes = 1
+	}
+	if ivf.probes > len(centroids){
+		ivf.probes = len(centroids)
+	}
+
+	ivf.centroids = centroids
+	ivf.lists = lists
+	ivf.slots = slots
+	ivf.dead = make(map[int]int)
+
+	for _,op := range ivf.pending{
+		ivf.removeLocked(op.id)
+
+		if !op.remove{
+			best,_ := nearestCentroid(Dequantize(op.qv),centroids,ivf.metric)
+			ivf.insertLocked(best,op.qv)
+		}
+	}
+
+	// the new lists have not been shared yet, so leave them clean
+	for c := range ivf.dead{
+		ivf.compactLocked(c)
+	}
+
+	ivf.retraining = false
+	ivf.pending = nil
+
+	return true,nil
+}
+
+type ivfState struct{
+	Centroids [][]float32
+	Probes int
+	Lists map[int][]persistedQuantized
+}
+
+// SaveState writes the centroids and the int8 inverted lists, so loading
+// skips re-quantizing and reassigning every vector
+func (ivf *IVFIndex) SaveState(w io.Writer) error{
+	return ivf.CaptureState().Encode(w)
+}
+
+// CaptureState copies the live entries of each list. Quantized values and
+// centroids are shared: writes replace them rather than modify them.
+func (ivf *IVFIndex) CaptureState() IndexState{
+	ivf.mu.RLock()
+	defer ivf.mu.RUnlock()
+
+	state := ivfState{
+		Centroids: ivf.centroids,
+		Probes: ivf.probes,
+		Lists: make(map[int][]persistedQuantized,len(ivf.lists)),
+	}
+
+	for c,vectors := range ivf.lists{
+		list := make([]persistedQuantized,0,len(vectors)-ivf.dead[c])
+		for _,qv := range vectors{
+			if qv.values == nil{
+				continue
+			}
+			list = append(list,persistedQuantized{ID: qv.id,Values: qv.values,Scale: qv.scale,Norm: qv.norm})
+		}
+		state.Lists[c] = list
+	}
+
+	return IndexState{kind: "ivf",dim: ivf.dim,metric: ivf.metric,state: state}
+}
+
+// LoadState replaces the centroids and lists with ones written by SaveState
+func (ivf *IVFIndex) LoadState(r io.Reader) error{
+	dec := gob.NewDecoder(r)
+	if err := readIndexHeader(dec,"ivf",ivf.dim,ivf.metric);err != nil{
+		return err
+	}
+
+	var state ivfState
+	if err := dec.Decode(&state);err != nil{
+		return err
+	}
+
+	if len(state.Centroids) == 0{
+		return fmt.Errorf("%w: no centroids",ErrIndexFormat)
+	}
+	for _,c := range state.Centroids{
+		if len(c) != ivf.dim{
+			return fmt.Errorf("%w: centroid dimension %d",ErrIndexFormat,len(c))
+		}
+	}
+
+	lists := make(map[int][]QuantizedVector,len(state.Centroids))
+	for c := range state.Centroids{
+		lists[c] = make([]QuantizedVector,0)
+	}
+
+	slots := make(map[string]ivfSlot)
+
+	for c,list := range state.Lists{
+		if c < 0 || c >= len(state.Centroids){
+			return fmt.Errorf("%w: list %d has no centroid",ErrIndexFormat,c)
+		}
+		vectors := make([]QuantizedVector,len(list))
+		for i,p := range list{
+			if len(p.Values) != ivf.dim{
+				return fmt.Errorf("%w: vector %q has dimension %d",ErrIndexFormat,p.ID,len(p.Values))
+			}
+			if _,dup := slots[p.ID]; dup{
+				return fmt.Errorf("%w: id %q stored twice",ErrIndexFormat,p.ID)
+			}
+			vectors[i] = QuantizedVector{id: p.ID,values: p.Values,scale: p.Scale,norm: p.Norm}
+			slots[p.ID] = ivfSlot{list: c,pos: i}
+		}
+		lists[c] = vectors
+	}
+
+	ivf.mu.Lock()
+	defer ivf.mu.Unlock()
+
+	if ivf.retraining{
+		return ErrRetrainInProgress
+	}
+
+	ivf.centroids = state.Centroids
+	ivf.lists = lists
+	ivf.slots = slots
+	ivf.dead = make(map[int]int)
+	ivf.probes = state.Probes
+	if ivf.probes <= 0 || ivf.probes > len(state.Centroids){
+		ivf.probes = len(state.Centroids)
+	}
+
+	return nil
+}
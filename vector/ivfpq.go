@@ -0,0 +1,613 @@
+package vector
+
+import (
+	"encoding/gob"
+	"errors"
+	"fmt"
+	"io"
+	"maps"
+	"sort"
+	"sync"
+)
+
+// IVFPQIndex is an inverted-file index whose lists hold product-quantized
+// codes instead of int8 vectors. Search builds one ADC lookup table per query
+// and scores every probed code with M table lookups. Until codebooks are
+// trained (pq == nil) vectors are kept raw and searched by brute force.
+type IVFPQIndex struct {
+	mu        sync.RWMutex
+	centroids [][]float32
+	lists     map[int][]pqEntry
+	// slots finds an id's entry in lists, as in IVFIndex: removed entries
+	// are tombstoned (nil codes), counted in dead and compacted away once
+	// they are half of a list
+	slots     map[string]ivfSlot
+	dead      map[int]int
+	probes    int
+	dim       int
+	metric    Metric
+	subspaces int
+	pq        *ProductQuantizer
+	raw       map[string][]float32 // vectors added before training
+
+	// writes that land while Retrain re-encodes lists, replayed on swap
+	retraining bool
+	pending    []ivfpqPendingOp
+}
+
+type pqEntry struct {
+	id    string
+	codes []byte
+	norm  float32 // magnitude of the reconstructed vector
+}
+
+type ivfpqPendingOp struct {
+	id     string
+	vec    []float32
+	remove bool
+}
+
+// IVFPQState is the trained part of an IVF-PQ index, persisted with
+// snapshots so a restart does not retrain
+type IVFPQState struct {
+	Centroids [][]float32
+	Quantizer *ProductQuantizer
+}
+
+// NewIVFPQIndex creates an untrained IVF-PQ index that will split vectors
+// into the given number of subspaces (bytes per vector). It stores raw
+// vectors until Retrain or Restore supplies trained codebooks.
+func NewIVFPQIndex(centroids [][]float32, subspaces int, probes int, metric Metric) *IVFPQIndex {
+	if len(centroids) == 0 {
+		panic("ivfpq index requires atleast one centroid")
+	}
+
+	dim := len(centroids[0])
+	for _, c := range centroids {
+		if len(c) != dim {
+			panic("centroid dim mismatch")
+		}
+	}
+
+	if metric == MetricHamming {
+		panic("ivfpq does not support hamming distance")
+	}
+
+	if subspaces <= 0 || dim%subspaces != 0 {
+		panic("pq subspace count must divide the vector dimension")
+	}
+
+	lists := make(map[int][]pqEntry)
+	for i := range centroids {
+		lists[i] = make([]pqEntry, 0)
+	}
+
+	if probes <= 0 {
+		probes = 1
+	}
+
+	if probes > len(centroids) {
+		probes = len(centroids)
+	}
+
+	return &IVFPQIndex{
+		centroids: centroids,
+		lists:     lists,
+		slots:     make(map[string]ivfSlot),
+		dead:      make(map[int]int),
+		probes:    probes,
+		dim:       dim,
+		metric:    metric,
+		subspaces: subspaces,
+		raw:       make(map[string][]float32),
+	}
+}
+
+func (ivf *IVFPQIndex) Metric() Metric {
+	return ivf.metric
+}
+
+func (ivf *IVFPQIndex) Dim() int {
+	return ivf.dim
+}
+
+// Subspaces is the number of PQ subvectors, i.e. bytes per encoded vector
+func (ivf *IVFPQIndex) Subspaces() int {
+	ivf.mu.RLock()
+	defer ivf.mu.RUnlock()
+
+	return ivf.subspaces
+}
+
+// Trained reports whether codebooks are in place
+func (ivf *IVFPQIndex) Trained() bool {
+	ivf.mu.RLock()
+	defer ivf.mu.RUnlock()
+
+	return ivf.pq != nil
+}
+
+// State returns the trained centroids and codebooks so they can be persisted
+func (ivf *IVFPQIndex) State() IVFPQState {
+	ivf.mu.RLock()
+	defer ivf.mu.RUnlock()
+
+	return IVFPQState{
+		Centroids: ivf.centroids,
+		Quantizer: ivf.pq,
+	}
+}
+
+// Restore installs previously trained centroids and codebooks. The lists are
+// emptied; callers follow up with RebuildFromData.
+func (ivf *IVFPQIndex) Restore(state IVFPQState) error {
+	if len(state.Centroids) == 0 || state.Quantizer == nil {
+		return errors.New("ivfpq state is incomplete")
+	}
+
+	if len(state.Centroids[0]) != ivf.dim || state.Quantizer.Dim != ivf.dim {
+		return errors.New("ivfpq state dim mismatch")
+	}
+
+	ivf.mu.Lock()
+	defer ivf.mu.Unlock()
+
+	ivf.centroids = state.Centroids
+	ivf.pq = state.Quantizer
+	ivf.subspaces = state.Quantizer.M
+	ivf.lists = make(map[int][]pqEntry, len(state.Centroids))
+	ivf.slots = make(map[string]ivfSlot)
+	ivf.dead = make(map[int]int)
+	ivf.raw = make(map[string][]float32)
+
+	if ivf.probes > len(state.Centroids) {
+		ivf.probes = len(state.Centroids)
+	}
+
+	return nil
+}
+
+// SetProbes changes how many lists Search scans
+func (ivf *IVFPQIndex) SetProbes(probes int) {
+	ivf.mu.Lock()
+	defer ivf.mu.Unlock()
+
+	if probes <= 0 {
+		probes = 1
+	}
+
+	if probes > len(ivf.centroids) {
+		probes = len(ivf.centroids)
+	}
+
+	ivf.probes = probes
+}
+
+func (ivf *IVFPQIndex) encode(id string, vec []float32, pq *ProductQuantizer) pqEntry {
+	codes := pq.Encode(vec)
+
+	return pqEntry{
+		id:    id,
+		codes: codes,
+		norm:  Magnitude(pq.Decode(codes)),
+	}
+}
+
+func (ivf *IVFPQIndex) Add(id string, vec []float32) {
+	ivf.mu.Lock()
+	defer ivf.mu.Unlock()
+
+	if len(vec) != ivf.dim {
+		panic("vector dimension mismatch")
+	}
+
+	// adding an id again replaces its vector
+	if ivf.pq == nil {
+		ivf.raw[id] = vec
+	} else {
+		best, _ := nearestCentroid(vec, ivf.centroids, ivf.metric)
+		ivf.removeLocked(id)
+		ivf.insertLocked(best, ivf.encode(id, vec, ivf.pq))
+	}
+
+	if ivf.retraining {
+		ivf.pending = append(ivf.pending, ivfpqPendingOp{id: id, vec: vec})
+	}
+}
+
+// Remove tombstones id's entry without scanning the lists
+func (ivf *IVFPQIndex) Remove(id string) {
+	ivf.mu.Lock()
+	defer ivf.mu.Unlock()
+
+	delete(ivf.raw, id)
+	ivf.removeLocked(id)
+
+	if ivf.retraining {
+		ivf.pending = append(ivf.pending, ivfpqPendingOp{id: id, remove: true})
+	}
+}
+
+func (ivf *IVFPQIndex) Search(query []float32, k int, filter func(id string) bool) []Result {
+	ivf.mu.RLock()
+	defer ivf.mu.RUnlock()
+
+	if len(query) != ivf.dim {
+		panic("vec dim mismatch")
+	}
+
+	if ivf.pq == nil {
+		return ivf.searchRaw(query, k, filter)
+	}
+
+	type centroidScore struct {
+		id    int
+		score float32
+	}
+
+	scores := make([]centroidScore, 0, len(ivf.centroids))
+	for i, centroid := range ivf.centroids {
+		scores = append(scores, centroidScore{
+			id:    i,
+			score: ivf.metric.similarity(query, centroid),
+		})
+	}
+
+	sort.Slice(scores, func(i, j int) bool {
+		return scores[i].score > scores[j].score
+	})
+
+	// codes are not residuals, so one table serves every probed list
+	table := ivf.pq.lookupTable(query, ivf.metric)
+	queryNorm := Magnitude(query)
+
+	results := make([]Result, 0)
+
+	for i := 0; i < ivf.probes && i < len(scores); i++ {
+		for _, e := range ivf.lists[scores[i].id] {
+			if e.codes == nil {
+				continue // tombstone
+			}
+			if filter != nil && !filter(e.id) {
+				continue
+			}
+
+			results = append(results, Result{
+				ID:    e.id,
+				Score: adcScore(table, e.codes, ivf.metric, queryNorm, e.norm),
+			})
+		}
+	}
+
+	SortResults(results, ivf.metric)
+
+	if len(results) > k {
+		return results[:k]
+	}
+
+	return results
+}
+
+// searchRaw brute-forces the vectors added before training
+func (ivf *IVFPQIndex) searchRaw(query []float32, k int, filter func(id string) bool) []Result {
+	results := make([]Result, 0)
+
+	for id, vec := range ivf.raw {
+		if filter != nil && !filter(id) {
+			continue
+		}
+
+		results = append(results, Result{
+			ID:    id,
+			Score: ivf.metric.Score(query, vec),
+		})
+	}
+
+	SortResults(results, ivf.metric)
+
+	if len(results) > k {
+		return results[:k]
+	}
+
+	return results
+}
+
+// RebuildFromData clears the lists and re-encodes every vector in data
+func (ivf *IVFPQIndex) RebuildFromData(data map[string][]byte) {
+	ivf.mu.Lock()
+	defer ivf.mu.Unlock()
+
+	if ivf.pq == nil {
+		ivf.raw = make(map[string][]float32, len(data))
+		for id, b := range data {
+			if vec := bytesToVector(b); len(vec) == ivf.dim {
+				ivf.raw[id] = vec
+			}
+		}
+		return
+	}
+
+	ivf.lists, ivf.slots = ivf.encodeAll(data, ivf.centroids, ivf.pq)
+	ivf.dead = make(map[int]int)
+}
+
+// encodeAll builds lists, and the slots that find their entries, holding
+// every vector in data
+func (ivf *IVFPQIndex) encodeAll(data map[string][]byte, centroids [][]float32, pq *ProductQuantizer) (map[int][]pqEntry, map[string]ivfSlot) {
+	lists := make(map[int][]pqEntry, len(centroids))
+	for i := range centroids {
+		lists[i] = make([]pqEntry, 0)
+	}
+	slots := make(map[string]ivfSlot, len(data))
+
+	for id, b := range data {
+		vec := bytesToVector(b)
+		if len(vec) != ivf.dim {
+			continue
+		}
+
+		best, _ := nearestCentroid(vec, centroids, ivf.metric)
+		slots[id] = ivfSlot{list: best, pos: len(lists[best])}
+		lists[best] = append(lists[best], ivf.encode(id, vec, pq))
+	}
+
+	return lists, slots
+}
+
+// insertLocked appends e to list c. Caller holds the write lock and has
+// removed any previous entry for the id.
+func (ivf *IVFPQIndex) insertLocked(c int, e pqEntry) {
+	ivf.slots[e.id] = ivfSlot{list: c, pos: len(ivf.lists[c])}
+	ivf.lists[c] = append(ivf.lists[c], e)
+}
+
+// removeLocked tombstones id's entry, if any, and compacts its list once
+// tombstones make up half of it. Caller holds the write lock.
+func (ivf *IVFPQIndex) removeLocked(id string) {
+	slot, ok := ivf.slots[id]
+	if !ok {
+		return
+	}
+
+	delete(ivf.slots, id)
+	ivf.lists[slot.list][slot.pos] = pqEntry{}
+	ivf.dead[slot.list]++
+
+	if ivf.dead[slot.list]*2 >= len(ivf.lists[slot.list]) {
+		ivf.compactLocked(slot.list)
+	}
+}
+
+// compactLocked drops the tombstones from list c into a fresh slice, so
+// slices handed out before stay unchanged. Caller holds the write lock.
+func (ivf *IVFPQIndex) compactLocked(c int) {
+	old := ivf.lists[c]
+	list := make([]pqEntry, 0, len(old)-ivf.dead[c])
+
+	for _, e := range old {
+		if e.codes == nil {
+			continue
+		}
+		ivf.slots[e.id] = ivfSlot{list: c, pos: len(list)}
+		list = append(list, e)
+	}
+
+	ivf.lists[c] = list
+	delete(ivf.dead, c)
+}
+
+// Retrain swaps in new coarse centroids and codebooks. PQ codes cannot be
+// re-encoded from other codes without compounding error, so the lists are
+// rebuilt from data, the caller's copy of the original vectors. Encoding runs
+// without the write lock; writes made meanwhile are replayed before the swap.
+func (ivf *IVFPQIndex) Retrain(centroids [][]float32, pq *ProductQuantizer, data map[string][]byte) error {
+	if err := ivf.BeginRetrain(); err != nil {
+		return err
+	}
+
+	return ivf.FinishRetrain(centroids, pq, data)
+}
+
+// BeginRetrain starts recording writes for FinishRetrain to replay. A caller
+// that copies data from elsewhere calls it before taking the copy, while
+// nothing can write to the index, so no write falls between the two.
+func (ivf *IVFPQIndex) BeginRetrain() error {
+	ivf.mu.Lock()
+	defer ivf.mu.Unlock()
+
+	if ivf.retraining {
+		return ErrRetrainInProgress
+	}
+	ivf.retraining = true
+	ivf.pending = nil
+
+	return nil
+}
+
+// FinishRetrain is the rest of Retrain after BeginRetrain. Data must hold
+// every vector as of the BeginRetrain call. On error the retrain is
+// abandoned and the index keeps its lists.
+func (ivf *IVFPQIndex) FinishRetrain(centroids [][]float32, pq *ProductQuantizer, data map[string][]byte) error {
+	if err := ivf.checkRetrain(centroids, pq); err != nil {
+		ivf.mu.Lock()
+		ivf.retraining = false
+		ivf.pending = nil
+		ivf.mu.Unlock()
+		return err
+	}
+
+	lists, slots := ivf.encodeAll(data, centroids, pq)
+
+	ivf.mu.Lock()
+	defer ivf.mu.Unlock()
+
+	ivf.centroids = centroids
+	ivf.pq = pq
+	ivf.subspaces = pq.M
+	ivf.lists = lists
+	ivf.slots = slots
+	ivf.dead = make(map[int]int)
+	ivf.raw = make(map[string][]float32)
+
+	for _, op := range ivf.pending {
+		ivf.removeLocked(op.id)
+
+		if !op.remove {
+			best, _ := nearestCentroid(op.vec, centroids, ivf.metric)
+			ivf.insertLocked(best, ivf.encode(op.id, op.vec, pq))
+		}
+	}
+
+	// the new lists have not been shared yet, so leave them clean
+	for c := range ivf.dead {
+		ivf.compactLocked(c)
+	}
+
+	ivf.retraining = false
+	ivf.pending = nil
+
+	if ivf.probes > len(centroids) {
+		ivf.probes = len(centroids)
+	}
+
+	return nil
+}
+
+func (ivf *IVFPQIndex) checkRetrain(centroids [][]float32, pq *ProductQuantizer) error {
+	if len(centroids) == 0 || pq == nil {
+		return errors.New("ivfpq retrain requires centroids and a product quantizer")
+	}
+
+	for _, c := range centroids {
+		if len(c) != ivf.dim {
+			return errors.New("centroid dim mismatch")
+		}
+	}
+
+	if pq.Dim != ivf.dim {
+		return errors.New("product quantizer dim mismatch")
+	}
+
+	return nil
+}
+
+type ivfpqState struct {
+	Centroids [][]float32
+	Probes    int
+	Subspaces int
+	Quantizer *ProductQuantizer // nil while untrained
+	Lists     map[int][]persistedPQEntry
+	Raw       map[string][]float32
+}
+
+type persistedPQEntry struct {
+	ID    string
+	Codes []byte
+	Norm  float32
+}
+
+// SaveState writes the centroids, codebooks and PQ codes (or the raw
+// vectors of an untrained index)
+func (ivf *IVFPQIndex) SaveState(w io.Writer) error {
+	return ivf.CaptureState().Encode(w)
+}
+
+// CaptureState copies the lists and the raw vector map; codes, vectors,
+// centroids and codebooks are shared since writes replace them
+func (ivf *IVFPQIndex) CaptureState() IndexState {
+	ivf.mu.RLock()
+	defer ivf.mu.RUnlock()
+
+	state := ivfpqState{
+		Centroids: ivf.centroids,
+		Probes:    ivf.probes,
+		Subspaces: ivf.subspaces,
+		Quantizer: ivf.pq,
+		Lists:     make(map[int][]persistedPQEntry, len(ivf.lists)),
+		Raw:       maps.Clone(ivf.raw),
+	}
+
+	for c, entries := range ivf.lists {
+		list := make([]persistedPQEntry, 0, len(entries)-ivf.dead[c])
+		for _, e := range entries {
+			if e.codes == nil {
+				continue
+			}
+			list = append(list, persistedPQEntry{ID: e.id, Codes: e.codes, Norm: e.norm})
+		}
+		state.Lists[c] = list
+	}
+
+	return IndexState{kind: "ivfpq", dim: ivf.dim, metric: ivf.metric, state: state}
+}
+
+// LoadState replaces the index contents with ones written by SaveState
+func (ivf *IVFPQIndex) LoadState(r io.Reader) error {
+	dec := gob.NewDecoder(r)
+	if err := readIndexHeader(dec, "ivfpq", ivf.dim, ivf.metric); err != nil {
+		return err
+	}
+
+	var state ivfpqState
+	if err := dec.Decode(&state); err != nil {
+		return err
+	}
+
+	if len(state.Centroids) == 0 {
+		return fmt.Errorf("%w: no centroids", ErrIndexFormat)
+	}
+	for _, c := range state.Centroids {
+		if len(c) != ivf.dim {
+			return fmt.Errorf("%w: centroid dimension %d", ErrIndexFormat, len(c))
+		}
+	}
+	if state.Quantizer != nil && (state.Quantizer.Dim != ivf.dim || state.Quantizer.M != state.Subspaces) {
+		return fmt.Errorf("%w: quantizer does not match the index", ErrIndexFormat)
+	}
+
+	lists := make(map[int][]pqEntry, len(state.Centroids))
+	slots := make(map[string]ivfSlot)
+	for c, list := range state.Lists {
+		if c < 0 || c >= len(state.Centroids) {
+			return fmt.Errorf("%w: list %d has no centroid", ErrIndexFormat, c)
+		}
+		entries := make([]pqEntry, len(list))
+		for i, p := range list {
+			if len(p.Codes) != state.Subspaces || len(p.Codes) == 0 {
+				return fmt.Errorf("%w: %q has %d codes", ErrIndexFormat, p.ID, len(p.Codes))
+			}
+			if _, dup := slots[p.ID]; dup {
+				return fmt.Errorf("%w: id %q stored twice", ErrIndexFormat, p.ID)
+			}
+			entries[i] = pqEntry{id: p.ID, codes: p.Codes, norm: p.Norm}
+			slots[p.ID] = ivfSlot{list: c, pos: i}
+		}
+		lists[c] = entries
+	}
+
+	raw := state.Raw
+	if raw == nil {
+		raw = make(map[string][]float32)
+	}
+
+	ivf.mu.Lock()
+	defer ivf.mu.Unlock()
+
+	if ivf.retraining {
+		return ErrRetrainInProgress
+	}
+
+	ivf.centroids = state.Centroids
+	ivf.subspaces = state.Subspaces
+	ivf.pq = state.Quantizer
+	ivf.lists = lists
+	ivf.slots = slots
+	ivf.dead = make(map[int]int)
+	ivf.raw = raw
+	ivf.probes = state.Probes
+	if ivf.probes <= 0 || ivf.probes > len(state.Centroids) {
+		ivf.probes = len(state.Centroids)
+	}
+
+	return nil
+}
@@ -0,0 +1,247 @@
+package vector
+
+import (
+	"math"
+	"math/rand"
+	"time"
+)
+
+// KMeansConfig controls centroid training.
+type KMeansConfig struct {
+	K         int     // number of centroids to learn
+	MaxIter   int     // upper bound on training iterations
+	BatchSize int     // mini-batch size; 0 trains on the full sample every iteration
+	Tolerance float32 // stop once no centroid moves further than this
+	Seed      int64   // 0 seeds from the clock
+	Metric    Metric  // assignment rule; should match the index the centroids are for
+}
+
+// TrainKMeans learns cfg.K centroids from samples using k-means++
+// initialisation followed by Lloyd iterations, or Sculley's mini-batch
+// update when cfg.BatchSize is set. Points are assigned with cfg.Metric, the
+// same rule IVFIndex uses for its inverted lists.
+func TrainKMeans(samples [][]float32, cfg KMeansConfig) [][]float32 {
+	if len(samples) == 0 {
+		panic("kmeans requires at least one sample")
+	}
+
+	dim := len(samples[0])
+	for _, s := range samples {
+		if len(s) != dim {
+			panic("kmeans sample dim mismatch")
+		}
+	}
+
+	if cfg.K <= 0 {
+		panic("kmeans k must be greater than 0")
+	}
+
+	if cfg.K > len(samples) {
+		cfg.K = len(samples)
+	}
+
+	if cfg.MaxIter <= 0 {
+		cfg.MaxIter = 25
+	}
+
+	seed := cfg.Seed
+	if seed == 0 {
+		seed = time.Now().UnixNano()
+	}
+	rng := rand.New(rand.NewSource(seed))
+
+	centroids := kmeansPlusPlus(samples, cfg.K, cfg.Metric, rng)
+
+	if cfg.BatchSize > 0 && cfg.BatchSize < len(samples) {
+		miniBatchKMeans(samples, centroids, cfg, rng)
+	} else {
+		lloydKMeans(samples, centroids, cfg)
+	}
+
+	return centroids
+}
+
+// nearestCentroid returns the index and similarity of the closest centroid
+func nearestCentroid(vec []float32, centroids [][]float32, metric Metric) (int, float32) {
+	best := -1
+	bestScore := float32(math.Inf(-1))
+
+	for i, c := range centroids {
+		score := metric.similarity(vec, c)
+		if score > bestScore {
+			bestScore = score
+			best = i
+		}
+	}
+
+	return best, bestScore
+}
+
+// kmeansDistance is the distance k-means++ seeding and convergence use:
+// angular for cosine, Euclidean otherwise
+func kmeansDistance(metric Metric, a, b []float32) float32 {
+	if metric == MetricCosine {
+		return 1 - CosineSimilarity(a, b)
+	}
+	return L2Distance(a, b)
+}
+
+// kmeansPlusPlus picks initial centroids, each new one sampled with
+// probability proportional to its squared distance from the chosen set.
+func kmeansPlusPlus(samples [][]float32, k int, metric Metric, rng *rand.Rand) [][]float32 {
+	centroids := make([][]float32, 0, k)
+	centroids = append(centroids, cloneVector(samples[rng.Intn(len(samples))]))
+
+	// distance to the closest chosen centroid, squared
+	dist := make([]float64, len(samples))
+	for i, s := range samples {
+		d := float64(kmeansDistance(metric, s, centroids[0]))
+		dist[i] = d * d
+	}
+
+	for len(centroids) < k {
+		total := 0.0
+		for _, d := range dist {
+			total += d
+		}
+
+		next := rng.Intn(len(samples))
+		if total > 0 {
+			target := rng.Float64() * total
+			for i, d := range dist {
+				target -= d
+				if target <= 0 {
+					next = i
+					break
+				}
+			}
+		}
+
+		c := cloneVector(samples[next])
+		centroids = append(centroids, c)
+
+		for i, s := range samples {
+			d := float64(kmeansDistance(metric, s, c))
+			if d*d < dist[i] {
+				dist[i] = d * d
+			}
+		}
+	}
+
+	return centroids
+}
+
+func lloydKMeans(samples [][]float32, centroids [][]float32, cfg KMeansConfig) {
+	dim := len(centroids[0])
+	assign := make([]int, len(samples))
+
+	for iter := 0; iter < cfg.MaxIter; iter++ {
+		for i, s := range samples {
+			assign[i], _ = nearestCentroid(s, centroids, cfg.Metric)
+		}
+
+		sums := make([][]float32, len(centroids))
+		counts := make([]int, len(centroids))
+		for i := range sums {
+			sums[i] = make([]float32, dim)
+		}
+
+		for i, s := range samples {
+			c := assign[i]
+			counts[c]++
+			for j, v := range s {
+				sums[c][j] += v
+			}
+		}
+
+		var maxShift float32
+		for c := range centroids {
+			// empty clusters keep their previous position
+			if counts[c] == 0 {
+				continue
+			}
+
+			for j := range sums[c] {
+				sums[c][j] /= float32(counts[c])
+			}
+
+			if shift := kmeansDistance(cfg.Metric, centroids[c], sums[c]); shift > maxShift {
+				maxShift = shift
+			}
+			centroids[c] = sums[c]
+		}
+
+		if maxShift <= cfg.Tolerance {
+			return
+		}
+	}
+}
+
+func miniBatchKMeans(samples [][]float32, centroids [][]float32, cfg KMeansConfig, rng *rand.Rand) {
+	counts := make([]int, len(centroids))
+	batch := make([]int, cfg.BatchSize)
+	assign := make([]int, cfg.BatchSize)
+
+	for iter := 0; iter < cfg.MaxIter; iter++ {
+		for i := range batch {
+			batch[i] = rng.Intn(len(samples))
+			assign[i], _ = nearestCentroid(samples[batch[i]], centroids, cfg.Metric)
+		}
+
+		var maxShift float32
+		for i, idx := range batch {
+			c := assign[i]
+			counts[c]++
+
+			// per-centroid learning rate decays as it absorbs more points
+			eta := 1 / float32(counts[c])
+			before := cloneVector(centroids[c])
+			for j, v := range samples[idx] {
+				centroids[c][j] = (1-eta)*centroids[c][j] + eta*v
+			}
+
+			if shift := kmeansDistance(cfg.Metric, before, centroids[c]); shift > maxShift {
+				maxShift = shift
+			}
+		}
+
+		if iter > 0 && maxShift <= cfg.Tolerance {
+			return
+		}
+	}
+}
+
+// SampleVectors decodes up to n vectors of the given dimension and element
+// type from store data, picked uniformly at random. Vectors of any other size
+// are skipped.
+func SampleVectors(data map[string][]byte, n int, dim int, elem ElementType) [][]float32 {
+	samples := make([][]float32, 0, n)
+	seen := 0
+
+	rng := rand.New(rand.NewSource(time.Now().UnixNano()))
+
+	// reservoir sampling over the map
+	for _, b := range data {
+		if len(b) != elem.EncodedSize(dim) {
+			continue
+		}
+
+		seen++
+		if len(samples) < n {
+			samples = append(samples, DecodeVector(b, elem))
+			continue
+		}
+
+		if j := rng.Intn(seen); j < n {
+			samples[j] = DecodeVector(b, elem)
+		}
+	}
+
+	return samples
+}
+
+func cloneVector(v []float32) []float32 {
+	out := make([]float32, len(v))
+	copy(out, v)
+	return out
+}
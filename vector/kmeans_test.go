@@ -0,0 +1,146 @@
+package vector
+
+import (
+	"fmt"
+	"math/rand"
+	"sync"
+	"testing"
+)
+
+// clusteredVectors generates n vectors scattered around `clusters` random
+// centres, which is how real embedding collections are shaped.
+func clusteredVectors(n int, dim int, clusters int, rng *rand.Rand) [][]float32 {
+	centres := make([][]float32, clusters)
+	for i := range centres {
+		centres[i] = make([]float32, dim)
+		for j := range centres[i] {
+			centres[i][j] = rng.Float32()*2 - 1
+		}
+	}
+
+	out := make([][]float32, n)
+	for i := range out {
+		c := centres[rng.Intn(clusters)]
+		out[i] = make([]float32, dim)
+		for j := range out[i] {
+			out[i][j] = c[j] + (rng.Float32()*2-1)*0.2
+		}
+	}
+
+	return out
+}
+
+func TestTrainKMeansSeparatesClusters(t *testing.T) {
+	rng := rand.New(rand.NewSource(1))
+	samples := clusteredVectors(2000, 32, 8, rng)
+
+	for _, batch := range []int{0, 256} {
+		centroids := TrainKMeans(samples, KMeansConfig{K: 8, MaxIter: 30, BatchSize: batch, Seed: 7})
+
+		if len(centroids) != 8 {
+			t.Fatalf("expected 8 centroids, got %d", len(centroids))
+		}
+
+		counts := make([]int, len(centroids))
+		for _, s := range samples {
+			c, _ := nearestCentroid(s, centroids, MetricCosine)
+			counts[c]++
+		}
+
+		// with random centroids nearly everything lands in one list
+		for c, n := range counts {
+			if n > len(samples)/2 {
+				t.Errorf("batch=%d: centroid %d holds %d of %d vectors", batch, c, n, len(samples))
+			}
+		}
+	}
+}
+
+func TestIVFRetrainImprovesRecall(t *testing.T) {
+	rng := rand.New(rand.NewSource(2))
+	dim := 32
+	data := clusteredVectors(5000, dim, 16, rng)
+
+	bruteForce := NewIndex()
+	ivf := NewIVFIndex(RandomCentroids(16, dim), 2)
+
+	for i, v := range data {
+		id := fmt.Sprintf("vec-%d", i)
+		bruteForce.Add(id, v)
+		ivf.Add(id, v)
+	}
+
+	recall := func() float64 {
+		total := 0.0
+		for q := 0; q < 50; q++ {
+			query := data[rng.Intn(len(data))]
+
+			truth := make(map[string]bool)
+			for _, r := range bruteForce.Search(query, 10, nil) {
+				truth[r.ID] = true
+			}
+
+			matches := 0
+			for _, r := range ivf.Search(query, 10, nil) {
+				if truth[r.ID] {
+					matches++
+				}
+			}
+			total += float64(matches) / 10
+		}
+		return total / 50
+	}
+
+	before := recall()
+
+	if err := ivf.Retrain(TrainKMeans(data, KMeansConfig{K: 16, Seed: 3})); err != nil {
+		t.Fatal(err)
+	}
+
+	after := recall()
+	t.Logf("recall with random centroids %.2f%%, trained %.2f%%", before*100, after*100)
+
+	if after < 0.9 {
+		t.Errorf("recall after retrain is too low (%.2f%%)", after*100)
+	}
+}
+
+func TestIVFRetrainKeepsConcurrentWrites(t *testing.T) {
+	rng := rand.New(rand.NewSource(3))
+	dim := 16
+	data := clusteredVectors(3000, dim, 4, rng)
+
+	ivf := NewIVFIndex(RandomCentroids(4, dim), 4)
+	for i := 0; i < 2000; i++ {
+		ivf.Add(fmt.Sprintf("vec-%d", i), data[i])
+	}
+
+	centroids := TrainKMeans(data[:2000], KMeansConfig{K: 4, Seed: 4})
+
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for i := 2000; i < 3000; i++ {
+			ivf.Add(fmt.Sprintf("vec-%d", i), data[i])
+		}
+		for i := 0; i < 100; i++ {
+			ivf.Remove(fmt.Sprintf("vec-%d", i))
+		}
+	}()
+
+	if err := ivf.Retrain(centroids); err != nil {
+		t.Fatal(err)
+	}
+	wg.Wait()
+
+	// removed entries may still be tombstones, so count live ones
+	total := 0
+	for _, size := range ivf.ListSizes() {
+		total += size
+	}
+
+	if total != 2900 {
+		t.Fatalf("expected 2900 vectors after retrain, got %d", total)
+	}
+}
@@ -0,0 +1,115 @@
+package vector
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// Metric is the distance function an index is built with. It is fixed when
+// the index is created and used for centroid assignment, scoring and ordering.
+//
+// Result.Score semantics per metric:
+//   - MetricCosine: cosine similarity in [-1, 1], higher is better
+//   - MetricInnerProduct: raw dot product, higher is better
+//   - MetricL2: Euclidean distance, lower is better
+//   - MetricHamming: number of differing sign bits, lower is better
+type Metric int
+
+const (
+	MetricCosine Metric = iota
+	MetricInnerProduct
+	MetricL2
+	MetricHamming
+)
+
+func (m Metric) String() string {
+	switch m {
+	case MetricInnerProduct:
+		return "dot"
+	case MetricL2:
+		return "l2"
+	case MetricHamming:
+		return "hamming"
+	default:
+		return "cosine"
+	}
+}
+
+// ParseMetric accepts the names used in configs and API requests
+func ParseMetric(name string) (Metric, error) {
+	switch strings.ToLower(strings.TrimSpace(name)) {
+	case "", "cosine":
+		return MetricCosine, nil
+	case "dot", "ip", "inner_product":
+		return MetricInnerProduct, nil
+	case "l2", "euclidean":
+		return MetricL2, nil
+	case "hamming":
+		return MetricHamming, nil
+	}
+
+	return MetricCosine, fmt.Errorf("unknown metric %q", name)
+}
+
+// Score computes the value reported in Result.Score for a pair of vectors
+func (m Metric) Score(a, b []float32) float32 {
+	switch m {
+	case MetricInnerProduct:
+		return Dot(a, b)
+	case MetricL2:
+		return L2Distance(a, b)
+	case MetricHamming:
+		return float32(signHamming(a, b))
+	default:
+		return CosineSimilarity(a, b)
+	}
+}
+
+// signHamming is the Hamming distance between the sign bits of two float
+// vectors, matching HammingDistance on their ElementBinary encodings
+func signHamming(a, b []float32) int {
+	dist := 0
+	for i := range a {
+		if (a[i] > 0) != (b[i] > 0) {
+			dist++
+		}
+	}
+	return dist
+}
+
+// HigherIsBetter reports whether larger scores mean closer vectors
+func (m Metric) HigherIsBetter() bool {
+	return m != MetricL2 && m != MetricHamming
+}
+
+// Better reports whether score a ranks ahead of score b
+func (m Metric) Better(a, b float32) bool {
+	if m.HigherIsBetter() {
+		return a > b
+	}
+	return a < b
+}
+
+// similarity maps every metric onto "higher is closer" for internal ranking
+func (m Metric) similarity(a, b []float32) float32 {
+	if !m.HigherIsBetter() {
+		return -m.Score(a, b)
+	}
+	return m.Score(a, b)
+}
+
+// fromSimilarity turns an internal similarity back into a Result.Score
+func (m Metric) fromSimilarity(s float32) float32 {
+	if !m.HigherIsBetter() {
+		return -s
+	}
+	return s
+}
+
+// SortResults orders results best-first for the metric
+func SortResults(results []Result, m Metric) {
+	sort.Slice(results, func(i, j int) bool {
+		return m.Better(results[i].Score, results[j].Score)
+	})
+}
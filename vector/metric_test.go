@@ -0,0 +1,115 @@
+package vector
+
+import (
+	"encoding/binary"
+	"fmt"
+	"math"
+	"math/rand"
+	"testing"
+)
+
+func TestMetricScores(t *testing.T) {
+	a := []float32{1, 0}
+	b := []float32{3, 4}
+
+	if got := MetricCosine.Score(a, b); got < 0.599 || got > 0.601 {
+		t.Errorf("cosine: expected 0.6, got %f", got)
+	}
+	if got := MetricInnerProduct.Score(a, b); got != 3 {
+		t.Errorf("dot: expected 3, got %f", got)
+	}
+	if got := MetricL2.Score(a, b); got < 4.472 || got > 4.473 {
+		t.Errorf("l2: expected 4.472, got %f", got)
+	}
+
+	for _, name := range []string{"cosine", "dot", "l2"} {
+		m, err := ParseMetric(name)
+		if err != nil || m.String() != name {
+			t.Errorf("ParseMetric(%q) = %v, %v", name, m, err)
+		}
+	}
+
+	if _, err := ParseMetric("manhattan"); err == nil {
+		t.Errorf("expected error for unknown metric")
+	}
+}
+
+// Every index must agree with brute force on ordering for each metric.
+// The vectors differ in magnitude so cosine, dot and l2 rank differently.
+func TestIndexesHonourMetric(t *testing.T) {
+	rng := rand.New(rand.NewSource(9))
+	dim := 8
+
+	data := make([][]float32, 300)
+	for i := range data {
+		data[i] = make([]float32, dim)
+		scale := rng.Float32()*10 + 0.1
+		for j := range data[i] {
+			data[i][j] = (rng.Float32()*2 - 1) * scale
+		}
+	}
+
+	for _, metric := range []Metric{MetricCosine, MetricInnerProduct, MetricL2} {
+		flat := NewIndexWithMetric(metric)
+		ivf := NewIVFIndexWithMetric(TrainKMeans(data, KMeansConfig{K: 4, Seed: 1, Metric: metric}), 4, metric)
+		hnsw := NewHNSWIndexWithMetric(dim, metric, 16, 200, 300)
+
+		for i, v := range data {
+			id := fmt.Sprintf("vec-%d", i)
+			flat.Add(id, v)
+			ivf.Add(id, v)
+			hnsw.Add(id, v)
+		}
+
+		query := data[0]
+		truth := flat.Search(query, 5, nil)
+
+		for i := 1; i < len(truth); i++ {
+			if metric.Better(truth[i].Score, truth[i-1].Score) {
+				t.Fatalf("%s: flat results not ordered best-first: %v", metric, truth)
+			}
+		}
+
+		if got := hnsw.Search(query, 1, nil); len(got) != 1 || got[0].ID != truth[0].ID {
+			t.Errorf("%s: hnsw top result %v, want %s", metric, got, truth[0].ID)
+		}
+
+		// IVF scores dequantized int8 vectors, so only the ranking is compared
+		if got := ivf.Search(query, 1, nil); len(got) != 1 || got[0].ID != truth[0].ID {
+			t.Errorf("%s: ivf top result %v, want %s", metric, got, truth[0].ID)
+		}
+	}
+}
+
+func TestScoreQuantizedMatchesDequantize(t *testing.T) {
+	rng := rand.New(rand.NewSource(11))
+
+	for i := 0; i < 100; i++ {
+		vec := make([]float32, 64)
+		query := make([]float32, 64)
+		for j := range vec {
+			vec[j] = rng.Float32()*2 - 1
+			query[j] = rng.Float32()*2 - 1
+		}
+
+		qv := Quantize(vec)
+		deq := Dequantize(qv)
+
+		for _, metric := range []Metric{MetricCosine, MetricInnerProduct, MetricL2} {
+			want := metric.Score(query, deq)
+			got := metric.ScoreQuantized(query, Magnitude(query), qv)
+
+			if diff := got - want; diff > 1e-3 || diff < -1e-3 {
+				t.Fatalf("%s: quantized score %f, dequantized %f", metric, got, want)
+			}
+		}
+	}
+}
+
+func vectorToBytesTest(vec []float32) []byte {
+	b := make([]byte, len(vec)*4)
+	for i, f := range vec {
+		binary.LittleEndian.PutUint32(b[i*4:(i+1)*4], math.Float32bits(f))
+	}
+	return b
+}
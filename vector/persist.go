@@ -0,0 +1,102 @@
+package vector
+
+import (
+	"encoding/gob"
+	"errors"
+	"fmt"
+	"io"
+)
+
+// indexFormatVersion is bumped whenever a persisted index layout changes.
+// Files with another version are rejected and the caller rebuilds from data.
+const indexFormatVersion = 1
+
+// ErrIndexFormat means a persisted index was written by another index type,
+// format version, dimension or metric and cannot be loaded as is
+var ErrIndexFormat = errors.New("incompatible persisted index")
+
+// PersistentIndex is implemented by indexes that can write their built
+// state (centroids, lists, codes, graph) and load it back directly, which is
+// much faster than RebuildFromData re-quantizing every vector on startup.
+type PersistentIndex interface {
+	VectorIndex
+	SaveState(w io.Writer) error
+	// CaptureState takes the state SaveState writes without encoding it.
+	// The capture shares nothing later writes modify, so it can be encoded
+	// while the index keeps changing.
+	CaptureState() IndexState
+	// LoadState replaces the index contents. On error the index is unchanged.
+	LoadState(r io.Reader) error
+}
+
+// IndexState is a persistent index's state captured at one point in time
+type IndexState struct {
+	kind   string
+	dim    int
+	metric Metric
+	state  any
+}
+
+// Encode writes the state in the form LoadState reads
+func (s IndexState) Encode(w io.Writer) error {
+	enc := gob.NewEncoder(w)
+	if err := writeIndexHeader(enc, s.kind, s.dim, s.metric); err != nil {
+		return err
+	}
+
+	return enc.Encode(s.state)
+}
+
+// indexHeader precedes every persisted index
+type indexHeader struct {
+	Kind    string
+	Version int
+	Dim     int
+	Metric  Metric
+}
+
+func writeIndexHeader(enc *gob.Encoder, kind string, dim int, metric Metric) error {
+	return enc.Encode(indexHeader{
+		Kind:    kind,
+		Version: indexFormatVersion,
+		Dim:     dim,
+		Metric:  metric,
+	})
+}
+
+// readIndexHeader checks a persisted index matches the index loading it
+func readIndexHeader(dec *gob.Decoder, kind string, dim int, metric Metric) error {
+	var h indexHeader
+	if err := dec.Decode(&h); err != nil {
+		return err
+	}
+
+	switch {
+	case h.Kind != kind:
+		return fmt.Errorf("%w: file holds a %s index, not %s", ErrIndexFormat, h.Kind, kind)
+	case h.Version != indexFormatVersion:
+		return fmt.Errorf("%w: format version %d, want %d", ErrIndexFormat, h.Version, indexFormatVersion)
+	case h.Dim != dim:
+		return fmt.Errorf("%w: dimension %d, want %d", ErrIndexFormat, h.Dim, dim)
+	case h.Metric != metric:
+		return fmt.Errorf("%w: metric %s, want %s", ErrIndexFormat, h.Metric, metric)
+	}
+
+	return nil
+}
+
+// persistedQuantized is the gob form of a QuantizedVector
+type persistedQuantized struct {
+	ID     string
+	Values []int8
+	Scale  float32
+	Norm   float32
+}
+
+var (
+	_ PersistentIndex = (*Index)(nil)
+	_ PersistentIndex = (*IVFIndex)(nil)
+	_ PersistentIndex = (*IVFPQIndex)(nil)
+	_ PersistentIndex = (*HNSWIndex)(nil)
+	_ PersistentIndex = (*BinaryIndex)(nil)
+)
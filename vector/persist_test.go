@@ -0,0 +1,160 @@
+package vector
+
+import (
+	"bytes"
+	"encoding/gob"
+	"errors"
+	"math/rand"
+	"strconv"
+	"testing"
+)
+
+func TestPersistedIndexesSearchTheSame(t *testing.T) {
+	rng := rand.New(rand.NewSource(5))
+	vecs := clusteredVectors(2000, 32, 8, rng)
+
+	data := make(map[string][]byte, len(vecs))
+	for i, v := range vecs {
+		data["v"+strconv.Itoa(i)] = vectorToBytesTest(v)
+	}
+
+	pq := NewIVFPQIndex(RandomCentroids(4, 32), 8, 4, MetricCosine)
+	quantizer, err := TrainProductQuantizer(vecs, 8, 5)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := pq.Retrain(TrainKMeans(vecs, KMeansConfig{K: 4, Seed: 1}), quantizer, data); err != nil {
+		t.Fatal(err)
+	}
+
+	binaryVecs := make(map[string][]float32, len(vecs))
+	for id, b := range data {
+		binaryVecs[id] = bytesToVector(b)
+	}
+
+	cases := []struct {
+		name  string
+		built PersistentIndex
+		empty func() PersistentIndex
+	}{
+		{"flat", NewIndexWithMetric(MetricL2), func() PersistentIndex { return NewIndexWithMetric(MetricL2) }},
+		{"ivf", NewIVFIndex(RandomCentroids(4, 32), 2), func() PersistentIndex { return NewIVFIndex(RandomCentroids(4, 32), 2) }},
+		{"hnsw", NewHNSWIndex(32, 8, 40, 40), func() PersistentIndex { return NewHNSWIndex(32, 8, 40, 40) }},
+		{"ivfpq", pq, func() PersistentIndex { return NewIVFPQIndex(RandomCentroids(4, 32), 8, 4, MetricCosine) }},
+		{"binary", NewBinaryIndex(32), func() PersistentIndex { return NewBinaryIndex(32) }},
+	}
+
+	for _, tc := range cases {
+		if tc.name != "ivfpq" {
+			tc.built.RebuildFromData(data)
+		}
+
+		var buf bytes.Buffer
+		if err := tc.built.SaveState(&buf); err != nil {
+			t.Fatalf("%s: %v", tc.name, err)
+		}
+
+		loaded := tc.empty()
+		if err := loaded.LoadState(&buf); err != nil {
+			t.Fatalf("%s: %v", tc.name, err)
+		}
+
+		for q := 0; q < 20; q++ {
+			query := vecs[rng.Intn(len(vecs))]
+			want := tc.built.Search(query, 10, nil)
+			got := loaded.Search(query, 10, nil)
+
+			if len(want) != len(got) {
+				t.Fatalf("%s: expected %d results, got %d", tc.name, len(want), len(got))
+			}
+			for i := range want {
+				if want[i].Score != got[i].Score {
+					t.Fatalf("%s: result %d differs: %v vs %v", tc.name, i, want[i], got[i])
+				}
+			}
+		}
+	}
+}
+
+func TestLoadStateRejectsIncompatibleIndex(t *testing.T) {
+	ivf := NewIVFIndex(RandomCentroids(2, 16), 1)
+	ivf.Add("a", make([]float32, 16))
+
+	var buf bytes.Buffer
+	if err := ivf.SaveState(&buf); err != nil {
+		t.Fatal(err)
+	}
+	saved := buf.Bytes()
+
+	// different index type, dimension and metric
+	targets := []PersistentIndex{
+		NewHNSWIndex(16, 0, 0, 0),
+		NewIVFIndex(RandomCentroids(2, 8), 1),
+		NewIVFIndexWithMetric(RandomCentroids(2, 16), 1, MetricL2),
+	}
+
+	for _, target := range targets {
+		if err := target.LoadState(bytes.NewReader(saved)); !errors.Is(err, ErrIndexFormat) {
+			t.Fatalf("expected ErrIndexFormat, got %v", err)
+		}
+	}
+}
+
+func TestHNSWLoadStateChecksLevels(t *testing.T) {
+	h := NewHNSWIndex(4, 0, 0, 0)
+	for i := 0; i < 500; i++ {
+		h.Add(strconv.Itoa(i), []float32{float32(i), 1, float32(i % 3), 2})
+	}
+
+	save := func(edit func(*hnswState)) []byte {
+		state := hnswState{M: h.m, EfConstruction: h.efConstruction, Entry: h.entry, MaxLevel: h.maxLevel}
+		for _, n := range h.nodes {
+			neighbors := make([][]int32, len(n.neighbors))
+			for l, links := range n.neighbors {
+				neighbors[l] = append([]int32(nil), links...)
+			}
+			state.Nodes = append(state.Nodes, hnswPersistedNode{ID: n.id, Vec: n.vec, Neighbors: neighbors})
+		}
+		edit(&state)
+
+		var buf bytes.Buffer
+		enc := gob.NewEncoder(&buf)
+		if err := writeIndexHeader(enc, "hnsw", h.dim, h.metric); err != nil {
+			t.Fatal(err)
+		}
+		if err := enc.Encode(state); err != nil {
+			t.Fatal(err)
+		}
+		return buf.Bytes()
+	}
+
+	if err := NewHNSWIndex(4, 0, 0, 0).LoadState(bytes.NewReader(save(func(*hnswState) {}))); err != nil {
+		t.Fatalf("expected the graph to load: %v", err)
+	}
+
+	// the node the entry point links to on its top layer
+	var upper int32 = -1
+	for l := h.maxLevel; l > 0 && upper < 0; l-- {
+		if links := h.nodes[h.entry].neighbors[l]; len(links) > 0 {
+			upper = links[0]
+		}
+	}
+	if upper < 0 {
+		t.Fatal("expected a graph with more than one level")
+	}
+
+	edits := map[string]func(*hnswState){
+		"no layers":          func(s *hnswState) { s.Nodes[0].Neighbors = nil },
+		"above max level":    func(s *hnswState) { s.MaxLevel-- },
+		"link above a level": func(s *hnswState) { s.Nodes[upper].Neighbors = s.Nodes[upper].Neighbors[:1] },
+	}
+	for name, edit := range edits {
+		target := NewHNSWIndex(4, 0, 0, 0)
+		if err := target.LoadState(bytes.NewReader(save(edit))); !errors.Is(err, ErrIndexFormat) {
+			t.Errorf("%s: expected ErrIndexFormat, got %v", name, err)
+		}
+		if target.Len() != 0 {
+			t.Errorf("%s: expected the rejected graph not to be loaded", name)
+		}
+	}
+}
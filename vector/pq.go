@@ -0,0 +1,143 @@
+package vector
+
+import (
+	"errors"
+	"math"
+)
+
+const (
+	// pqCentroids is the number of codewords per subspace; one byte per code
+	pqCentroids = 256
+	// pqTrainingBatch switches codebook training to mini-batch k-means on
+	// large samples, since every subspace trains its own 256 codewords
+	pqTrainingBatch = 4096
+)
+
+// ProductQuantizer splits a vector into M subvectors and replaces each with
+// the index of its nearest codeword, so a vector costs M bytes instead of one
+// byte (int8) or four bytes (float32) per dimension. Fields are exported so
+// the trained codebooks can be gob-encoded into snapshots.
+type ProductQuantizer struct {
+	Dim       int
+	M         int
+	Codebooks [][][]float32 // [M][codeword][Dim/M]
+}
+
+// TrainProductQuantizer learns one codebook per subspace with k-means (L2)
+// over the samples. dim must be divisible by m.
+func TrainProductQuantizer(samples [][]float32, m int, iters int) (*ProductQuantizer, error) {
+	if len(samples) == 0 {
+		return nil, errors.New("pq training requires at least one sample")
+	}
+
+	dim := len(samples[0])
+	if m <= 0 || dim%m != 0 {
+		return nil, errors.New("pq subspace count must divide the vector dimension")
+	}
+
+	sub := dim / m
+	pq := &ProductQuantizer{
+		Dim:       dim,
+		M:         m,
+		Codebooks: make([][][]float32, m),
+	}
+
+	for s := 0; s < m; s++ {
+		subSamples := make([][]float32, len(samples))
+		for i, vec := range samples {
+			if len(vec) != dim {
+				return nil, errors.New("pq sample dim mismatch")
+			}
+			subSamples[i] = vec[s*sub : (s+1)*sub]
+		}
+
+		pq.Codebooks[s] = TrainKMeans(subSamples, KMeansConfig{
+			K:         pqCentroids,
+			MaxIter:   iters,
+			BatchSize: pqTrainingBatch,
+			Seed:      int64(s + 1),
+			Metric:    MetricL2,
+		})
+	}
+
+	return pq, nil
+}
+
+// BytesPerVector is the size of one encoded vector
+func (pq *ProductQuantizer) BytesPerVector() int {
+	return pq.M
+}
+
+func (pq *ProductQuantizer) subDim() int {
+	return pq.Dim / pq.M
+}
+
+// Encode maps each subvector to its nearest codeword
+func (pq *ProductQuantizer) Encode(vec []float32) []byte {
+	sub := pq.subDim()
+	codes := make([]byte, pq.M)
+
+	for s := 0; s < pq.M; s++ {
+		best, _ := nearestCentroid(vec[s*sub:(s+1)*sub], pq.Codebooks[s], MetricL2)
+		codes[s] = byte(best)
+	}
+
+	return codes
+}
+
+// Decode reconstructs the approximate vector for a set of codes
+func (pq *ProductQuantizer) Decode(codes []byte) []float32 {
+	sub := pq.subDim()
+	vec := make([]float32, 0, pq.Dim)
+
+	for s, c := range codes {
+		vec = append(vec, pq.Codebooks[s][c][:sub]...)
+	}
+
+	return vec
+}
+
+// lookupTable precomputes, for every subspace and codeword, the partial
+// score against the query: dot products for cosine and inner product,
+// squared distances for L2. Scoring a code is then M table lookups (ADC).
+func (pq *ProductQuantizer) lookupTable(query []float32, metric Metric) [][]float32 {
+	sub := pq.subDim()
+	table := make([][]float32, pq.M)
+
+	for s := 0; s < pq.M; s++ {
+		q := query[s*sub : (s+1)*sub]
+		table[s] = make([]float32, len(pq.Codebooks[s]))
+
+		for c, codeword := range pq.Codebooks[s] {
+			if metric == MetricL2 {
+				d := L2Distance(q, codeword)
+				table[s][c] = d * d
+			} else {
+				table[s][c] = Dot(q, codeword)
+			}
+		}
+	}
+
+	return table
+}
+
+// adcScore turns table lookups into a Result.Score for the metric.
+// norm is the magnitude of the reconstructed vector, cached at encode time.
+func adcScore(table [][]float32, codes []byte, metric Metric, queryNorm float32, norm float32) float32 {
+	var sum float32
+	for s, c := range codes {
+		sum += table[s][c]
+	}
+
+	switch metric {
+	case MetricInnerProduct:
+		return sum
+	case MetricL2:
+		return float32(math.Sqrt(float64(sum)))
+	default:
+		if queryNorm == 0 || norm == 0 {
+			return 0
+		}
+		return sum / (queryNorm * norm)
+	}
+}
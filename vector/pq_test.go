@@ -0,0 +1,249 @@
+package vector
+
+import (
+	"bytes"
+	"fmt"
+	"math/rand"
+	"testing"
+)
+
+func TestProductQuantizerRoundTrip(t *testing.T) {
+	rng := rand.New(rand.NewSource(21))
+	samples := clusteredVectors(3000, 32, 16, rng)
+
+	pq, err := TrainProductQuantizer(samples, 8, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if pq.BytesPerVector() != 8 {
+		t.Fatalf("expected 8 bytes per vector, got %d", pq.BytesPerVector())
+	}
+
+	// reconstruction should stay much closer than a random vector would
+	var errSum, baseSum float32
+	for i := 0; i < 200; i++ {
+		vec := samples[i]
+		errSum += L2Distance(vec, pq.Decode(pq.Encode(vec)))
+		baseSum += L2Distance(vec, samples[(i+1000)%len(samples)])
+	}
+
+	t.Logf("mean reconstruction error %.3f vs %.3f between samples", errSum/200, baseSum/200)
+
+	if errSum*4 > baseSum {
+		t.Errorf("pq reconstruction error too high (%.3f vs %.3f)", errSum/200, baseSum/200)
+	}
+
+	if _, err := TrainProductQuantizer(samples, 5, 10); err == nil {
+		t.Errorf("expected error when subspaces do not divide the dimension")
+	}
+}
+
+func TestIVFPQRecall(t *testing.T) {
+	rng := rand.New(rand.NewSource(22))
+	dim := 64
+	data := clusteredVectors(10000, dim, 32, rng)
+
+	centroids := TrainKMeans(data[:5000], KMeansConfig{K: 16, Seed: 1})
+	pq, err := TrainProductQuantizer(data[:5000], 16, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	bruteForce := NewIndex()
+	ivfpq := NewIVFPQIndex(RandomCentroids(1, dim), 16, 4, MetricCosine)
+
+	raw := make(map[string][]byte, len(data))
+	originals := make(map[string][]float32, len(data))
+	for i, v := range data {
+		id := fmt.Sprintf("vec-%d", i)
+		bruteForce.Add(id, v)
+		originals[id] = v
+		raw[id] = vectorToBytesTest(v)
+	}
+
+	// untrained: brute force over raw vectors
+	ivfpq.RebuildFromData(raw)
+	if ivfpq.Trained() {
+		t.Fatalf("index should not be trained yet")
+	}
+
+	if err := ivfpq.Retrain(centroids, pq, raw); err != nil {
+		t.Fatal(err)
+	}
+
+	plain, rescored := 0.0, 0.0
+	numQueries, k := 50, 10
+
+	for q := 0; q < numQueries; q++ {
+		query := data[rng.Intn(len(data))]
+
+		truth := make(map[string]bool)
+		for _, r := range bruteForce.Search(query, k, nil) {
+			truth[r.ID] = true
+		}
+
+		for _, r := range ivfpq.Search(query, k, nil) {
+			if truth[r.ID] {
+				plain++
+			}
+		}
+
+		candidates := ivfpq.Search(query, k*10, nil)
+		for _, r := range Rescore(query, candidates, k, MetricCosine, func(id string) []float32 { return originals[id] }) {
+			if truth[r.ID] {
+				rescored++
+			}
+		}
+	}
+
+	plain /= float64(numQueries * k)
+	rescored /= float64(numQueries * k)
+	t.Logf("IVF-PQ recall %.2f%%, with rescoring %.2f%%", plain*100, rescored*100)
+
+	if rescored < 0.9 {
+		t.Errorf("IVF-PQ recall with rescoring too low (%.2f%%)", rescored*100)
+	}
+}
+
+func TestIVFPQStateRestore(t *testing.T) {
+	rng := rand.New(rand.NewSource(23))
+	dim := 16
+	data := clusteredVectors(1000, dim, 4, rng)
+
+	pq, err := TrainProductQuantizer(data, 4, 5)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	raw := make(map[string][]byte)
+	for i, v := range data {
+		raw[fmt.Sprintf("vec-%d", i)] = vectorToBytesTest(v)
+	}
+
+	trained := NewIVFPQIndex(RandomCentroids(1, dim), 4, 2, MetricL2)
+	if err := trained.Retrain(TrainKMeans(data, KMeansConfig{K: 4, Seed: 2, Metric: MetricL2}), pq, raw); err != nil {
+		t.Fatal(err)
+	}
+
+	restored := NewIVFPQIndex(RandomCentroids(1, dim), 4, 2, MetricL2)
+	if err := restored.Restore(trained.State()); err != nil {
+		t.Fatal(err)
+	}
+	restored.RebuildFromData(raw)
+
+	query := data[17]
+	a := trained.Search(query, 5, nil)
+	b := restored.Search(query, 5, nil)
+
+	if len(a) != len(b) {
+		t.Fatalf("restored index returned %d results, want %d", len(b), len(a))
+	}
+	for i := range a {
+		if a[i].ID != b[i].ID {
+			t.Fatalf("restored index ranking differs: %v vs %v", b, a)
+		}
+	}
+}
+
+func TestIVFPQReAddReplacesEntry(t *testing.T) {
+	rng := rand.New(rand.NewSource(24))
+	dim := 16
+	data := clusteredVectors(1000, dim, 4, rng)
+
+	pq, err := TrainProductQuantizer(data, 4, 5)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ivfpq := NewIVFPQIndex(RandomCentroids(1, dim), 4, 4, MetricCosine)
+	if err := ivfpq.Retrain(TrainKMeans(data, KMeansConfig{K: 4, Seed: 1}), pq, nil); err != nil {
+		t.Fatal(err)
+	}
+	ivfpq.SetProbes(4)
+	for i, v := range data {
+		ivfpq.Add(fmt.Sprintf("vec-%d", i), v)
+	}
+
+	// move every vector, most of them to another list, then drop half
+	for i := range data {
+		ivfpq.Add(fmt.Sprintf("vec-%d", i), data[(i+500)%len(data)])
+	}
+	for i := 0; i < len(data); i += 2 {
+		ivfpq.Remove(fmt.Sprintf("vec-%d", i))
+	}
+
+	seen := make(map[string]int)
+	for _, r := range ivfpq.Search(data[0], len(data)*2, nil) {
+		seen[r.ID]++
+	}
+	if len(seen) != len(data)/2 {
+		t.Fatalf("expected %d ids, got %d", len(data)/2, len(seen))
+	}
+	for id, n := range seen {
+		if n != 1 {
+			t.Fatalf("%s returned %d times", id, n)
+		}
+	}
+
+	// the swapped-out entries do not come back through a snapshot either
+	var buf bytes.Buffer
+	if err := ivfpq.SaveState(&buf); err != nil {
+		t.Fatal(err)
+	}
+	restored := NewIVFPQIndex(RandomCentroids(1, dim), 4, 4, MetricCosine)
+	if err := restored.LoadState(&buf); err != nil {
+		t.Fatal(err)
+	}
+	if got := len(restored.Search(data[0], len(data)*2, nil)); got != len(data)/2 {
+		t.Fatalf("expected %d results after restore, got %d", len(data)/2, got)
+	}
+}
+
+func TestIVFPQRetrainReplaysWritesSinceBegin(t *testing.T) {
+	rng := rand.New(rand.NewSource(25))
+	dim := 16
+	data := clusteredVectors(500, dim, 4, rng)
+
+	pq, err := TrainProductQuantizer(data, 4, 5)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ivfpq := NewIVFPQIndex(RandomCentroids(1, dim), 4, 4, MetricCosine)
+	raw := make(map[string][]byte)
+	for i, v := range data[:400] {
+		id := fmt.Sprintf("vec-%d", i)
+		ivfpq.Add(id, v)
+		raw[id] = vectorToBytesTest(v)
+	}
+
+	// the copy is taken after BeginRetrain, then written to before the
+	// swap; on first training the raw vectors those writes went to are
+	// dropped, so only the replay keeps them
+	if err := ivfpq.BeginRetrain(); err != nil {
+		t.Fatal(err)
+	}
+	if err := ivfpq.BeginRetrain(); err != ErrRetrainInProgress {
+		t.Fatalf("expected a second BeginRetrain to fail, got %v", err)
+	}
+	for i, v := range data[400:] {
+		ivfpq.Add(fmt.Sprintf("vec-%d", 400+i), v)
+	}
+	for i := 0; i < 100; i++ {
+		ivfpq.Remove(fmt.Sprintf("vec-%d", i))
+	}
+
+	if err := ivfpq.FinishRetrain(TrainKMeans(data, KMeansConfig{K: 4, Seed: 1}), pq, raw); err != nil {
+		t.Fatal(err)
+	}
+	ivfpq.SetProbes(4)
+
+	seen := make(map[string]bool)
+	for _, r := range ivfpq.Search(data[0], len(data), nil) {
+		seen[r.ID] = true
+	}
+	if len(seen) != 400 || seen["vec-0"] || !seen["vec-499"] {
+		t.Fatalf("expected vec-100 to vec-499 after the swap, got %d ids", len(seen))
+	}
+}
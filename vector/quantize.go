@@ -46,6 +46,7 @@ func Quantize(vec []float32) QuantizedVector{
 	return QuantizedVector{
 	values : qvals,
 	scale : scale,
+	norm : quantizedNorm(qvals,scale),
 }
 
 }
@@ -3,6 +3,7 @@ package vector
 type QuantizedVector struct{
 	values []int8
 	scale float32
+	norm float32 // magnitude of the dequantized vector, precomputed for scoring
 	id string
 }
 
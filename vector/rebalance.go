@@ -0,0 +1,335 @@
+package vector
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"slices"
+	"time"
+)
+
+// RebalanceConfig controls when IVF lists are split or merged.
+type RebalanceConfig struct {
+	MaxImbalance float64       // split lists holding more than this multiple of the mean list size
+	MaxListSize  int           // split lists larger than this regardless of the mean; 0 disables
+	MinListSize  int           // merge lists smaller than this into their nearest neighbours
+	Interval     time.Duration // how often the background loop checks list sizes
+	Seed         int64         // seeds the 2-means splits, so the same lists split the same way
+}
+
+// maxSplitSample caps how many vectors of an oversized list 2-means sees
+const maxSplitSample = 2000
+
+// maxPredictSample caps the vectors, over all lists, that planRebalance
+// uses to predict the list sizes of a plan, besides those of oversized lists
+const maxPredictSample = 10000
+
+// DefaultRebalanceConfig also caps lists at an absolute size: an index
+// started from a couple of random centroids holds lists that are all large
+// but about equal, which MaxImbalance alone would never split
+func DefaultRebalanceConfig() RebalanceConfig {
+	return RebalanceConfig{
+		MaxImbalance: 3,
+		MaxListSize:  1024,
+		MinListSize:  16,
+		Interval:     30 * time.Second,
+		Seed:         1,
+	}
+}
+
+// withDefaults fills in zero fields from DefaultRebalanceConfig
+func (cfg RebalanceConfig) withDefaults() RebalanceConfig {
+	def := DefaultRebalanceConfig()
+
+	if cfg.MaxImbalance <= 1 {
+		cfg.MaxImbalance = def.MaxImbalance
+	}
+
+	if cfg.Interval <= 0 {
+		cfg.Interval = def.Interval
+	}
+
+	if cfg.Seed == 0 {
+		cfg.Seed = def.Seed
+	}
+
+	return cfg
+}
+
+// ListSizes returns the number of vectors in each inverted list, indexed by centroid
+func (ivf *IVFIndex) ListSizes() []int {
+	ivf.mu.RLock()
+	defer ivf.mu.RUnlock()
+
+	return ivf.listSizesLocked()
+}
+
+// listSizesLocked counts live entries, leaving out tombstones. Caller
+// holds the lock.
+func (ivf *IVFIndex) listSizesLocked() []int {
+	sizes := make([]int, len(ivf.centroids))
+	for i := range ivf.centroids {
+		sizes[i] = len(ivf.lists[i]) - ivf.dead[i]
+	}
+
+	return sizes
+}
+
+// Imbalance is the size of the largest list divided by the mean list size;
+// 1 means perfectly even lists
+func (ivf *IVFIndex) Imbalance() float64 {
+	return imbalance(ivf.ListSizes())
+}
+
+func imbalance(sizes []int) float64 {
+	total, largest := 0, 0
+	for _, n := range sizes {
+		total += n
+		if n > largest {
+			largest = n
+		}
+	}
+
+	if total == 0 {
+		return 1
+	}
+
+	return float64(largest) / (float64(total) / float64(len(sizes)))
+}
+
+// skew is how far the largest list is over the size lists should have:
+// the mean, or cfg.MaxListSize when the mean is above it. Below the cap it
+// is the imbalance; above it, lists that are even but too large still
+// have room to improve.
+func (cfg RebalanceConfig) skew(sizes []int) float64 {
+	total, largest := 0, 0
+	for _, n := range sizes {
+		total += n
+		largest = max(largest, n)
+	}
+
+	if total == 0 {
+		return 1
+	}
+
+	target := float64(total) / float64(len(sizes))
+	if cfg.MaxListSize > 0 && target > float64(cfg.MaxListSize) {
+		target = float64(cfg.MaxListSize)
+	}
+
+	return float64(largest) / target
+}
+
+// Rebalance splits oversized lists in two with 2-means and drops centroids of
+// tiny lists, then retrains the index with the resulting centroid set. It
+// reports whether anything changed: a plan whose reassigned lists do not
+// lower the skew of the current ones is discarded. Searches keep running
+// against the old lists until the new ones are swapped in.
+func (ivf *IVFIndex) Rebalance(cfg RebalanceConfig) (bool, error) {
+	cfg = cfg.withDefaults()
+
+	centroids, changed := ivf.planRebalance(cfg)
+	if !changed {
+		return false, nil
+	}
+
+	before := cfg.skew(ivf.ListSizes())
+	return ivf.retrain(centroids, func(sizes []int) bool {
+		return cfg.skew(sizes) < before
+	})
+}
+
+// planRebalance picks the centroids Rebalance retrains with. A split can
+// pull vectors out of neighbouring lists and leave a new list as large as
+// the one it split, so the sizes a plan leads to are predicted from samples
+// of every list, and the largest predicted list is split in turn until the
+// plan lowers the skew of the current lists.
+func (ivf *IVFIndex) planRebalance(cfg RebalanceConfig) ([][]float32, bool) {
+	ivf.mu.RLock()
+	old := ivf.centroids
+	sizes := ivf.listSizesLocked()
+	total := 0
+	for _, size := range sizes {
+		total += size
+	}
+
+	if total == 0 {
+		ivf.mu.RUnlock()
+		return nil, false
+	}
+
+	mean := float64(total) / float64(len(old))
+	oversized := func(size int) bool {
+		return float64(size) > cfg.MaxImbalance*mean ||
+			(cfg.MaxListSize > 0 && size > cfg.MaxListSize)
+	}
+
+	// removal tombstones entries inside the list slices once the lock is
+	// released, so lists are sampled into dequantized copies while it is
+	// held and 2-means runs on the copies afterwards
+	perList := max(maxPredictSample/len(old), 1)
+	samples := make([][][]float32, len(old))
+	for i, size := range sizes {
+		limit := perList
+		if oversized(size) {
+			limit = maxSplitSample
+		}
+		samples[i] = sampleList(ivf.lists[i], size, limit)
+	}
+	ivf.mu.RUnlock()
+
+	centroids := make([][]float32, 0, len(old)+1)
+	changed := false
+
+	for i, size := range sizes {
+		if oversized(size) {
+			if halves, ok := splitList(samples[i], ivf.metric, cfg.Seed); ok {
+				centroids = append(centroids, halves...)
+				changed = true
+				continue
+			}
+		}
+
+		// a list is only tiny relative to the others, so a small index is
+		// never merged down to a single list
+		tiny := size < cfg.MinListSize && float64(size) < mean/cfg.MaxImbalance
+		if tiny && len(old) > 1 {
+			changed = true
+			continue
+		}
+
+		centroids = append(centroids, old[i])
+	}
+
+	if !changed || len(centroids) == 0 {
+		return nil, false
+	}
+
+	before := cfg.skew(sizes)
+	for extra := 0; ; extra++ {
+		predicted, members := predictSizes(samples, sizes, centroids, ivf.metric)
+		if cfg.skew(predicted) < before {
+			return centroids, true
+		}
+		if extra == len(old) {
+			return nil, false
+		}
+
+		largest := 0
+		for c, n := range predicted {
+			if n > predicted[largest] {
+				largest = c
+			}
+		}
+
+		halves, ok := splitList(members[largest], ivf.metric, cfg.Seed)
+		if !ok {
+			return nil, false
+		}
+		centroids = slices.Replace(centroids, largest, largest+1, halves...)
+	}
+}
+
+// predictSizes assigns every sample to its nearest centroid, each standing
+// in for its share of the list it was drawn from. It returns the estimated
+// list sizes and the samples each centroid would get.
+func predictSizes(samples [][][]float32, sizes []int, centroids [][]float32, metric Metric) ([]int, [][][]float32) {
+	weights := make([]float64, len(centroids))
+	members := make([][][]float32, len(centroids))
+
+	for i, points := range samples {
+		if len(points) == 0 {
+			continue
+		}
+		weight := float64(sizes[i]) / float64(len(points))
+		for _, p := range points {
+			c, _ := nearestCentroid(p, centroids, metric)
+			weights[c] += weight
+			members[c] = append(members[c], p)
+		}
+	}
+
+	predicted := make([]int, len(centroids))
+	for c, w := range weights {
+		predicted[c] = int(math.Round(w))
+	}
+
+	return predicted, members
+}
+
+// sampleList dequantizes up to limit live vectors spread evenly over a list
+// holding size of them
+func sampleList(list []QuantizedVector, size int, limit int) [][]float32 {
+	step := 1
+	if size > limit {
+		step = size / limit
+	}
+
+	samples := make([][]float32, 0, min(size, limit))
+	live := 0
+	for _, qv := range list {
+		if qv.values == nil {
+			continue
+		}
+		if live%step == 0 && len(samples) < limit {
+			samples = append(samples, Dequantize(qv))
+		}
+		live++
+	}
+
+	return samples
+}
+
+// splitList runs 2-means over a sample of a list and returns the two new
+// centroids. The split is rejected when one side would keep almost
+// everything, e.g. for a list of duplicates, so the same list is not split
+// again on every check.
+func splitList(samples [][]float32, metric Metric, seed int64) ([][]float32, bool) {
+	if len(samples) < 2 {
+		return nil, false
+	}
+
+	halves := TrainKMeans(samples, KMeansConfig{K: 2, MaxIter: 10, Seed: seed, Metric: metric})
+	if len(halves) < 2 {
+		return nil, false
+	}
+
+	counts := [2]int{}
+	for _, s := range samples {
+		c, _ := nearestCentroid(s, halves, metric)
+		counts[c]++
+	}
+
+	smaller := counts[0]
+	if counts[1] < smaller {
+		smaller = counts[1]
+	}
+
+	if smaller*10 < len(samples) {
+		return nil, false
+	}
+
+	return halves, true
+}
+
+// StartAutoRebalance checks list sizes every cfg.Interval and rebalances
+// once they drift past the configured limits. It stops when ctx is done.
+func (ivf *IVFIndex) StartAutoRebalance(ctx context.Context, cfg RebalanceConfig) {
+	cfg = cfg.withDefaults()
+
+	go func() {
+		ticker := time.NewTicker(cfg.Interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ticker.C:
+				if _, err := ivf.Rebalance(cfg); err != nil && err != ErrRetrainInProgress {
+					fmt.Printf("Error rebalancing IVF index: %v\n", err)
+				}
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+}
@@ -0,0 +1,119 @@
+package vector
+
+import (
+	"fmt"
+	"math/rand"
+	"sync"
+	"testing"
+)
+
+func TestRebalanceSplitsSkewedLists(t *testing.T) {
+	rng := rand.New(rand.NewSource(5))
+	dim := 16
+
+	// 4 centroids trained on one topic, then a burst from new topics
+	// lands almost entirely in a single list
+	initial := clusteredVectors(400, dim, 4, rng)
+	ivf := NewIVFIndex(TrainKMeans(initial, KMeansConfig{K: 4, Seed: 1}), 2)
+
+	for i, v := range initial {
+		ivf.Add(fmt.Sprintf("a-%d", i), v)
+	}
+	for i, v := range clusteredVectors(4000, dim, 6, rng) {
+		ivf.Add(fmt.Sprintf("b-%d", i), v)
+	}
+
+	before := ivf.Imbalance()
+
+	cfg := RebalanceConfig{MaxImbalance: 1.5, MinListSize: 16}
+	for round := 0; round < 5; round++ {
+		changed, err := ivf.Rebalance(cfg)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !changed {
+			break
+		}
+	}
+
+	after := ivf.Imbalance()
+	t.Logf("imbalance before %.2f, after %.2f, lists %d", before, after, len(ivf.ListSizes()))
+
+	if after >= before {
+		t.Errorf("rebalance did not reduce imbalance (%.2f -> %.2f)", before, after)
+	}
+
+	total := 0
+	for _, n := range ivf.ListSizes() {
+		total += n
+	}
+	if total != 4400 {
+		t.Fatalf("expected 4400 vectors after rebalance, got %d", total)
+	}
+}
+
+func TestRebalanceMergesTinyLists(t *testing.T) {
+	dim := 8
+	centroids := make([][]float32, 3)
+	for i := range centroids {
+		centroids[i] = make([]float32, dim)
+		centroids[i][i] = 1
+	}
+	ivf := NewIVFIndex(centroids, 1)
+
+	for i := 0; i < 200; i++ {
+		vec := make([]float32, dim)
+		vec[i%2] = 1
+		ivf.Add(fmt.Sprintf("vec-%d", i), vec)
+	}
+	tiny := make([]float32, dim)
+	tiny[2] = 1
+	ivf.Add("tiny", tiny)
+
+	changed, err := ivf.Rebalance(RebalanceConfig{MaxImbalance: 3, MinListSize: 16})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !changed || len(ivf.ListSizes()) != 2 {
+		t.Fatalf("expected the tiny list to be merged, lists: %v", ivf.ListSizes())
+	}
+
+	results := ivf.Search(tiny, 1, func(id string) bool { return id == "tiny" })
+	if len(results) != 1 {
+		t.Fatalf("vector from merged list was lost")
+	}
+}
+
+func TestSearchDuringRebalance(t *testing.T) {
+	rng := rand.New(rand.NewSource(6))
+	dim := 16
+	data := clusteredVectors(3000, dim, 8, rng)
+
+	ivf := NewIVFIndex(RandomCentroids(2, dim), 2)
+	for i, v := range data {
+		ivf.Add(fmt.Sprintf("vec-%d", i), v)
+	}
+
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for round := 0; round < 3; round++ {
+			if _, err := ivf.Rebalance(RebalanceConfig{MaxImbalance: 1.2, MaxListSize: 500}); err != nil {
+				t.Error(err)
+			}
+		}
+	}()
+
+	// probing every list must always find the exact vector, old lists or new
+	for i := 0; i < 200; i++ {
+		q := rng.Intn(len(data))
+		ivf.SetProbes(1 << 20)
+		results := ivf.Search(data[q], 1, nil)
+		if len(results) != 1 || results[0].Score < 0.99 {
+			t.Fatalf("search during rebalance returned %v", results)
+		}
+	}
+
+	wg.Wait()
+}
@@ -0,0 +1,101 @@
+package vector
+
+import (
+	"fmt"
+	"math/rand"
+	"testing"
+)
+
+func TestIVFRemoveTombstonesAndCompacts(t *testing.T) {
+	rng := rand.New(rand.NewSource(7))
+	dim := 8
+	data := clusteredVectors(1000, dim, 4, rng)
+
+	ivf := NewIVFIndex(TrainKMeans(data, KMeansConfig{K: 4, Seed: 2}), 4)
+	for i, v := range data {
+		ivf.Add(fmt.Sprintf("vec-%d", i), v)
+	}
+
+	// upserting an id replaces its entry instead of adding a second one
+	ivf.Add("vec-0", data[1])
+
+	for i := 1; i < 600; i++ {
+		ivf.Remove(fmt.Sprintf("vec-%d", i))
+	}
+	ivf.Remove("missing")
+
+	total, stored := 0, 0
+	for c, size := range ivf.ListSizes() {
+		total += size
+		stored += len(ivf.lists[c])
+
+		// compaction keeps tombstones under half of every list
+		if dead := ivf.dead[c]; dead*2 >= len(ivf.lists[c]) && dead > 0 {
+			t.Fatalf("list %d has %d tombstones out of %d", c, dead, len(ivf.lists[c]))
+		}
+	}
+	if total != 401 || len(ivf.slots) != 401 {
+		t.Fatalf("expected 401 live vectors, got %d (%d slots)", total, len(ivf.slots))
+	}
+	if stored >= 2*total {
+		t.Fatalf("expected compaction to drop tombstones, %d entries for %d vectors", stored, total)
+	}
+
+	results := ivf.Search(data[700], 1000, nil)
+	if len(results) != 401 {
+		t.Fatalf("expected every live vector and no tombstones, got %d results", len(results))
+	}
+	for _, r := range results {
+		if r.ID == "vec-5" {
+			t.Fatalf("removed vector returned")
+		}
+	}
+}
+
+func TestFlatRemove(t *testing.T) {
+	idx := NewIndex()
+	for i := 0; i < 10; i++ {
+		idx.Add(fmt.Sprintf("vec-%d", i), []float32{float32(i) + 1, 1})
+	}
+
+	idx.Add("vec-9", []float32{1, 100})
+	idx.Remove("vec-0")
+	idx.Remove("vec-4")
+	idx.Remove("missing")
+
+	results := idx.Search([]float32{1, 100}, 20, nil)
+	if len(results) != 8 {
+		t.Fatalf("expected 8 vectors, got %d", len(results))
+	}
+	if results[0].ID != "vec-9" {
+		t.Fatalf("expected the upserted vector first, got %s", results[0].ID)
+	}
+
+	for id, i := range idx.positions {
+		if idx.vectors[i].ID != id {
+			t.Fatalf("position of %s points at %s", id, idx.vectors[i].ID)
+		}
+	}
+}
+
+func BenchmarkIVFUpsert(b *testing.B) {
+	for _, size := range []int{1000, 10000, 100000} {
+		b.Run(fmt.Sprint(size), func(b *testing.B) {
+			rng := rand.New(rand.NewSource(1))
+			dim := 16
+			data := clusteredVectors(size, dim, 8, rng)
+
+			ivf := NewIVFIndex(TrainKMeans(data[:1000], KMeansConfig{K: 8, Seed: 1}), 2)
+			for i, v := range data {
+				ivf.Add(fmt.Sprintf("vec-%d", i), v)
+			}
+
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				id := fmt.Sprintf("vec-%d", i%size)
+				ivf.Remove(id)
+				ivf.Add(id, data[(i+1)%size])
+			}
+		})
+	}
+}
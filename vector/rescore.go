@@ -0,0 +1,28 @@
+package vector
+
+// Rescore re-ranks approximate candidates against their full-precision
+// vectors and returns the best k. lookup returns the original float32 vector
+// for an id, or nil if it is gone; such candidates are dropped.
+func Rescore(query []float32, candidates []Result, k int, metric Metric, lookup func(id string) []float32) []Result {
+	results := make([]Result, 0, len(candidates))
+
+	for _, c := range candidates {
+		vec := lookup(c.ID)
+		if len(vec) != len(query) {
+			continue
+		}
+
+		results = append(results, Result{
+			ID:    c.ID,
+			Score: metric.Score(query, vec),
+		})
+	}
+
+	SortResults(results, metric)
+
+	if len(results) > k {
+		return results[:k]
+	}
+
+	return results
+}
@@ -36,3 +36,15 @@ func CosineSimilarity(a,b []float32) float32{
 
 
 
+
+
+func L2Distance(a,b []float32) float32{
+	var sum float32 = 0
+
+	for i := 0;i<len(a);i++{
+		d := a[i]-b[i]
+		sum += d*d
+	}
+
+	return float32(math.Sqrt(float64(sum)))
+}
@@ -0,0 +1,264 @@
+package wal
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+
+	"flashvector/metadata"
+)
+
+// Record framing on disk:
+//
+//	crc    uint32  CRC-32C of the body
+//	length uint32  body bytes
+//	body:
+//	  lsn   uint64
+//	  op    uint8
+//	  key   uvarint length + bytes
+//	  value uvarint length + bytes
+//	  meta  uvarint count, then key/value pairs as above; each value is a
+//	        typed metadata.Value in its binary form
+//	  text  uvarint length + bytes; absent in records from before documents
+//	        had text, which read back as ""
+//
+// Records from before metadata had types stored plain strings as values.
+// Typed records set opTyped in the op byte, so the two still read apart.
+//
+// A batch record (OpBatch) has no key, value, metadata or text of its own;
+// after the op byte comes a uvarint entry count and then, per entry, the op
+// byte, key, value, metadata and text as above (text always present). The
+// whole batch shares one LSN and one checksum, so it is replayed entirely
+// or not at all; opTyped is set on the batch's op byte, not its entries'.
+//
+// All fixed-width integers are little-endian.
+const (
+	recordHeaderSize = 8
+	maxRecordSize    = 1 << 30
+)
+
+// Op is the kind of mutation a record logs
+type Op uint8
+
+const (
+	OpSet    Op = 1
+	OpDelete Op = 2
+	OpBatch  Op = 3
+
+	// opTyped flags the on-disk op byte of records whose metadata values
+	// are typed; it is never part of Record.Op
+	opTyped = 0x80
+)
+
+var crcTable = crc32.MakeTable(crc32.Castagnoli)
+
+// errTornRecord marks a record that is incomplete or fails its checksum
+var errTornRecord = errors.New("torn or corrupt wal record")
+
+// Record is one logged mutation
+type Record struct {
+	LSN      uint64
+	Op       Op
+	Key      string
+	Value    []byte
+	Metadata metadata.Map
+	// Text is the document text stored alongside the vector
+	Text string
+	// Batch holds the sets and deletes of an OpBatch record, in order;
+	// their LSN is unused
+	Batch []Record
+}
+
+func (r *Record) encode() ([]byte, error) {
+	size := 9 + len(r.Key) + len(r.Value) + len(r.Text) + 16
+	for _, e := range r.Batch {
+		size += 1 + len(e.Key) + len(e.Value) + len(e.Text) + 16
+	}
+
+	body := make([]byte, 0, size)
+	body = binary.LittleEndian.AppendUint64(body, r.LSN)
+	body = append(body, byte(r.Op)|opTyped)
+
+	var err error
+	if r.Op == OpBatch {
+		body = binary.AppendUvarint(body, uint64(len(r.Batch)))
+		for i := range r.Batch {
+			body = append(body, byte(r.Batch[i].Op))
+			if body, err = r.Batch[i].appendEntry(body); err != nil {
+				return nil, err
+			}
+		}
+	} else if body, err = r.appendEntry(body); err != nil {
+		return nil, err
+	}
+
+	buf := make([]byte, recordHeaderSize, recordHeaderSize+len(body))
+	binary.LittleEndian.PutUint32(buf[0:4], crc32.Checksum(body, crcTable))
+	binary.LittleEndian.PutUint32(buf[4:8], uint32(len(body)))
+
+	return append(buf, body...), nil
+}
+
+// appendEntry appends key, value, metadata and text
+func (r *Record) appendEntry(body []byte) ([]byte, error) {
+	body = appendBytes(body, []byte(r.Key))
+	body = appendBytes(body, r.Value)
+
+	body = binary.AppendUvarint(body, uint64(len(r.Metadata)))
+	for k, v := range r.Metadata {
+		value, err := v.MarshalBinary()
+		if err != nil {
+			return nil, fmt.Errorf("metadata %q: %w", k, err)
+		}
+		body = appendBytes(body, []byte(k))
+		body = appendBytes(body, value)
+	}
+
+	return appendBytes(body, []byte(r.Text)), nil
+}
+
+func appendBytes(b []byte, v []byte) []byte {
+	b = binary.AppendUvarint(b, uint64(len(v)))
+	return append(b, v...)
+}
+
+// readRecord reads the next record. It returns io.EOF at a clean end and
+// errTornRecord for anything short, oversized or failing its checksum.
+func readRecord(r io.Reader) (Record, int, error) {
+	var rec Record
+
+	header := make([]byte, recordHeaderSize)
+	n, err := io.ReadFull(r, header)
+	if err == io.EOF {
+		return rec, 0, io.EOF
+	}
+	if err != nil {
+		return rec, n, errTornRecord
+	}
+
+	length := binary.LittleEndian.Uint32(header[4:8])
+	if length < 9 || length > maxRecordSize {
+		return rec, n, errTornRecord
+	}
+
+	body := make([]byte, length)
+	m, err := io.ReadFull(r, body)
+	n += m
+	if err != nil {
+		return rec, n, errTornRecord
+	}
+
+	if crc32.Checksum(body, crcTable) != binary.LittleEndian.Uint32(header[0:4]) {
+		return rec, n, errTornRecord
+	}
+
+	if err := rec.decode(body); err != nil {
+		return rec, n, errTornRecord
+	}
+
+	return rec, n, nil
+}
+
+func (r *Record) decode(body []byte) error {
+	r.LSN = binary.LittleEndian.Uint64(body[0:8])
+	r.Op = Op(body[8] &^ opTyped)
+	typed := body[8]&opTyped != 0
+	body = body[9:]
+
+	if r.Op != OpBatch {
+		rest, err := r.decodeEntry(body, typed)
+		if err != nil || len(rest) == 0 {
+			return err
+		}
+
+		text, _, err := readBytes(rest)
+		r.Text = string(text)
+		return err
+	}
+
+	count, n := binary.Uvarint(body)
+	if n <= 0 || count > uint64(len(body)) {
+		return errTornRecord
+	}
+	body = body[n:]
+
+	r.Batch = make([]Record, count)
+	for i := range r.Batch {
+		if len(body) == 0 {
+			return errTornRecord
+		}
+		r.Batch[i].Op = Op(body[0])
+
+		var err error
+		if body, err = r.Batch[i].decodeEntry(body[1:], typed); err != nil {
+			return err
+		}
+
+		var text []byte
+		if text, body, err = readBytes(body); err != nil {
+			return err
+		}
+		r.Batch[i].Text = string(text)
+	}
+
+	return nil
+}
+
+// decodeEntry reads key, value and metadata, returning what follows them.
+// Text is read by the caller, since only batch entries always carry it.
+// Untyped metadata values read back as strings.
+func (r *Record) decodeEntry(body []byte, typed bool) ([]byte, error) {
+	key, body, err := readBytes(body)
+	if err != nil {
+		return nil, err
+	}
+	r.Key = string(key)
+
+	if r.Value, body, err = readBytes(body); err != nil {
+		return nil, err
+	}
+
+	count, n := binary.Uvarint(body)
+	if n <= 0 {
+		return nil, errTornRecord
+	}
+	body = body[n:]
+
+	if count > 0 {
+		r.Metadata = make(metadata.Map, count)
+	}
+
+	for i := uint64(0); i < count; i++ {
+		var k, v []byte
+		if k, body, err = readBytes(body); err != nil {
+			return nil, err
+		}
+		if v, body, err = readBytes(body); err != nil {
+			return nil, err
+		}
+		if !typed {
+			r.Metadata[string(k)] = metadata.StringValue(string(v))
+			continue
+		}
+
+		var value metadata.Value
+		if err := value.UnmarshalBinary(v); err != nil {
+			return nil, errTornRecord
+		}
+		r.Metadata[string(k)] = value
+	}
+
+	return body, nil
+}
+
+func readBytes(b []byte) ([]byte, []byte, error) {
+	length, n := binary.Uvarint(b)
+	if n <= 0 || uint64(len(b)-n) < length {
+		return nil, nil, errTornRecord
+	}
+
+	end := n + int(length)
+	return b[n:end], b[end:], nil
+}
@@ -0,0 +1,805 @@
+// Package wal is the store's write-ahead log.
+//
+// The log is a series of segment files. The active segment lives at the
+// path given to Open; when it reaches the size limit it is renamed to
+// <path>.<first LSN, 20 digits> and a new active segment is started. Every
+// record carries a monotonically increasing log sequence number (LSN) and a
+// CRC, so a record torn by a crash is detected and cut off when the log is
+// opened instead of failing recovery.
+package wal
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"flashvector/metadata"
+)
+
+const (
+	// DefaultSegmentSize is the size at which the active segment is rolled
+	DefaultSegmentSize = 64 << 20
+
+	segmentMagic      = "FVWL"
+	segmentVersion    = 1
+	segmentHeaderSize = 16 // magic, version uint32, first LSN uint64
+	segmentSuffixLen  = 20
+)
+
+var ErrNotSegment = errors.New("not a wal segment")
+
+// Applier receives records during Replay
+type Applier interface {
+	ApplySet(key string, value []byte, metadata metadata.Map, text string)
+	ApplyDelete(key string)
+}
+
+// SyncMode decides when appended records are fsynced, and so what a
+// writer has been promised once WaitDurable(lsn) returns
+type SyncMode int
+
+const (
+	// SyncPeriodic fsyncs in the background every SyncInterval. Writes are
+	// acknowledged once they reach the OS: they survive a process crash,
+	// but a power failure can lose up to SyncInterval of acknowledged writes.
+	SyncPeriodic SyncMode = iota
+	// SyncAlways fsyncs inside every append. Acknowledged writes are durable;
+	// throughput is one fsync per write.
+	SyncAlways
+	// SyncGroup lets concurrent writers share one fsync: the first waiter
+	// holds the sync open for GroupCommitWindow so others can join, then
+	// syncs everything appended so far. Acknowledged writes are durable.
+	SyncGroup
+)
+
+const (
+	DefaultSyncInterval      = time.Second
+	DefaultGroupCommitWindow = time.Millisecond
+)
+
+func (m SyncMode) String() string {
+	switch m {
+	case SyncAlways:
+		return "always"
+	case SyncGroup:
+		return "group"
+	default:
+		return "periodic"
+	}
+}
+
+// ParseSyncMode accepts the names used in configs
+func ParseSyncMode(name string) (SyncMode, error) {
+	switch strings.ToLower(strings.TrimSpace(name)) {
+	case "", "periodic":
+		return SyncPeriodic, nil
+	case "always":
+		return SyncAlways, nil
+	case "group":
+		return SyncGroup, nil
+	}
+
+	return SyncPeriodic, fmt.Errorf("unknown wal sync mode %q", name)
+}
+
+// Options tunes a WAL
+type Options struct {
+	// SegmentSize rolls the active segment once it holds this many bytes;
+	// 0 means DefaultSegmentSize
+	SegmentSize int64
+	// Sync is the durability mode; the zero value is SyncPeriodic
+	Sync SyncMode
+	// SyncInterval is the SyncPeriodic fsync interval; 0 means DefaultSyncInterval
+	SyncInterval time.Duration
+	// GroupCommitWindow is how long a SyncGroup leader waits for other
+	// writers before syncing; 0 means DefaultGroupCommitWindow
+	GroupCommitWindow time.Duration
+}
+
+type WAL struct {
+	mu       sync.Mutex
+	path     string
+	opts     Options
+	f        *os.File
+	size     int64  // bytes in the active segment, header included
+	firstLSN uint64 // LSN the active segment starts at
+	lastLSN  uint64 // last LSN written; firstLSN-1 while the segment is empty
+	failed   error  // set when a failed append could not be undone
+
+	// group commit state; never held while taking mu
+	syncMu    sync.Mutex
+	syncCond  *sync.Cond
+	syncing   bool   // a leader is syncing on behalf of waiters
+	syncedLSN uint64 // everything up to here is on stable storage
+
+	stop chan struct{} // stops the SyncPeriodic flusher
+	done chan struct{}
+}
+
+// segment is a rolled, read-only segment file
+type segment struct {
+	path  string
+	first uint64
+}
+
+// Open opens or creates the log at path with default options
+func Open(path string) (*WAL, error) {
+	return OpenWithOptions(path, Options{})
+}
+
+// OpenWithOptions opens or creates the log at path. A torn tail on the
+// active segment is truncated away.
+func OpenWithOptions(path string, opts Options) (*WAL, error) {
+	if opts.SegmentSize <= 0 {
+		opts.SegmentSize = DefaultSegmentSize
+	}
+	if opts.SyncInterval <= 0 {
+		opts.SyncInterval = DefaultSyncInterval
+	}
+	if opts.GroupCommitWindow <= 0 {
+		opts.GroupCommitWindow = DefaultGroupCommitWindow
+	}
+
+	w := &WAL{path: path, opts: opts}
+	w.syncCond = sync.NewCond(&w.syncMu)
+
+	rolled, err := w.rolledSegments()
+	if err != nil {
+		return nil, err
+	}
+
+	// where a fresh active segment would start
+	next := uint64(1)
+	if len(rolled) > 0 {
+		newest := rolled[len(rolled)-1]
+		last, err := lastLSNIn(newest.path, newest.first)
+		if err != nil {
+			return nil, err
+		}
+		next = last + 1
+	}
+
+	if err := w.openActive(next); err != nil {
+		return nil, err
+	}
+
+	// everything found on disk was synced by openActive or when it was rolled
+	w.syncedLSN = w.lastLSN
+
+	if opts.Sync == SyncPeriodic {
+		w.stop = make(chan struct{})
+		w.done = make(chan struct{})
+		go w.flushPeriodically()
+	}
+
+	return w, nil
+}
+
+func (w *WAL) flushPeriodically() {
+	defer close(w.done)
+
+	ticker := time.NewTicker(w.opts.SyncInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-w.stop:
+			return
+		case <-ticker.C:
+			if err := w.Sync(); err != nil && !errors.Is(err, os.ErrClosed) {
+				fmt.Printf("wal: periodic sync failed: %v\n", err)
+			}
+		}
+	}
+}
+
+// openActive opens the active segment, repairing a torn tail, or creates
+// it starting at next
+func (w *WAL) openActive(next uint64) error {
+	f, err := os.OpenFile(w.path, os.O_CREATE|os.O_RDWR, 0644)
+	if err != nil {
+		return err
+	}
+
+	info, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return err
+	}
+
+	if info.Size() < segmentHeaderSize {
+		// new, or crashed before the header was written
+		if err := writeSegmentHeader(f, next); err != nil {
+			f.Close()
+			return err
+		}
+		w.f, w.size, w.firstLSN, w.lastLSN = f, segmentHeaderSize, next, next-1
+		return nil
+	}
+
+	first, err := readSegmentHeader(f)
+	if err != nil {
+		f.Close()
+		return fmt.Errorf("%s: %w", w.path, err)
+	}
+
+	last := first - 1
+	offset := int64(segmentHeaderSize)
+	r := bufio.NewReader(f)
+
+	for {
+		rec, n, err := readRecord(r)
+		if err == io.EOF {
+			break
+		}
+		if err != nil || rec.LSN != last+1 {
+			// everything from here on was never acknowledged as a whole
+			fmt.Printf("wal: truncating torn tail of %s at offset %d\n", w.path, offset)
+			if err := f.Truncate(offset); err != nil {
+				f.Close()
+				return err
+			}
+			if err := f.Sync(); err != nil {
+				f.Close()
+				return err
+			}
+			break
+		}
+
+		last = rec.LSN
+		offset += int64(n)
+	}
+
+	if _, err := f.Seek(offset, io.SeekStart); err != nil {
+		f.Close()
+		return err
+	}
+
+	w.f, w.size, w.firstLSN, w.lastLSN = f, offset, first, last
+	return nil
+}
+
+func writeSegmentHeader(f *os.File, first uint64) error {
+	if err := f.Truncate(0); err != nil {
+		return err
+	}
+
+	header := make([]byte, segmentHeaderSize)
+	copy(header[0:4], segmentMagic)
+	binary.LittleEndian.PutUint32(header[4:8], segmentVersion)
+	binary.LittleEndian.PutUint64(header[8:16], first)
+
+	if _, err := f.WriteAt(header, 0); err != nil {
+		return err
+	}
+	if _, err := f.Seek(segmentHeaderSize, io.SeekStart); err != nil {
+		return err
+	}
+
+	return f.Sync()
+}
+
+func readSegmentHeader(r io.Reader) (uint64, error) {
+	header := make([]byte, segmentHeaderSize)
+	if _, err := io.ReadFull(r, header); err != nil {
+		return 0, ErrNotSegment
+	}
+
+	if string(header[0:4]) != segmentMagic {
+		return 0, ErrNotSegment
+	}
+	if v := binary.LittleEndian.Uint32(header[4:8]); v != segmentVersion {
+		return 0, fmt.Errorf("unsupported wal segment version %d", v)
+	}
+
+	first := binary.LittleEndian.Uint64(header[8:16])
+	if first == 0 {
+		return 0, ErrNotSegment
+	}
+
+	return first, nil
+}
+
+// IsSegment reports whether the file at path starts with a segment header.
+// Logs written before the segmented format start straight with records.
+func IsSegment(path string) (bool, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return false, err
+	}
+	defer f.Close()
+
+	_, err = readSegmentHeader(f)
+	if errors.Is(err, ErrNotSegment) {
+		return false, nil
+	}
+
+	return err == nil, err
+}
+
+// lastLSNIn scans a rolled segment for its last LSN
+func lastLSNIn(path string, first uint64) (uint64, error) {
+	last := first - 1
+
+	err := readSegment(path, func(rec Record) {
+		last = rec.LSN
+	})
+
+	return last, err
+}
+
+// readSegment calls fn for every record in a rolled segment. Rolled
+// segments were synced before they were renamed, so any damage is reported.
+func readSegment(path string, fn func(rec Record)) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	r := bufio.NewReader(f)
+	first, err := readSegmentHeader(r)
+	if err != nil {
+		return fmt.Errorf("%s: %w", path, err)
+	}
+
+	expect := first
+	for {
+		rec, _, err := readRecord(r)
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil || rec.LSN != expect {
+			return fmt.Errorf("%s: corrupt record after lsn %d", path, expect-1)
+		}
+
+		fn(rec)
+		expect++
+	}
+}
+
+// rolledSegments lists <path>.<first LSN> files, oldest first
+func (w *WAL) rolledSegments() ([]segment, error) {
+	matches, err := filepath.Glob(w.path + ".*")
+	if err != nil {
+		return nil, err
+	}
+
+	segments := make([]segment, 0, len(matches))
+	for _, m := range matches {
+		suffix := strings.TrimPrefix(m, w.path+".")
+		if len(suffix) != segmentSuffixLen {
+			continue
+		}
+
+		first, err := strconv.ParseUint(suffix, 10, 64)
+		if err != nil {
+			continue
+		}
+		segments = append(segments, segment{path: m, first: first})
+	}
+
+	sort.Slice(segments, func(i, j int) bool {
+		return segments[i].first < segments[j].first
+	})
+
+	return segments, nil
+}
+
+func (w *WAL) segmentName(first uint64) string {
+	return fmt.Sprintf("%s.%0*d", w.path, segmentSuffixLen, first)
+}
+
+// AppendSet logs a set and returns its LSN
+func (w *WAL) AppendSet(key string, value []byte, metadata metadata.Map, text string) (uint64, error) {
+	return w.append(Record{Op: OpSet, Key: key, Value: value, Metadata: metadata, Text: text})
+}
+
+// AppendDelete logs a delete and returns its LSN
+func (w *WAL) AppendDelete(key string) (uint64, error) {
+	return w.append(Record{Op: OpDelete, Key: key})
+}
+
+// AppendBatch logs sets and deletes as one record and returns its LSN.
+// Replay applies all of them, in order, or none if the record is torn.
+func (w *WAL) AppendBatch(entries []Record) (uint64, error) {
+	for _, e := range entries {
+		if e.Op != OpSet && e.Op != OpDelete {
+			return 0, fmt.Errorf("wal batch entries must be sets or deletes, got op %d", e.Op)
+		}
+	}
+
+	return w.append(Record{Op: OpBatch, Batch: entries})
+}
+
+func (w *WAL) LogSet(key string, value []byte, metadata metadata.Map, text string) error {
+	_, err := w.AppendSet(key, value, metadata, text)
+	return err
+}
+
+func (w *WAL) LogDelete(key string) error {
+	_, err := w.AppendDelete(key)
+	return err
+}
+
+func (w *WAL) append(rec Record) (uint64, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if w.f == nil {
+		return 0, os.ErrClosed
+	}
+	if w.failed != nil {
+		return 0, w.failed
+	}
+
+	if w.size >= w.opts.SegmentSize && w.lastLSN >= w.firstLSN {
+		if err := w.rollLocked(); err != nil {
+			return 0, err
+		}
+	}
+
+	rec.LSN = w.lastLSN + 1
+	buf, err := rec.encode()
+	if err != nil {
+		return 0, err
+	}
+
+	if _, err := w.f.Write(buf); err != nil {
+		// drop whatever part made it out so the next record starts clean
+		w.rewindLocked()
+		return 0, err
+	}
+
+	if w.opts.Sync == SyncAlways {
+		if err := w.f.Sync(); err != nil {
+			// the caller is told the write failed, so recovery must not
+			// replay it either
+			w.rewindLocked()
+			return 0, err
+		}
+		w.markSynced(rec.LSN)
+	}
+
+	w.size += int64(len(buf))
+	w.lastLSN = rec.LSN
+
+	return rec.LSN, nil
+}
+
+// rewindLocked cuts the active segment back to w.size, dropping a record
+// that failed to append. If that fails too the log can no longer tell
+// which records are in it, so later appends are refused. Caller holds mu.
+func (w *WAL) rewindLocked() {
+	if err := w.f.Truncate(w.size); err != nil {
+		w.failed = fmt.Errorf("wal: undoing a failed append: %w", err)
+		return
+	}
+	if _, err := w.f.Seek(w.size, io.SeekStart); err != nil {
+		w.failed = fmt.Errorf("wal: undoing a failed append: %w", err)
+	}
+}
+
+// WaitDurable blocks until lsn is as durable as the sync mode promises:
+// on stable storage for SyncAlways and SyncGroup, written to the OS for
+// SyncPeriodic (which returns at once). Call it after releasing any locks
+// other writers need, so their records can share the same fsync.
+func (w *WAL) WaitDurable(lsn uint64) error {
+	if w.opts.Sync != SyncGroup {
+		return nil
+	}
+
+	w.syncMu.Lock()
+	defer w.syncMu.Unlock()
+
+	for w.syncedLSN < lsn {
+		if w.syncing {
+			w.syncCond.Wait()
+			continue
+		}
+
+		// become the leader: give other writers a moment to append, then
+		// sync everything written so far for all of them
+		w.syncing = true
+		w.syncMu.Unlock()
+
+		time.Sleep(w.opts.GroupCommitWindow)
+		target, err := w.syncActive()
+
+		w.syncMu.Lock()
+		w.syncing = false
+		if err == nil && target > w.syncedLSN {
+			w.syncedLSN = target
+		}
+		w.syncCond.Broadcast()
+
+		// Close syncs too, so a WAL closed under us may still have covered lsn
+		if err != nil && w.syncedLSN < lsn {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// syncActive fsyncs the active segment without holding mu, so appends carry
+// on during the fsync, and returns the last LSN the sync covers
+func (w *WAL) syncActive() (uint64, error) {
+	w.mu.Lock()
+	f, target := w.f, w.lastLSN
+	w.mu.Unlock()
+
+	if f == nil {
+		return 0, os.ErrClosed
+	}
+
+	if err := f.Sync(); err != nil {
+		// rolled or closed since: both sync the segment first
+		if errors.Is(err, os.ErrClosed) {
+			return target, nil
+		}
+		return 0, err
+	}
+
+	return target, nil
+}
+
+func (w *WAL) markSynced(lsn uint64) {
+	w.syncMu.Lock()
+	if lsn > w.syncedLSN {
+		w.syncedLSN = lsn
+	}
+	w.syncMu.Unlock()
+}
+
+// rollLocked seals the active segment under its first LSN and starts a new one
+func (w *WAL) rollLocked() error {
+	if err := w.f.Sync(); err != nil {
+		return err
+	}
+	w.markSynced(w.lastLSN)
+
+	if err := w.f.Close(); err != nil {
+		return err
+	}
+	w.f = nil
+
+	if err := os.Rename(w.path, w.segmentName(w.firstLSN)); err != nil {
+		return err
+	}
+
+	if err := w.openActive(w.lastLSN + 1); err != nil {
+		return err
+	}
+
+	return syncDir(filepath.Dir(w.path))
+}
+
+// SyncMode is the durability mode the log was opened with
+func (w *WAL) SyncMode() SyncMode {
+	return w.opts.Sync
+}
+
+// LastLSN is the LSN of the last record written
+func (w *WAL) LastLSN() uint64 {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	return w.lastLSN
+}
+
+// AdvanceTo makes sure the next record gets an LSN above lsn, for when a
+// snapshot is newer than everything left in the log
+func (w *WAL) AdvanceTo(lsn uint64) error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if w.f == nil {
+		return os.ErrClosed
+	}
+	if w.lastLSN >= lsn {
+		return nil
+	}
+
+	if w.lastLSN >= w.firstLSN {
+		if err := w.rollLocked(); err != nil {
+			return err
+		}
+	}
+
+	// the active segment is empty; restart it at lsn+1
+	if err := writeSegmentHeader(w.f, lsn+1); err != nil {
+		return err
+	}
+
+	w.size, w.firstLSN, w.lastLSN = segmentHeaderSize, lsn+1, lsn
+	return nil
+}
+
+// Replay applies every record in the log, oldest first
+func (w *WAL) Replay(a Applier) error {
+	return w.ReplayFrom(0, a)
+}
+
+// ReplayFrom applies the records after LSN after, oldest first. Segments
+// that end at or before it are not read.
+func (w *WAL) ReplayFrom(after uint64, a Applier) error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	var apply func(rec Record)
+	apply = func(rec Record) {
+		if rec.LSN <= after {
+			return
+		}
+		switch rec.Op {
+		case OpSet:
+			a.ApplySet(rec.Key, rec.Value, rec.Metadata, rec.Text)
+		case OpDelete:
+			a.ApplyDelete(rec.Key)
+		case OpBatch:
+			for _, e := range rec.Batch {
+				e.LSN = rec.LSN
+				apply(e)
+			}
+		}
+	}
+
+	rolled, err := w.rolledSegments()
+	if err != nil {
+		return err
+	}
+
+	for i, seg := range rolled {
+		end := w.firstLSN
+		if i+1 < len(rolled) {
+			end = rolled[i+1].first
+		}
+		if end-1 <= after {
+			continue
+		}
+
+		if err := readSegment(seg.path, apply); err != nil {
+			return err
+		}
+	}
+
+	if w.lastLSN < w.firstLSN || w.lastLSN <= after {
+		return nil
+	}
+
+	// the active segment was validated by Open and is only appended to
+	f, err := os.Open(w.path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	r := bufio.NewReader(io.LimitReader(f, w.size))
+	if _, err := readSegmentHeader(r); err != nil {
+		return err
+	}
+
+	for {
+		rec, _, err := readRecord(r)
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("%s: %w", w.path, err)
+		}
+		apply(rec)
+	}
+}
+
+// Truncate deletes rolled segments whose records all have LSN <= upTo,
+// typically the LSN a snapshot covers. The active segment is never removed.
+func (w *WAL) Truncate(upTo uint64) error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	return w.truncateLocked(upTo)
+}
+
+func (w *WAL) truncateLocked(upTo uint64) error {
+	rolled, err := w.rolledSegments()
+	if err != nil {
+		return err
+	}
+
+	removed := false
+	for i, seg := range rolled {
+		end := w.firstLSN
+		if i+1 < len(rolled) {
+			end = rolled[i+1].first
+		}
+		if end-1 > upTo {
+			break
+		}
+
+		if err := os.Remove(seg.path); err != nil {
+			return err
+		}
+		removed = true
+	}
+
+	if !removed {
+		return nil
+	}
+
+	return syncDir(filepath.Dir(w.path))
+}
+
+// Reset discards every record. LSNs keep counting up from where they were.
+func (w *WAL) Reset() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if w.f == nil {
+		return os.ErrClosed
+	}
+
+	if w.lastLSN >= w.firstLSN {
+		if err := w.rollLocked(); err != nil {
+			return err
+		}
+	}
+
+	return w.truncateLocked(w.lastLSN)
+}
+
+// Sync flushes the active segment to stable storage
+func (w *WAL) Sync() error {
+	target, err := w.syncActive()
+	if err != nil {
+		return err
+	}
+
+	w.markSynced(target)
+	return nil
+}
+
+func (w *WAL) Close() error {
+	if w.stop != nil {
+		close(w.stop)
+		<-w.done
+		w.stop = nil
+	}
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if w.f == nil {
+		return nil
+	}
+
+	err := w.f.Sync()
+	if err == nil {
+		w.markSynced(w.lastLSN)
+	}
+	if cerr := w.f.Close(); err == nil {
+		err = cerr
+	}
+	w.f = nil
+
+	return err
+}
+
+func syncDir(dir string) error {
+	d, err := os.Open(dir)
+	if err != nil {
+		return err
+	}
+	defer d.Close()
+
+	return d.Sync()
+}
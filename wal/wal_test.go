@@ -0,0 +1,329 @@
+package wal
+
+import (
+	"encoding/binary"
+	"os"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"flashvector/metadata"
+)
+
+type recorder struct {
+	sets    []string
+	deletes []string
+	meta    map[string]metadata.Map
+	text    map[string]string
+}
+
+func (r *recorder) ApplySet(key string, value []byte, meta metadata.Map, text string) {
+	r.sets = append(r.sets, key)
+	if r.meta == nil {
+		r.meta = make(map[string]metadata.Map)
+		r.text = make(map[string]string)
+	}
+	r.meta[key] = meta
+	r.text[key] = text
+}
+
+func (r *recorder) ApplyDelete(key string) {
+	r.deletes = append(r.deletes, key)
+}
+
+func TestAppendAndReplay(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "data.wal")
+
+	w, err := Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for i := 1; i <= 3; i++ {
+		lsn, err := w.AppendSet("k"+strconv.Itoa(i), []byte{byte(i)}, metadata.Map{"n": metadata.IntValue(int64(i))}, "doc "+strconv.Itoa(i))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if lsn != uint64(i) {
+			t.Fatalf("expected lsn %d, got %d", i, lsn)
+		}
+	}
+	if err := w.LogDelete("k2"); err != nil {
+		t.Fatal(err)
+	}
+	w.Close()
+
+	w, err = Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer w.Close()
+
+	if w.LastLSN() != 4 {
+		t.Fatalf("expected LSNs to continue from 4, got %d", w.LastLSN())
+	}
+
+	var r recorder
+	if err := w.ReplayFrom(1, &r); err != nil {
+		t.Fatal(err)
+	}
+	if len(r.sets) != 2 || r.sets[0] != "k2" || len(r.deletes) != 1 || !r.meta["k3"]["n"].Equal(metadata.IntValue(3)) || r.text["k3"] != "doc 3" {
+		t.Fatalf("unexpected replay: %+v", r)
+	}
+}
+
+func TestSegmentsRollAndTruncate(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "data.wal")
+
+	w, err := OpenWithOptions(path, Options{SegmentSize: 256})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer w.Close()
+
+	value := make([]byte, 100)
+	for i := 0; i < 20; i++ {
+		if err := w.LogSet("k"+strconv.Itoa(i), value, nil, ""); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	rolled, _ := w.rolledSegments()
+	if len(rolled) < 5 {
+		t.Fatalf("expected the log to roll into several segments, got %d", len(rolled))
+	}
+
+	// only segments entirely at or below the covered LSN go
+	if err := w.Truncate(10); err != nil {
+		t.Fatal(err)
+	}
+	remaining, _ := w.rolledSegments()
+	if len(remaining) == 0 || len(remaining) >= len(rolled) {
+		t.Fatalf("expected some but not all segments truncated, %d of %d left", len(remaining), len(rolled))
+	}
+	if remaining[0].first > 11 {
+		t.Fatalf("segment holding lsn 11 was removed (oldest left starts at %d)", remaining[0].first)
+	}
+
+	var r recorder
+	if err := w.ReplayFrom(10, &r); err != nil {
+		t.Fatal(err)
+	}
+	if len(r.sets) != 10 || r.sets[0] != "k10" {
+		t.Fatalf("expected lsn 11..20 after truncation, got %v", r.sets)
+	}
+}
+
+func TestTornTailIsRepaired(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "data.wal")
+
+	w, err := Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	w.LogSet("a", []byte("1"), nil, "")
+	w.LogSet("b", []byte("2"), nil, "")
+	w.Close()
+
+	info, _ := os.Stat(path)
+	good := info.Size()
+
+	// half of a third record, as if the process died mid-write
+	rec := Record{LSN: 3, Op: OpSet, Key: "c", Value: []byte("3")}
+	encoded, _ := rec.encode()
+	f, _ := os.OpenFile(path, os.O_APPEND|os.O_WRONLY, 0644)
+	f.Write(encoded[:len(encoded)/2])
+	f.Close()
+
+	w, err = Open(path)
+	if err != nil {
+		t.Fatalf("expected the torn tail to be repaired, got %v", err)
+	}
+	defer w.Close()
+
+	if info, _ := os.Stat(path); info.Size() != good {
+		t.Fatalf("expected the file cut back to %d bytes, got %d", good, info.Size())
+	}
+
+	lsn, err := w.AppendSet("c", []byte("3"), nil, "")
+	if err != nil || lsn != 3 {
+		t.Fatalf("expected to continue at lsn 3, got %d %v", lsn, err)
+	}
+
+	var r recorder
+	if err := w.Replay(&r); err != nil {
+		t.Fatal(err)
+	}
+	if len(r.sets) != 3 {
+		t.Fatalf("expected 3 records after repair, got %v", r.sets)
+	}
+}
+
+func TestAdvanceTo(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "data.wal")
+
+	w, err := Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer w.Close()
+
+	w.LogSet("a", nil, nil, "")
+	if err := w.AdvanceTo(100); err != nil {
+		t.Fatal(err)
+	}
+
+	lsn, err := w.AppendDelete("a")
+	if err != nil || lsn != 101 {
+		t.Fatalf("expected lsn 101, got %d %v", lsn, err)
+	}
+
+	var r recorder
+	if err := w.Replay(&r); err != nil {
+		t.Fatal(err)
+	}
+	if len(r.sets) != 1 || len(r.deletes) != 1 {
+		t.Fatalf("expected both records across the gap, got %+v", r)
+	}
+}
+
+func TestSyncModes(t *testing.T) {
+	for _, mode := range []SyncMode{SyncAlways, SyncGroup, SyncPeriodic} {
+		t.Run(mode.String(), func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "data.wal")
+
+			w, err := OpenWithOptions(path, Options{Sync: mode, SyncInterval: 10 * time.Millisecond})
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			var wg sync.WaitGroup
+			for i := 0; i < 16; i++ {
+				wg.Add(1)
+				go func(i int) {
+					defer wg.Done()
+					lsn, err := w.AppendSet("k"+strconv.Itoa(i), nil, nil, "")
+					if err != nil {
+						t.Error(err)
+						return
+					}
+					if err := w.WaitDurable(lsn); err != nil {
+						t.Error(err)
+					}
+				}(i)
+			}
+			wg.Wait()
+
+			if mode != SyncPeriodic {
+				w.syncMu.Lock()
+				synced := w.syncedLSN
+				w.syncMu.Unlock()
+				if synced != 16 {
+					t.Fatalf("expected every acknowledged lsn synced, got %d", synced)
+				}
+			}
+
+			if err := w.Close(); err != nil {
+				t.Fatal(err)
+			}
+
+			w, err = Open(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer w.Close()
+
+			var r recorder
+			if err := w.Replay(&r); err != nil {
+				t.Fatal(err)
+			}
+			if len(r.sets) != 16 {
+				t.Fatalf("expected 16 records, got %d", len(r.sets))
+			}
+		})
+	}
+}
+
+func TestParseSyncMode(t *testing.T) {
+	for name, want := range map[string]SyncMode{"": SyncPeriodic, "always": SyncAlways, "Group": SyncGroup, "periodic": SyncPeriodic} {
+		got, err := ParseSyncMode(name)
+		if err != nil || got != want {
+			t.Fatalf("ParseSyncMode(%q) = %v, %v", name, got, err)
+		}
+	}
+	if _, err := ParseSyncMode("sometimes"); err == nil {
+		t.Fatalf("expected an unknown mode to be rejected")
+	}
+}
+
+func TestBatchIsAtomic(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "data.wal")
+
+	w, err := Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	w.LogSet("a", []byte("1"), nil, "")
+
+	lsn, err := w.AppendBatch([]Record{
+		{Op: OpSet, Key: "b", Value: []byte("2"), Metadata: metadata.Map{"n": metadata.StringValue("2"), "tags": metadata.ListValue("x", "y")}, Text: "two"},
+		{Op: OpDelete, Key: "a"},
+		{Op: OpSet, Key: "c", Value: []byte("3")},
+	})
+	if err != nil || lsn != 2 {
+		t.Fatalf("expected the batch at lsn 2, got %d %v", lsn, err)
+	}
+	if _, err := w.AppendBatch([]Record{{Op: OpBatch}}); err == nil {
+		t.Fatalf("expected nested batches to be refused")
+	}
+
+	var r recorder
+	if err := w.Replay(&r); err != nil {
+		t.Fatal(err)
+	}
+	if len(r.sets) != 3 || r.sets[1] != "b" || len(r.deletes) != 1 || !r.meta["b"]["n"].Equal(metadata.StringValue("2")) || !r.meta["b"]["tags"].Equal(metadata.ListValue("x", "y")) || r.text["b"] != "two" {
+		t.Fatalf("unexpected replay: %+v", r)
+	}
+
+	// a batch torn part way through is dropped whole
+	w.Close()
+
+	info, _ := os.Stat(path)
+	os.Truncate(path, info.Size()-20)
+
+	w, err = Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer w.Close()
+
+	r = recorder{}
+	if err := w.Replay(&r); err != nil {
+		t.Fatal(err)
+	}
+	if len(r.sets) != 1 || len(r.deletes) != 0 || w.LastLSN() != 1 {
+		t.Fatalf("expected none of the torn batch, got %+v at lsn %d", r, w.LastLSN())
+	}
+}
+
+func TestRecordWithoutTextDecodes(t *testing.T) {
+	// a set as written before records carried text
+	body := binary.LittleEndian.AppendUint64(nil, 7)
+	body = append(body, byte(OpSet))
+	body = appendBytes(body, []byte("k"))
+	body = appendBytes(body, []byte{1, 2})
+	body = binary.AppendUvarint(body, 1)
+	body = appendBytes(body, []byte("n"))
+	body = appendBytes(body, []byte("1"))
+
+	var rec Record
+	if err := rec.decode(body); err != nil {
+		t.Fatal(err)
+	}
+	// and before metadata had types: values read back as strings
+	if rec.LSN != 7 || rec.Key != "k" || !rec.Metadata["n"].Equal(metadata.StringValue("1")) || rec.Text != "" {
+		t.Fatalf("unexpected record %+v", rec)
+	}
+}